@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,11 +14,83 @@ type Config struct {
 	DBUser     string
 	DBPassword string
 	JwtSecret  string
+	//lifetimes of user access and refresh tokens
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	//audience of tokens issued to users, tokens for other audiences are rejected
+	JwtAudience string
+	//clock skew allowed when checking token expiry and not before times
+	JwtLeeway  time.Duration
 	Production bool
+	//key required to manage oauth clients, management is disabled when empty
+	AdminApiKey string
+	//public url of the auth service, used as the issuer of every token
+	Issuer string
+	//pem encoded rsa key used to sign id tokens, an ephemeral key is generated when empty
+	OIDCSigningKeyFile string
+	//external openid connect providers users can sign in with
+	Providers []ProviderConfig
+	//smtp server used to send emails, emails are only logged when no host is set
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	//url of the magic link callback sent in login emails
+	MagicLinkURL string
+	//number of magic links that can be requested per email within the window
+	MagicLinkRateLimit         int
+	MagicLinkRateWindowMinutes int
+	//relying party used for passkeys, origins are the front ends allowed to use them
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+	//algorithm used to hash new passwords, argon2id or bcrypt, older hashes are upgraded on login
+	PasswordHashAlgorithm string
+	//argon2id cost, memory is in KiB
+	Argon2MemoryKB    int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	BcryptCost        int
+	//rules new passwords have to follow
+	PasswordMinLength            int
+	PasswordMaxLength            int
+	PasswordMinCharacterClasses  int
+	PasswordMaxRepeats           int
+	PasswordDisallowPersonalInfo bool
+	//sha1 hash list of breached passwords, one HASH:COUNT per line, the check is skipped when empty
+	BreachedPasswordsFile string
+	//lifetime of access tokens issued to admins impersonating a user
+	ImpersonationTTLMinutes int
+	//SameSite attribute of the session cookies, strict, lax or none
+	CookieSameSite string
+	//origins other than the service's own allowed to make cookie authenticated requests
+	CSRFTrustedOrigins []string
+	//base url of the user service, which owns user profiles
+	UserServiceURL string
+	//audience of tokens the auth service mints to call the user service
+	UserServiceAudience string
+	//audience service clients need tokens for to call the internal credentials api
+	InternalAudience string
+	//copies credentials from the users table shared with the user service on startup
+	MigrateLegacyUsers bool
+	//broker the user service publishes user events to, memory only receives events published within the process
+	EventBroker string
+	NATSURL     string
+}
+
+// configuration of an external openid connect provider
+type ProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
 }
 
 // Using type constraints to limit T to supported types
-func getEnvOrDefault[T string | int | float64 | bool](key string, defaultValue T) T {
+func getEnvOrDefault[T string | int | float64 | bool | time.Duration](key string, defaultValue T) T {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
@@ -26,6 +100,10 @@ func getEnvOrDefault[T string | int | float64 | bool](key string, defaultValue T
 	switch any(defaultValue).(type) {
 	case string:
 		return any(value).(T)
+	case time.Duration:
+		if v, err := time.ParseDuration(value); err == nil {
+			return any(v).(T)
+		}
 	case int:
 		if v, err := strconv.Atoi(value); err == nil {
 			return any(v).(T)
@@ -43,14 +121,89 @@ func getEnvOrDefault[T string | int | float64 | bool](key string, defaultValue T
 	return defaultValue
 }
 
+// loads every provider listed in OIDC_PROVIDERS, each configured through OIDC_<NAME>_* variables
+func loadProviders(issuer string) []ProviderConfig {
+	var providers []ProviderConfig
+
+	for _, name := range strings.Split(getEnvOrDefault("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, ProviderConfig{
+			Name:         name,
+			Issuer:       getEnvOrDefault(prefix+"ISSUER", ""),
+			ClientID:     getEnvOrDefault(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnvOrDefault(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnvOrDefault(prefix+"REDIRECT_URL", issuer+"/federation/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnvOrDefault(prefix+"SCOPES", "openid profile email")),
+		})
+	}
+
+	return providers
+}
+
+// finds the configuration of an external provider by name
+func (c *Config) Provider(name string) (*ProviderConfig, bool) {
+	for i := range c.Providers {
+		if c.Providers[i].Name == name {
+			return &c.Providers[i], true
+		}
+	}
+	return nil, false
+}
+
 func LoadConfig() *Config {
+	issuer := getEnvOrDefault("ISSUER", "http://localhost:8080/auth")
+
 	return &Config{
-		DBHost:     getEnvOrDefault("DB_HOST", "user-db"),
-		DBPort:     getEnvOrDefault("DB_PORT", "3306"),
-		DBName:     getEnvOrDefault("DB_NAME", "users"),
-		DBUser:     getEnvOrDefault("DB_USER", "root"),
-		DBPassword: getEnvOrDefault("DB_PASSWORD", ""),
-		JwtSecret:  getEnvOrDefault("JWT_SECRET", ""),
-		Production: getEnvOrDefault("PRODUCTION", false),
+		DBHost:                       getEnvOrDefault("DB_HOST", "user-db"),
+		DBPort:                       getEnvOrDefault("DB_PORT", "3306"),
+		DBName:                       getEnvOrDefault("DB_NAME", "users"),
+		DBUser:                       getEnvOrDefault("DB_USER", "root"),
+		DBPassword:                   getEnvOrDefault("DB_PASSWORD", ""),
+		JwtSecret:                    getEnvOrDefault("JWT_SECRET", ""),
+		AccessTokenTTL:               getEnvOrDefault("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:              getEnvOrDefault("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		JwtAudience:                  getEnvOrDefault("JWT_AUDIENCE", "basic-go-micro"),
+		JwtLeeway:                    getEnvOrDefault("JWT_LEEWAY", 30*time.Second),
+		Production:                   getEnvOrDefault("PRODUCTION", false),
+		AdminApiKey:                  getEnvOrDefault("ADMIN_API_KEY", ""),
+		Issuer:                       issuer,
+		OIDCSigningKeyFile:           getEnvOrDefault("OIDC_SIGNING_KEY_FILE", ""),
+		Providers:                    loadProviders(issuer),
+		SMTPHost:                     getEnvOrDefault("SMTP_HOST", ""),
+		SMTPPort:                     getEnvOrDefault("SMTP_PORT", "587"),
+		SMTPUsername:                 getEnvOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword:                 getEnvOrDefault("SMTP_PASSWORD", ""),
+		MailFrom:                     getEnvOrDefault("MAIL_FROM", "no-reply@localhost"),
+		MagicLinkURL:                 getEnvOrDefault("MAGIC_LINK_URL", issuer+"/magic-link/callback"),
+		MagicLinkRateLimit:           getEnvOrDefault("MAGIC_LINK_RATE_LIMIT", 3),
+		MagicLinkRateWindowMinutes:   getEnvOrDefault("MAGIC_LINK_RATE_WINDOW_MINUTES", 15),
+		WebAuthnRPID:                 getEnvOrDefault("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:               getEnvOrDefault("WEBAUTHN_RP_NAME", "basic-go-micro"),
+		WebAuthnOrigins:              strings.Split(getEnvOrDefault("WEBAUTHN_ORIGINS", "http://localhost:8080"), ","),
+		PasswordHashAlgorithm:        getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2MemoryKB:               getEnvOrDefault("ARGON2_MEMORY_KB", 64*1024),
+		Argon2Iterations:             getEnvOrDefault("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:            getEnvOrDefault("ARGON2_PARALLELISM", 2),
+		BcryptCost:                   getEnvOrDefault("BCRYPT_COST", 10),
+		PasswordMinLength:            getEnvOrDefault("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:            getEnvOrDefault("PASSWORD_MAX_LENGTH", 256),
+		PasswordMinCharacterClasses:  getEnvOrDefault("PASSWORD_MIN_CHARACTER_CLASSES", 1),
+		PasswordMaxRepeats:           getEnvOrDefault("PASSWORD_MAX_REPEATS", 3),
+		PasswordDisallowPersonalInfo: getEnvOrDefault("PASSWORD_DISALLOW_PERSONAL_INFO", true),
+		BreachedPasswordsFile:        getEnvOrDefault("BREACHED_PASSWORDS_FILE", ""),
+		ImpersonationTTLMinutes:      getEnvOrDefault("IMPERSONATION_TTL_MINUTES", 10),
+		CookieSameSite:               getEnvOrDefault("COOKIE_SAMESITE", "lax"),
+		CSRFTrustedOrigins:           strings.Fields(strings.ReplaceAll(getEnvOrDefault("CSRF_TRUSTED_ORIGINS", ""), ",", " ")),
+		UserServiceURL:               getEnvOrDefault("USER_SERVICE_URL", "http://user-service:8080"),
+		UserServiceAudience:          getEnvOrDefault("USER_SERVICE_AUDIENCE", "user-service"),
+		InternalAudience:             getEnvOrDefault("INTERNAL_AUDIENCE", "auth-service"),
+		MigrateLegacyUsers:           getEnvOrDefault("MIGRATE_LEGACY_USERS", true),
+		EventBroker:                  getEnvOrDefault("EVENT_BROKER", "memory"),
+		NATSURL:                      getEnvOrDefault("NATS_URL", "nats://nats:4222"),
 	}
 }
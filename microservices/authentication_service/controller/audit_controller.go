@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// header carrying the id used to correlate a request across services and the audit log
+const requestIDHeader = "X-Request-ID"
+
+// context key the request id is stored under
+const requestIDKey = "request_id"
+
+// middleware reusing the caller's request id, or generating one, and echoing it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate request ID"})
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// lists audit events newest first, admins only
+func (ac *AuthController) ListAuditEvents(c *gin.Context) {
+	claims, query, ok := ac.auditQuery(c)
+	if !ok {
+		return
+	}
+
+	page, e := ac.AuthService.ListAuditEvents(claims, query)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// streams every matching audit event oldest first as json lines, admins only
+func (ac *AuthController) ExportAuditEvents(c *gin.Context) {
+	claims, query, ok := ac.auditQuery(c)
+	if !ok {
+		return
+	}
+
+	events, e := ac.AuthService.ExportAuditEvents(claims, query)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-events.jsonl"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	for event, err := range events {
+		//the status has already been sent, so a failure can only cut the export short
+		if err != nil {
+			log.Printf("audit export failed: %v", err)
+			return
+		}
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+	}
+}
+
+// reads the claims and filters shared by the audit endpoints
+func (ac *AuthController) auditQuery(c *gin.Context) (*dtos.CustomClaims, *dtos.AuditEventQuery, bool) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var query dtos.AuditEventQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query parameters",
+			"details": err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	return claims, &query, true
+}
+
+// records an audit event with the details of the current request
+func (ac *AuthController) audit(c *gin.Context, event *dtos.AuditEvent) {
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.RequestID = c.GetString(requestIDKey)
+	ac.AuthService.RecordAuditEvent(event)
+}
+
+// records a login attempt, the user is taken from the issued access token when it succeeded
+func (ac *AuthController) auditLogin(c *gin.Context, method, email string, login *dtos.UserLoginResponse, failure *e.Error) {
+	event := &dtos.AuditEvent{Type: dtos.AuditLoginSucceeded, Method: method, Email: email, Success: true}
+
+	if failure != nil {
+		event.Type = dtos.AuditLoginFailed
+		event.Success = false
+		event.Details = failure.Message
+	} else if claims, err := ac.AuthService.ParseJWT(&login.AccessToken); err == nil {
+		event.UserID = claims.UserID
+		event.Email = claims.Email
+	}
+
+	ac.audit(c, event)
+}
+
+// records an action taken by the authenticated user, including the admin when impersonating
+func (ac *AuthController) auditUser(c *gin.Context, eventType string, claims *dtos.CustomClaims, failure *e.Error, details string) {
+	event := &dtos.AuditEvent{
+		Type:    eventType,
+		UserID:  claims.UserID,
+		Email:   claims.Email,
+		Success: failure == nil,
+		Details: details,
+	}
+	if claims.Act != nil {
+		event.ActorID = claims.Act.UserID
+	}
+	if failure != nil {
+		event.Details = failure.Message
+	}
+
+	ac.audit(c, event)
+}
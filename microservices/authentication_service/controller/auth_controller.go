@@ -30,6 +30,8 @@ func NewAuthController(AuthService *AuthService) *AuthController {
 
 // define all our routes for the controller
 func (ac *AuthController) DefineRoutes(r *gin.Engine) {
+	r.Use(RequestID())
+
 	userGroup := r.Group("/auth")
 	{
 		userGroup.GET("/health", ac.TestConnection)
@@ -37,7 +39,67 @@ func (ac *AuthController) DefineRoutes(r *gin.Engine) {
 		userGroup.POST("/login", ac.LoginUser)
 		userGroup.GET("/claims", ac.ShowClaims)
 		userGroup.POST("/logout", ac.LogoutUser)
-		userGroup.GET("/refresh", ac.RefreshToken)
+		userGroup.POST("/refresh", ac.RefreshToken)
+		userGroup.GET("/refresh", ac.DeprecatedRefreshToken)
+		userGroup.GET("/csrf", ac.CSRFToken)
+		userGroup.POST("/magic-link", ac.RequestMagicLink)
+		userGroup.GET("/magic-link/callback", ac.MagicLinkCallback)
+		userGroup.POST("/password/change", ac.ChangePassword)
+		userGroup.POST("/impersonate/:userId", ac.Impersonate)
+		userGroup.GET("/impersonations", ac.ListImpersonations)
+		userGroup.PUT("/users/:userId/role", ac.SetUserRole)
+		userGroup.GET("/audit-events", ac.ListAuditEvents)
+		userGroup.GET("/audit-events/export", ac.ExportAuditEvents)
+	}
+
+	//called by other services with client credentials tokens
+	internalGroup := r.Group("/auth/internal")
+	{
+		internalGroup.PUT("/credentials/:userId", ac.SetCredential)
+		internalGroup.PUT("/credentials/:userId/status", ac.SetCredentialStatus)
+		internalGroup.DELETE("/credentials/:userId", ac.DeleteCredential)
+		internalGroup.GET("/users/:userId/personal-data", ac.ExportUserData)
+		internalGroup.DELETE("/users/:userId/personal-data", ac.EraseUserData)
+	}
+
+	oauthGroup := r.Group("/auth/oauth")
+	{
+		oauthGroup.POST("/token", ac.Token)
+		oauthGroup.POST("/clients", ac.RegisterClient)
+		oauthGroup.GET("/authorize", ac.Authorize)
+		oauthGroup.POST("/authorize", ac.AuthorizeLogin)
+		oauthGroup.GET("/userinfo", ac.UserInfo)
+		oauthGroup.POST("/userinfo", ac.UserInfo)
+	}
+
+	federationGroup := r.Group("/auth/federation")
+	{
+		federationGroup.GET("/providers", ac.ListProviders)
+		federationGroup.GET("/:provider/login", ac.FederatedLogin)
+		federationGroup.GET("/:provider/callback", ac.FederatedCallback)
+	}
+
+	identityGroup := r.Group("/auth/identities")
+	{
+		identityGroup.GET("", ac.ListIdentities)
+		identityGroup.POST("/:provider/link", ac.LinkIdentity)
+		identityGroup.DELETE("/:provider", ac.UnlinkIdentity)
+	}
+
+	webAuthnGroup := r.Group("/auth/webauthn")
+	{
+		webAuthnGroup.POST("/register/begin", ac.BeginPasskeyRegistration)
+		webAuthnGroup.POST("/register/finish", ac.FinishPasskeyRegistration)
+		webAuthnGroup.POST("/login/begin", ac.BeginPasskeyLogin)
+		webAuthnGroup.POST("/login/finish", ac.FinishPasskeyLogin)
+		webAuthnGroup.GET("/credentials", ac.ListPasskeys)
+		webAuthnGroup.DELETE("/credentials/:id", ac.DeletePasskey)
+	}
+
+	wellKnownGroup := r.Group("/auth/.well-known")
+	{
+		wellKnownGroup.GET("/openid-configuration", ac.Discovery)
+		wellKnownGroup.GET("/jwks.json", ac.JWKS)
 	}
 }
 
@@ -61,21 +123,16 @@ func (ac *AuthController) LoginUser(c *gin.Context) {
 
 	//login using auth service
 	response, e := ac.AuthService.UserLogin(&request)
+	ac.auditLogin(c, "password", request.Email, response, e)
 	if e != nil {
 		c.JSON(e.Code, e.ToJson())
 		return
 	}
 
 	//set our http only cookie for refresh token
-	c.SetCookie(
-		"refresh_token",
-		response.RefreshToken,
-		60*60*24*7,                   //cookie expiration time in seconds (e.g., 7 days)
-		"/",                          //path where the cookie is available
-		"",                           //domain
-		conf.LoadConfig().Production, //secure (set to true in production to require HTTPS)
-		true,                         // HttpOnly (prevents JavaScript access to the cookie)
-	)
+	if !ac.setRefreshCookie(c, response.RefreshToken) {
+		return
+	}
 
 	//hiding refresh token from user for security
 	c.JSON(200, &dtos.RefreshResponse{
@@ -97,6 +154,10 @@ func (ac *AuthController) ShowClaims(c *gin.Context) {
 
 // endpoint used to logout user
 func (ac *AuthController) LogoutUser(c *gin.Context) {
+	if !ac.requireCSRF(c) {
+		return
+	}
+
 	//get refresh token from cookie
 	refresh, err := ac.getRefreshCookie(c)
 	if err != nil {
@@ -111,27 +172,24 @@ func (ac *AuthController) LogoutUser(c *gin.Context) {
 
 	//logout user
 	e := ac.AuthService.Logout(claims.UserID)
+	ac.auditUser(c, dtos.AuditLogout, claims, e, "all refresh tokens revoked")
 	if e != nil {
 		c.JSON(e.Code, e.ToJson())
 		return
 	}
 
-	//clear refresh token cookie
-	c.SetCookie(
-		"refresh_token",
-		"",
-		-1,
-		"/",
-		"",
-		conf.LoadConfig().Production,
-		true,
-	)
+	//clear refresh token and csrf cookies
+	ac.setSessionCookie(c, "refresh_token", "", -1, true)
+	ac.setSessionCookie(c, csrfCookie, "", -1, false)
 
 	c.Status(http.StatusNoContent)
 }
 
 // function generates new auth token from refresh token stores in cookie
 func (ac *AuthController) RefreshToken(c *gin.Context) {
+	if !ac.requireCSRF(c) {
+		return
+	}
 
 	refresh, err := ac.getRefreshCookie(c)
 	if err != nil {
@@ -141,13 +199,24 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 	//refresh auth token from cookie
 	response, e := ac.AuthService.RefreshToken(refresh)
 	if e != nil {
+		ac.audit(c, &dtos.AuditEvent{Type: dtos.AuditTokenRefreshed, Details: e.Message})
 		c.JSON(e.Code, e.ToJson())
 		return
 	}
+	if claims, err := ac.AuthService.ParseJWT(&response.AccessToken); err == nil {
+		ac.auditUser(c, dtos.AuditTokenRefreshed, claims, nil, "")
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GET version of the refresh endpoint kept for older clients, use POST /auth/refresh instead
+func (ac *AuthController) DeprecatedRefreshToken(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	c.Header("Link", `</auth/refresh>; rel="successor-version"`)
+	ac.RefreshToken(c)
+}
+
 // endpoint to check if user is authenticated
 func (ac *AuthController) CheckIsAuthenticated(c *gin.Context) {
 	//extract auth token from header
@@ -160,7 +229,7 @@ func (ac *AuthController) CheckIsAuthenticated(c *gin.Context) {
 	}
 
 	//parse claims, which checks if token is valid
-	_, err = ac.AuthService.ParseJWT(token)
+	claims, err := ac.AuthService.ParseJWT(token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": err.Error(),
@@ -168,6 +237,11 @@ func (ac *AuthController) CheckIsAuthenticated(c *gin.Context) {
 		return
 	}
 
+	//flag impersonated requests so downstream services can tell who is really acting
+	if claims.Act != nil {
+		c.Header("X-Impersonated-By", claims.Act.Subject)
+	}
+
 	//able to properly extract claims which means token is valid
 	c.String(http.StatusOK, "authorized")
 }
@@ -217,6 +291,18 @@ func (ac *AuthController) ExtractAuthorization(c *gin.Context) (*string, error)
 	return &token, nil
 }
 
+// sets the http only cookie holding the refresh token, writing an error response when that isn't possible
+func (ac *AuthController) setRefreshCookie(c *gin.Context, refreshToken string) bool {
+	//every new session gets a new csrf token, it's set first so a session is never started without one
+	if _, ok := ac.setCSRFCookie(c); !ok {
+		return false
+	}
+
+	//http only so scripts can never read the refresh token
+	ac.setSessionCookie(c, "refresh_token", refreshToken, int(conf.LoadConfig().RefreshTokenTTL.Seconds()), true)
+	return true
+}
+
 // gets refresh token from cookie
 func (ac *AuthController) getRefreshCookie(c *gin.Context) (string, error) {
 	cookie, err := c.Cookie("refresh_token")
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	conf "authentication-service/config"
+	"authentication-service/dtos"
+	. "authentication-service/service"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// creates or updates a user's credential, called by the user service
+func (ac *AuthController) SetCredential(c *gin.Context) {
+	if !ac.requireServiceScope(c, ScopeCredentialsWrite) {
+		return
+	}
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request dtos.CredentialUpsert
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if e := ac.AuthService.SetCredential(userID, &request); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// sets whether a user can get tokens, called by the user service when a user's status changes
+func (ac *AuthController) SetCredentialStatus(c *gin.Context) {
+	if !ac.requireServiceScope(c, ScopeCredentialsWrite) {
+		return
+	}
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request dtos.CredentialStatus
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	e := ac.AuthService.SetCredentialStatus(userID, &request)
+	details := "status set to " + request.Status
+	if request.Reason != "" {
+		details += ": " + request.Reason
+	}
+	ac.audit(c, &dtos.AuditEvent{Type: dtos.AuditStatusChanged, UserID: userID, Method: "service", Success: e == nil, Details: details})
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// removes a user's credential and sessions, called by the user service when a user is deleted
+func (ac *AuthController) DeleteCredential(c *gin.Context) {
+	if !ac.requireServiceScope(c, ScopeCredentialsWrite) {
+		return
+	}
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	if e := ac.AuthService.DeleteCredential(userID); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ensures the request carries a service client token for the internal api with the given scope
+func (ac *AuthController) requireServiceScope(c *gin.Context, scope string) bool {
+	token, err := ac.ExtractAuthorization(c)
+	if err != nil {
+		return false
+	}
+
+	claims, err := ac.AuthService.ParseJWTForAudience(token, conf.LoadConfig().InternalAudience)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if claims.ClientID == "" || !slices.Contains(strings.Fields(claims.Scope), scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope"})
+		return false
+	}
+	return true
+}
+
+// parses the userId path parameter, writing a bad request when it isn't a valid id
+func parseUserIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
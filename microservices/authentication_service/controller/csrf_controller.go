@@ -0,0 +1,137 @@
+package controller
+
+import (
+	conf "authentication-service/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// double submit csrf token, readable by the front end so it can echo it in the header
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// issues a csrf token for sessions started before csrf tokens existed
+func (ac *AuthController) CSRFToken(c *gin.Context) {
+	token, ok := ac.setCSRFCookie(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+}
+
+// rejects cookie authenticated requests that could have been forged by another site. Requests from
+// an untrusted Origin (or Referer) are always rejected, unsafe methods also need the csrf token
+// from the cookie echoed in the X-CSRF-Token header
+func (ac *AuthController) requireCSRF(c *gin.Context) bool {
+	if !ac.trustedOrigin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cross site request rejected"})
+		return false
+	}
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return true
+	}
+
+	cookie, err := c.Cookie(csrfCookie)
+	header := c.GetHeader(csrfHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+		return false
+	}
+	return true
+}
+
+// the csrf check for html forms, which submit the token from the cookie in the csrf_token field
+func (ac *AuthController) requireFormCSRF(c *gin.Context) bool {
+	if !ac.trustedOrigin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cross site request rejected"})
+		return false
+	}
+
+	cookie, err := c.Cookie(csrfCookie)
+	field := c.PostForm(csrfCookie)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(field)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+		return false
+	}
+	return true
+}
+
+// whether the request came from the service's own host or a configured trusted origin,
+// requests without Origin or Referer (such as from non browser clients) are allowed
+func (ac *AuthController) trustedOrigin(c *gin.Context) bool {
+	origin := c.GetHeader("Origin")
+	if origin == "" || origin == "null" {
+		origin = c.GetHeader("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, c.Request.Host) {
+		return true
+	}
+
+	for _, trusted := range conf.LoadConfig().CSRFTrustedOrigins {
+		if strings.EqualFold(parsed.Scheme+"://"+parsed.Host, strings.TrimSuffix(trusted, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sets a fresh csrf token cookie, returning the token. A predictable token would be no protection, so when
+// generating it fails an error response is written instead
+func (ac *AuthController) setCSRFCookie(c *gin.Context) (string, bool) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+		return "", false
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	//not http only, the front end has to read it to send it back in the header
+	ac.setSessionCookie(c, csrfCookie, token, int(conf.LoadConfig().RefreshTokenTTL.Seconds()), false)
+	return token, true
+}
+
+// sets a cookie with the configured SameSite attribute, a negative max age deletes it
+func (ac *AuthController) setSessionCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	config := conf.LoadConfig()
+	sameSite := sameSiteMode(config.CookieSameSite)
+
+	c.SetSameSite(sameSite)
+	c.SetCookie(
+		name,
+		value,
+		maxAge,
+		"/",
+		"",
+		//browsers drop SameSite=None cookies that aren't secure
+		config.Production || sameSite == http.SameSiteNoneMode,
+		httpOnly,
+	)
+}
+
+// parses the configured SameSite attribute, defaulting to lax
+func sameSiteMode(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
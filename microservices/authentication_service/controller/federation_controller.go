@@ -0,0 +1,137 @@
+package controller
+
+import (
+	conf "authentication-service/config"
+	"authentication-service/dtos"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lists the external identity providers users can sign in with
+func (ac *AuthController) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, ac.AuthService.ListProviders())
+}
+
+// redirects the user to an external provider to sign in
+func (ac *AuthController) FederatedLogin(c *gin.Context) {
+	redirect, e := ac.AuthService.BeginFederatedLogin(c.Param("provider"), 0)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	ac.setFederationStateCookie(c, redirect.State, 0)
+	c.Redirect(http.StatusFound, redirect.AuthorizationURL)
+}
+
+// handles the redirect back from an external provider
+func (ac *AuthController) FederatedCallback(c *gin.Context) {
+	//the provider reports failures such as a denied login through the error parameter
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Identity provider returned an error",
+			"details": providerErr,
+		})
+		return
+	}
+
+	//a callback started in another browser could sign the user into someone else's account
+	state := c.Query("state")
+	cookie, err := c.Cookie(federationStateCookie)
+	ac.setFederationStateCookie(c, "", -1)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not started in this browser"})
+		return
+	}
+
+	method := "federation:" + c.Param("provider")
+	result, e := ac.AuthService.CompleteFederatedLogin(c.Param("provider"), state, c.Query("code"))
+	if e != nil {
+		ac.auditLogin(c, method, "", nil, e)
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	if result.Identity != nil {
+		ac.audit(c, &dtos.AuditEvent{Type: dtos.AuditIdentityLinked, UserID: result.UserID, Email: result.Identity.Email, Method: method, Success: true})
+		c.JSON(http.StatusOK, result.Identity)
+		return
+	}
+	ac.auditLogin(c, method, "", result.Login, nil)
+
+	//signing in with a provider results in the same session as a password login
+	if !ac.setRefreshCookie(c, result.Login.RefreshToken) {
+		return
+	}
+	c.JSON(http.StatusOK, dtos.NewRefreshResponse(result.Login.AccessToken))
+}
+
+// lists the external identities linked to the authenticated user
+func (ac *AuthController) ListIdentities(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return
+	}
+
+	identities, e := ac.AuthService.ListIdentities(claims.UserID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// starts linking an external identity to the authenticated user
+func (ac *AuthController) LinkIdentity(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil || ac.rejectImpersonation(c, claims) {
+		return
+	}
+
+	redirect, e := ac.AuthService.BeginFederatedLogin(c.Param("provider"), claims.UserID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+	ac.setFederationStateCookie(c, redirect.State, 0)
+
+	//the client navigates to the provider itself since the request carries a bearer token
+	c.JSON(http.StatusOK, redirect)
+}
+
+// unlinks an external identity from the authenticated user
+func (ac *AuthController) UnlinkIdentity(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil || ac.rejectImpersonation(c, claims) {
+		return
+	}
+
+	e := ac.AuthService.UnlinkIdentity(claims.UserID, c.Param("provider"))
+	ac.auditUser(c, dtos.AuditIdentityUnlinked, claims, e, c.Param("provider"))
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// cookie holding the state of the login with an external provider started in this browser
+const federationStateCookie = "federation_state"
+
+// sets the state cookie for the callback, a max age of 0 keeps it for the browser session and a negative one
+// deletes it
+func (ac *AuthController) setFederationStateCookie(c *gin.Context, state string, maxAge int) {
+	config := conf.LoadConfig()
+	sameSite := sameSiteMode(config.CookieSameSite)
+	//the provider redirects back from another site, strict cookies wouldn't be sent along
+	if sameSite == http.SameSiteStrictMode {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	c.SetSameSite(sameSite)
+	c.SetCookie(federationStateCookie, state, maxAge, "/auth/federation", "", config.Production || sameSite == http.SameSiteNoneMode, true)
+}
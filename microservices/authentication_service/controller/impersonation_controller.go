@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lets an admin act as another user with a short lived access token
+func (ac *AuthController) Impersonate(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request dtos.ImpersonationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	response, e := ac.AuthService.Impersonate(claims, uint(userID), &request)
+	event := &dtos.AuditEvent{Type: dtos.AuditImpersonationStarted, UserID: uint(userID), ActorID: claims.UserID, Success: e == nil, Details: request.Reason}
+	if e != nil {
+		event.Details = e.Message
+	}
+	ac.audit(c, event)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// lists the impersonation audit log, optionally filtered by actor_id and user_id
+func (ac *AuthController) ListImpersonations(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return
+	}
+
+	actorID, err := strconv.ParseUint(c.DefaultQuery("actor_id", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.DefaultQuery("user_id", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+		return
+	}
+
+	sessions, e := ac.AuthService.ListImpersonationSessions(claims, uint(actorID), uint(userID))
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// grants or removes the admin role, requires the admin api key
+func (ac *AuthController) SetUserRole(c *gin.Context) {
+	if !ac.requireAdminKey(c) {
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request dtos.UserRole
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	e := ac.AuthService.SetUserRole(uint(userID), request.Role)
+	ac.audit(c, &dtos.AuditEvent{Type: dtos.AuditRoleChanged, UserID: uint(userID), Method: "admin_key", Success: e == nil, Details: "role set to " + request.Role})
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// rejects requests made with an impersonation token, used for changes to a user's credentials
+func (ac *AuthController) rejectImpersonation(c *gin.Context, claims *dtos.CustomClaims) bool {
+	if claims.Act != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+		return true
+	}
+	return false
+}
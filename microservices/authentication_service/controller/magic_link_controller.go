@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emails a login link to the user
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	var request dtos.MagicLinkRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if e := ac.AuthService.RequestMagicLink(&request); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	//same response whether or not the email is registered
+	c.JSON(http.StatusAccepted, "If the email is registered a login link has been sent")
+}
+
+// logs the user in from a login link
+func (ac *AuthController) MagicLinkCallback(c *gin.Context) {
+	response, e := ac.AuthService.RedeemMagicLink(c.Query("token"))
+	ac.auditLogin(c, "magic_link", "", response, e)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	//same session as a password login
+	if !ac.setRefreshCookie(c, response.RefreshToken) {
+		return
+	}
+	c.JSON(http.StatusOK, dtos.NewRefreshResponse(response.AccessToken))
+}
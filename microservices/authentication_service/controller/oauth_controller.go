@@ -0,0 +1,84 @@
+package controller
+
+import (
+	conf "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// token endpoint (RFC 6749), supporting the client_credentials and authorization_code grants
+func (ac *AuthController) Token(c *gin.Context) {
+	var request dtos.TokenRequest
+
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, &dtos.OAuthError{
+			Error:            "invalid_request",
+			ErrorDescription: err.Error(),
+		})
+		return
+	}
+
+	//clients may authenticate with http basic auth instead of form fields
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		request.ClientID = id
+		request.ClientSecret = secret
+	}
+
+	response, e := ac.AuthService.Token(&request)
+	if e != nil {
+		ac.oauthError(c, e)
+		return
+	}
+
+	//token responses must never be cached
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// registers a new oauth client, requires the admin api key
+func (ac *AuthController) RegisterClient(c *gin.Context) {
+	if !ac.requireAdminKey(c) {
+		return
+	}
+
+	var request dtos.OAuthClientCreate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	credentials, e := ac.AuthService.RegisterClient(&request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusCreated, credentials)
+}
+
+// writes an error in the format expected by oauth clients
+func (ac *AuthController) oauthError(c *gin.Context, err *e.Error) {
+	c.JSON(err.Code, &dtos.OAuthError{
+		Error:            err.Message,
+		ErrorDescription: err.Details.Error(),
+	})
+}
+
+// ensures the request carries the configured admin api key
+func (ac *AuthController) requireAdminKey(c *gin.Context) bool {
+	key := conf.LoadConfig().AdminApiKey
+	given := c.GetHeader("X-Admin-Key")
+
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(given)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin key is missing or invalid"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	. "authentication-service/service"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// data rendered by the login page
+type loginPage struct {
+	Action     string
+	ClientName string
+	Error      string
+	Email      string
+	CSRFToken  string
+	Params     map[string]string
+}
+
+// authorization endpoint, reuses an existing session or shows the login page
+func (ac *AuthController) Authorize(c *gin.Context) {
+	var request dtos.AuthorizeRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, &dtos.OAuthError{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	clientName, ok := ac.validateAuthorize(c, &request)
+	if !ok {
+		return
+	}
+
+	//skip the login page when the user already has a valid session
+	if request.Prompt != "login" {
+		if refresh, err := c.Cookie("refresh_token"); err == nil {
+			if user, e := ac.AuthService.ValidateRefreshToken(refresh); e == nil {
+				ac.redirectWithCode(c, &request, user.UserID)
+				return
+			}
+		}
+	}
+
+	if request.Prompt == "none" {
+		ac.authorizeErrorRedirect(c, &request, e.NewError(http.StatusUnauthorized, "login_required", fmt.Errorf("user is not logged in")))
+		return
+	}
+
+	ac.renderLogin(c, http.StatusOK, &request, clientName, "", "")
+}
+
+// handles the login form submitted from the authorization endpoint
+func (ac *AuthController) AuthorizeLogin(c *gin.Context) {
+	var request dtos.AuthorizeRequest
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, &dtos.OAuthError{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+
+	clientName, ok := ac.validateAuthorize(c, &request)
+	if !ok {
+		return
+	}
+
+	//the form can't set the header, so the token is submitted as a field
+	if !ac.requireFormCSRF(c) {
+		return
+	}
+
+	var login dtos.UserLogin
+	if err := c.ShouldBind(&login); err != nil {
+		ac.renderLogin(c, http.StatusBadRequest, &request, clientName, login.Email, "Please enter a valid email and password")
+		return
+	}
+
+	//login through the same path as the json api so the session is shared
+	response, e := ac.AuthService.UserLogin(&login)
+	ac.auditLogin(c, "password", login.Email, response, e)
+	if e != nil {
+		//never reveal whether the email or the password was wrong
+		ac.renderLogin(c, http.StatusUnauthorized, &request, clientName, login.Email, "Invalid email or password")
+		return
+	}
+	if !ac.setRefreshCookie(c, response.RefreshToken) {
+		return
+	}
+
+	claims, err := ac.AuthService.ParseJWT(&response.AccessToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &dtos.OAuthError{Error: "server_error", ErrorDescription: err.Error()})
+		return
+	}
+
+	ac.redirectWithCode(c, &request, claims.UserID)
+}
+
+// returns claims about the user the bearer token was issued for
+func (ac *AuthController) UserInfo(c *gin.Context) {
+	token, err := ac.ExtractAuthorization(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, &dtos.OAuthError{Error: "invalid_token", ErrorDescription: err.Error()})
+		return
+	}
+	claims, err := ac.AuthService.ParseAccessToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, &dtos.OAuthError{Error: "invalid_token", ErrorDescription: err.Error()})
+		return
+	}
+
+	info, e := ac.AuthService.UserInfo(claims)
+	if e != nil {
+		ac.oauthError(c, e)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// openid connect discovery document
+func (ac *AuthController) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, ac.AuthService.Discovery())
+}
+
+// public keys used to verify id tokens
+func (ac *AuthController) JWKS(c *gin.Context) {
+	jwks, err := ac.AuthService.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, jwks)
+}
+
+// ---------- HELPER FUNCTIONS FOR THE AUTHORIZATION ENDPOINT -----------------------
+
+// validates an authentication request, writing the error response when it is invalid
+func (ac *AuthController) validateAuthorize(c *gin.Context, request *dtos.AuthorizeRequest) (string, bool) {
+	client, e := ac.AuthService.ValidateAuthorizeRequest(request)
+	if e != nil {
+		//the redirect uri can't be trusted so the error is shown to the user instead
+		ac.oauthError(c, e)
+		return "", false
+	}
+
+	if e := ac.AuthService.ValidateAuthorizeParams(client, request); e != nil {
+		ac.authorizeErrorRedirect(c, request, e)
+		return "", false
+	}
+
+	return client.Name, true
+}
+
+// issues a code for the user and redirects back to the client
+func (ac *AuthController) redirectWithCode(c *gin.Context, request *dtos.AuthorizeRequest, userID uint) {
+	location, e := ac.AuthService.IssueAuthorizationCode(request, userID, time.Now())
+	if e != nil {
+		ac.authorizeErrorRedirect(c, request, e)
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+// sends an error back to the client through its redirect uri
+func (ac *AuthController) authorizeErrorRedirect(c *gin.Context, request *dtos.AuthorizeRequest, err *e.Error) {
+	location, e := AuthorizeRedirectURL(request, url.Values{
+		"error":             {err.Message},
+		"error_description": {err.Details.Error()},
+	})
+	if e != nil {
+		ac.oauthError(c, e)
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+// renders the login page, carrying the authentication request through hidden fields
+func (ac *AuthController) renderLogin(c *gin.Context, status int, request *dtos.AuthorizeRequest, clientName, email, message string) {
+	csrfToken, ok := ac.setCSRFCookie(c)
+	if !ok {
+		return
+	}
+
+	page := loginPage{
+		Action:     "/auth/oauth/authorize",
+		ClientName: clientName,
+		Error:      message,
+		Email:      email,
+		CSRFToken:  csrfToken,
+		Params: map[string]string{
+			"response_type":         request.ResponseType,
+			"client_id":             request.ClientID,
+			"redirect_uri":          request.RedirectURI,
+			"scope":                 request.Scope,
+			"state":                 request.State,
+			"nonce":                 request.Nonce,
+			"code_challenge":        request.CodeChallenge,
+			"code_challenge_method": request.CodeChallengeMethod,
+		},
+	}
+
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(c.Writer, "login.html", page); err != nil {
+		c.Error(err)
+	}
+}
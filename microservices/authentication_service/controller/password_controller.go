@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// changes the authenticated user's password, other sessions are signed out
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil || ac.rejectImpersonation(c, claims) {
+		return
+	}
+
+	var request dtos.PasswordChange
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	//the refresh cookie identifies the session to keep, without it every session is revoked
+	refresh, _ := c.Cookie("refresh_token")
+
+	e := ac.AuthService.ChangePassword(claims.UserID, &request, refresh)
+	ac.auditUser(c, dtos.AuditPasswordChanged, claims, e, "")
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+	ac.auditUser(c, dtos.AuditTokensRevoked, claims, nil, "other sessions revoked after password change")
+
+	c.Status(http.StatusNoContent)
+}
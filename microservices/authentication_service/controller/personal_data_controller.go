@@ -0,0 +1,45 @@
+package controller
+
+import (
+	. "authentication-service/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// returns everything stored about a user, called by the user service for data export requests
+func (ac *AuthController) ExportUserData(c *gin.Context) {
+	if !ac.requireServiceScope(c, ScopePersonalData) {
+		return
+	}
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	data, e := ac.AuthService.ExportUserData(userID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// revokes a user's sessions and erases their data, called by the user service for erasure requests
+func (ac *AuthController) EraseUserData(c *gin.Context) {
+	if !ac.requireServiceScope(c, ScopePersonalData) {
+		return
+	}
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	if e := ac.AuthService.EraseUserData(userID); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"authentication-service/dtos"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// header carrying the session id returned when a ceremony was started
+const webAuthnSessionHeader = "X-WebAuthn-Session"
+
+// starts registering a passkey for the authenticated user
+func (ac *AuthController) BeginPasskeyRegistration(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil || ac.rejectImpersonation(c, claims) {
+		return
+	}
+
+	var request dtos.WebAuthnRegistrationStart
+	if err := c.ShouldBindJSON(&request); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ceremony, e := ac.AuthService.BeginPasskeyRegistration(claims.UserID, &request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// finishes registering a passkey with the authenticator's response as the body
+func (ac *AuthController) FinishPasskeyRegistration(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return
+	}
+
+	response, err := protocol.ParseCredentialCreationResponse(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid credential",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	credential, e := ac.AuthService.FinishPasskeyRegistration(claims.UserID, c.GetHeader(webAuthnSessionHeader), response)
+	if e != nil {
+		ac.auditUser(c, dtos.AuditPasskeyRegistered, claims, e, "")
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	ac.auditUser(c, dtos.AuditPasskeyRegistered, claims, nil, credential.Name)
+	c.JSON(http.StatusCreated, credential)
+}
+
+// starts a passkey login
+func (ac *AuthController) BeginPasskeyLogin(c *gin.Context) {
+	var request dtos.WebAuthnLoginStart
+	if err := c.ShouldBindJSON(&request); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ceremony, e := ac.AuthService.BeginPasskeyLogin(&request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// finishes a passkey login with the authenticator's response as the body
+func (ac *AuthController) FinishPasskeyLogin(c *gin.Context) {
+	response, err := protocol.ParseCredentialRequestResponse(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid credential",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	login, e := ac.AuthService.FinishPasskeyLogin(c.GetHeader(webAuthnSessionHeader), response)
+	ac.auditLogin(c, "passkey", "", login, e)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	//same session as a password login
+	if !ac.setRefreshCookie(c, login.RefreshToken) {
+		return
+	}
+	c.JSON(http.StatusOK, dtos.NewRefreshResponse(login.AccessToken))
+}
+
+// lists the authenticated user's passkeys
+func (ac *AuthController) ListPasskeys(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil {
+		return
+	}
+
+	credentials, e := ac.AuthService.ListPasskeys(claims.UserID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// removes one of the authenticated user's passkeys
+func (ac *AuthController) DeletePasskey(c *gin.Context) {
+	claims, err := ac.GetClaims(c)
+	if err != nil || ac.rejectImpersonation(c, claims) {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	e := ac.AuthService.DeletePasskey(claims.UserID, uint(id))
+	ac.auditUser(c, dtos.AuditPasskeyRemoved, claims, e, fmt.Sprintf("passkey %d", id))
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
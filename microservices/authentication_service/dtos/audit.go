@@ -0,0 +1,52 @@
+package dtos
+
+import "time"
+
+// types of security events recorded in the audit log
+const (
+	AuditLoginSucceeded       = "login.succeeded"
+	AuditLoginFailed          = "login.failed"
+	AuditTokenRefreshed       = "token.refreshed"
+	AuditLogout               = "logout"
+	AuditPasswordChanged      = "password.changed"
+	AuditPasskeyRegistered    = "mfa.passkey_registered"
+	AuditPasskeyRemoved       = "mfa.passkey_removed"
+	AuditIdentityLinked       = "identity.linked"
+	AuditIdentityUnlinked     = "identity.unlinked"
+	AuditTokensRevoked        = "token.revoked"
+	AuditImpersonationStarted = "impersonation.started"
+	AuditRoleChanged          = "role.changed"
+	AuditStatusChanged        = "status.changed"
+	AuditUserErased           = "user.erased"
+)
+
+type AuditEvent struct {
+	ID        uint      `json:"id"`
+	Type      string    `json:"type"`
+	UserID    uint      `json:"user_id,omitempty"`
+	ActorID   uint      `json:"actor_id,omitempty"` // admin acting for the user when impersonating
+	Email     string    `json:"email,omitempty"`
+	Success   bool      `json:"success"`
+	Method    string    `json:"method,omitempty"` // how the user authenticated, such as password or passkey
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuditEventQuery struct {
+	UserID   uint      `form:"user_id"`
+	Type     string    `form:"type"`
+	Since    time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until    time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page     int       `form:"page,default=1" binding:"min=1"`
+	PageSize int       `form:"page_size,default=50" binding:"min=1,max=500"`
+}
+
+type AuditEventPage struct {
+	Events   []*AuditEvent `json:"events"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int64         `json:"total"`
+}
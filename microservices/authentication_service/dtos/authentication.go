@@ -1,8 +1,8 @@
 package dtos
 
 type UserLogin struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" form:"email" binding:"required,email"`
+	Password string `json:"password" form:"password" binding:"required"`
 }
 
 type UserLoginResponse struct {
@@ -26,3 +26,12 @@ func NewRefreshResponse(accessToken string) *RefreshResponse {
 		AccessToken: accessToken,
 	}
 }
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
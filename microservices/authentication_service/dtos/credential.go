@@ -0,0 +1,16 @@
+package dtos
+
+// CredentialUpsert is sent by the user service when a user is created or their email or password changes
+type CredentialUpsert struct {
+	Email string `json:"email" binding:"required,email"`
+	//only used to check the password doesn't contain the user's name
+	Name string `json:"name"`
+	//left empty to keep the current password
+	Password string `json:"password"`
+}
+
+// CredentialStatus is sent by the user service when a user is suspended, deactivated or reactivated
+type CredentialStatus struct {
+	Status string `json:"status" binding:"required,oneof=active suspended deactivated"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,24 @@
+package dtos
+
+import "time"
+
+// an external identity linked to a user
+type LinkedIdentity struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// url the user should be sent to in order to authenticate with an external provider
+type FederationRedirect struct {
+	AuthorizationURL string `json:"authorization_url"`
+	//bound to the browser through a cookie, so the callback can only complete the login where it started
+	State string `json:"-"`
+}
+
+// outcome of an external provider callback, either a new session or a newly linked identity
+type FederationResult struct {
+	Login    *UserLoginResponse
+	Identity *LinkedIdentity
+	UserID   uint // user the identity was linked to
+}
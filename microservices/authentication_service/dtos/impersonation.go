@@ -0,0 +1,22 @@
+package dtos
+
+import "time"
+
+type ImpersonationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ImpersonationResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	SessionID   uint      `json:"session_id"`
+}
+
+type ImpersonationSession struct {
+	ID           uint      `json:"id"`
+	ActorID      uint      `json:"actor_id"`
+	TargetUserID uint      `json:"target_user_id"`
+	Reason       string    `json:"reason"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
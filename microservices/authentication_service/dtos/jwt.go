@@ -5,7 +5,18 @@ import (
 )
 
 type CustomClaims struct {
-	UserID uint   `json:"userID"`
-	Email  string `json:"email"`
+	UserID   uint   `json:"userID"`
+	Email    string `json:"email"`
+	ClientID string `json:"client_id,omitempty"` // set when the token was issued to a service client
+	Scope    string `json:"scope,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Act      *Actor `json:"act,omitempty"` // set when an admin is impersonating the user
 	jwt.RegisteredClaims
 }
+
+// Actor is the party really acting on behalf of the token's subject (RFC 8693 act claim)
+type Actor struct {
+	Subject string `json:"sub"`
+	UserID  uint   `json:"userID"`
+	Email   string `json:"email"`
+}
@@ -0,0 +1,69 @@
+package dtos
+
+// request used to register a new oauth client
+type OAuthClientCreate struct {
+	Name     string   `json:"name" binding:"required"`
+	Scopes   []string `json:"scopes"`
+	Audience string   `json:"audience" binding:"required"`
+	// only needed for clients using the authorization code flow
+	RedirectURIs []string `json:"redirect_uris" binding:"dive,url"`
+	FirstParty   bool     `json:"first_party"`
+	Public       bool     `json:"public"`
+}
+
+// credentials returned once when a client is registered, the secret is never shown again
+type OAuthClientCredentials struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	Audience     string   `json:"audience"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+}
+
+func NewOAuthClientCredentials(clientID, clientSecret, name string, scopes []string, audience string, redirectURIs []string) *OAuthClientCredentials {
+	return &OAuthClientCredentials{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Name:         name,
+		Scopes:       scopes,
+		Audience:     audience,
+		RedirectURIs: redirectURIs,
+	}
+}
+
+// token request as defined by RFC 6749, sent as a form
+type TokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+	// used by the authorization_code grant
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+// token response as defined by RFC 6749
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+func NewTokenResponse(accessToken string, expiresIn int64, scope string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Scope:       scope,
+	}
+}
+
+// error response as defined by RFC 6749
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
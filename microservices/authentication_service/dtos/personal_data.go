@@ -0,0 +1,33 @@
+package dtos
+
+import "time"
+
+// PersonalData is everything the auth service keeps about a user, exported when they ask for their data
+type PersonalData struct {
+	UserID uint `json:"user_id"`
+	//nil for users who don't have a credential anymore, such as deleted users
+	Credential       *CredentialData         `json:"credential"`
+	Sessions         []*Session              `json:"sessions"`
+	LinkedIdentities []*LinkedIdentity       `json:"linked_identities"`
+	Passkeys         []*WebAuthnCredential   `json:"passkeys"`
+	Impersonations   []*ImpersonationSession `json:"impersonations"`
+	AuditEvents      []*AuditEvent           `json:"audit_events"`
+}
+
+// a credential without its password hash
+type CredentialData struct {
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Status      string    `json:"status"`
+	HasPassword bool      `json:"has_password"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// a refresh token, without the token
+type Session struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+}
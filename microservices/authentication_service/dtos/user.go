@@ -10,6 +10,11 @@ type User struct {
 	Id    uint   `json:"id"`
 	Name  string `json:"name" binding:"required"`
 	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role,omitempty"`
+}
+
+type UserRole struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
 }
 
 func NewUser(id uint, name, email string) *User {
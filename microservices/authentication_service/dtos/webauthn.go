@@ -0,0 +1,27 @@
+package dtos
+
+import "time"
+
+// a registered passkey, without any key material
+type WebAuthnCredential struct {
+	ID           uint       `json:"id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+type WebAuthnRegistrationStart struct {
+	Name string `json:"name"`
+}
+
+type WebAuthnLoginStart struct {
+	// optional, passkeys stored on the authenticator are used when no email is given
+	Email string `json:"email" binding:"omitempty,email"`
+}
+
+// options passed to navigator.credentials, along with the session to send back when finishing
+type WebAuthnCeremony struct {
+	SessionID string      `json:"session_id"`
+	Options   interface{} `json:"options"`
+}
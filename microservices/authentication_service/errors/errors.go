@@ -2,6 +2,9 @@ package errors
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -16,12 +19,15 @@ type Error struct {
 	Code    int
 	Message string
 	Details error
+	//problems with individual request fields, keyed by field name
+	Fields map[string][]string
 }
 
 type ErrorDTO struct {
 	Code    int
 	Message string
 	Details string
+	Fields  map[string][]string `json:",omitempty"`
 }
 
 func NewError(code int, message string, details error) *Error {
@@ -32,6 +38,21 @@ func NewError(code int, message string, details error) *Error {
 	}
 }
 
+// creates a bad request error listing the problems with each field
+func NewValidationError(message string, fields map[string][]string) *Error {
+	var problems []string
+	for field, messages := range fields {
+		problems = append(problems, fmt.Sprintf("%s %s", field, strings.Join(messages, ", ")))
+	}
+
+	return &Error{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Details: fmt.Errorf("%w: %s", ErrInvalidUserData, strings.Join(problems, "; ")),
+		Fields:  fields,
+	}
+}
+
 func (e Error) Error() string {
 	return e.Details.Error()
 }
@@ -41,5 +62,6 @@ func (e Error) ToJson() *ErrorDTO {
 		Code:    e.Code,
 		Message: e.Message,
 		Details: e.Details.Error(),
+		Fields:  e.Fields,
 	}
 }
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"authentication-service/config"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Broker carries encoded events between services
+type Broker interface {
+	Publish(subject string, data []byte) error
+	//subscribers sharing a queue each receive a share of the messages, an empty queue receives all of them
+	Subscribe(subject, queue string, handler func(data []byte)) (unsubscribe func() error, err error)
+}
+
+// picks the broker configured by EVENT_BROKER, either nats or memory
+func NewBroker(conf *config.Config) (Broker, error) {
+	switch conf.EventBroker {
+	case "nats":
+		return NewNATSBroker(conf.NATSURL)
+	case "memory", "":
+		return NewMemoryBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", conf.EventBroker)
+	}
+}
+
+// MemoryBroker delivers messages synchronously within the process, meant for tests and local development
+type MemoryBroker struct {
+	mu            sync.Mutex
+	subscriptions map[string][]*memorySubscription
+	//round robin position of each queue group
+	next map[string]int
+}
+
+type memorySubscription struct {
+	queue   string
+	handler func(data []byte)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscriptions: map[string][]*memorySubscription{}, next: map[string]int{}}
+}
+
+func (b *MemoryBroker) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	var handlers []func(data []byte)
+	groups := map[string][]*memorySubscription{}
+	for _, sub := range b.subscriptions[subject] {
+		if sub.queue == "" {
+			handlers = append(handlers, sub.handler)
+		} else {
+			groups[sub.queue] = append(groups[sub.queue], sub)
+		}
+	}
+	for queue, members := range groups {
+		key := subject + "/" + queue
+		handlers = append(handlers, members[b.next[key]%len(members)].handler)
+		b.next[key]++
+	}
+	b.mu.Unlock()
+
+	//handlers run without the lock so they can publish themselves
+	for _, handler := range handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(subject, queue string, handler func(data []byte)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &memorySubscription{queue: queue, handler: handler}
+	b.subscriptions[subject] = append(b.subscriptions[subject], sub)
+
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		subs := b.subscriptions[subject]
+		for i := range subs {
+			if subs[i] == sub {
+				b.subscriptions[subject] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}, nil
+}
+
+// NATSBroker publishes events through a nats server
+type NATSBroker struct {
+	conn *nats.Conn
+}
+
+func NewNATSBroker(url string) (*NATSBroker, error) {
+	conn, err := nats.Connect(url, nats.Name("auth-service"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return &NATSBroker{conn: conn}, nil
+}
+
+func (b *NATSBroker) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+func (b *NATSBroker) Subscribe(subject, queue string, handler func(data []byte)) (func() error, error) {
+	sub, err := b.conn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub.Unsubscribe, nil
+}
+
+func (b *NATSBroker) Close() {
+	b.conn.Close()
+}
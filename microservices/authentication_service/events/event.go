@@ -0,0 +1,61 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// types of the events published about users, also used as the broker subject
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+	//deleted users can be restored until they're purged
+	UserRestored = "user.restored"
+	UserPurged   = "user.purged"
+	//published when a user is suspended, deactivated or reactivated
+	UserStatusChanged = "user.status_changed"
+	//published once a user's personal data was erased, consumers should remove or anonymize their copies
+	UserErased = "user.erased"
+)
+
+// Event is the envelope every domain event is published in
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID uint            `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// UserData is the payload of user events, deleted events only carry the id
+type UserData struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	//active, suspended or deactivated
+	Status string `json:"status,omitempty"`
+}
+
+// creates an event with a random id, marshalling data as its payload
+func NewEvent(eventType string, aggregateID uint, data interface{}) (*Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		ID:          hex.EncodeToString(id),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		OccurredAt:  time.Now().UTC(),
+		Data:        payload,
+	}, nil
+}
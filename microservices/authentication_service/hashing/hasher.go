@@ -0,0 +1,62 @@
+package hashing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// names of the supported algorithms, as used in configuration
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("hash uses an unknown algorithm")
+	ErrInvalidHash      = errors.New("hash is malformed")
+	ErrPasswordTooLong  = errors.New("password is too long for the hashing algorithm")
+)
+
+// PasswordHasher hashes passwords into self describing strings
+type PasswordHasher interface {
+	//hashes a password with a new random salt
+	Hash(password string) (string, error)
+	//checks a password against a hash made by any supported algorithm
+	Verify(password, encoded string) (bool, error)
+	//reports whether a hash was made with another algorithm or weaker parameters than this hasher uses
+	NeedsRehash(encoded string) bool
+}
+
+// creates the hasher for a configured algorithm
+func NewPasswordHasher(algorithm string, argon2id *Argon2idHasher, bcryptCost int) (PasswordHasher, error) {
+	switch strings.ToLower(algorithm) {
+	case AlgorithmArgon2id:
+		return argon2id, nil
+	case AlgorithmBcrypt:
+		return NewBcryptHasher(bcryptCost), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+}
+
+// checks a password against a hash, picking the algorithm from the hash itself
+func Verify(password, encoded string) (bool, error) {
+	switch identify(encoded) {
+	case AlgorithmArgon2id:
+		return verifyArgon2id(password, encoded)
+	case AlgorithmBcrypt:
+		return verifyBcrypt(password, encoded)
+	}
+	return false, ErrUnknownAlgorithm
+}
+
+// returns the algorithm a hash was made with, or an empty string if it isn't recognised
+func identify(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	}
+	return ""
+}
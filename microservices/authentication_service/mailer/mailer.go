@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"authentication-service/config"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails to users
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// picks the smtp mailer when a host is configured, otherwise emails are only logged
+func NewMailer(conf *config.Config) Mailer {
+	if conf.SMTPHost == "" {
+		return LogMailer{}
+	}
+
+	return SMTPMailer{
+		Host:     conf.SMTPHost,
+		Port:     conf.SMTPPort,
+		Username: conf.SMTPUsername,
+		Password: conf.SMTPPassword,
+		From:     conf.MailFrom,
+	}
+}
+
+// LogMailer writes emails to the log instead of sending them, meant for local development
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SMTPMailer sends emails through an smtp server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	//headers can't contain new lines or a recipient could inject their own
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(message))
+}
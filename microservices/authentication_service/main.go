@@ -1,7 +1,9 @@
 package main
 
 import (
+	"authentication-service/config"
 	"authentication-service/controller"
+	"authentication-service/events"
 	s "authentication-service/service"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +15,15 @@ func main() {
 	// Create service with repository
 	userService := s.NewAuthService(nil)
 
+	// React to users being deleted in the user service
+	broker, err := events.NewBroker(config.LoadConfig())
+	if err != nil {
+		panic("failed to connect to event broker: " + err.Error())
+	}
+	if err := userService.SubscribeUserEvents(broker); err != nil {
+		panic("failed to subscribe to user events: " + err.Error())
+	}
+
 	// Create controller with service
 	userController := controller.NewAuthController(userService)
 	userController.DefineRoutes(r)
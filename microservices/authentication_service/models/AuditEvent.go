@@ -0,0 +1,66 @@
+package models
+
+import (
+	"authentication-service/dtos"
+	"strings"
+	"time"
+)
+
+// AuditEvent is an append only record of a security relevant action
+type AuditEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	Type      string `gorm:"not null;index;size:64"`
+	UserID    uint   `gorm:"index"` // zero when the user isn't known, such as a failed login for an unknown email
+	ActorID   uint
+	Email     string `gorm:"size:255"`
+	Success   bool   `gorm:"not null"`
+	Method    string `gorm:"size:32"`
+	Details   string
+	IP        string    `gorm:"size:64"`
+	UserAgent string    `gorm:"size:512"`
+	RequestID string    `gorm:"index;size:64"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+// fields are cut to their column sizes, otherwise a client sending an overlong value such as its user agent could
+// make the insert fail and keep its actions out of the log
+func NewAuditEvent(event *dtos.AuditEvent) *AuditEvent {
+	return &AuditEvent{
+		Type:      truncate(event.Type, 64),
+		UserID:    event.UserID,
+		ActorID:   event.ActorID,
+		Email:     truncate(event.Email, 255),
+		Success:   event.Success,
+		Method:    truncate(event.Method, 32),
+		Details:   strings.ToValidUTF8(event.Details, "\uFFFD"),
+		IP:        truncate(event.IP, 64),
+		UserAgent: truncate(event.UserAgent, 512),
+		RequestID: truncate(event.RequestID, 64),
+	}
+}
+
+// cuts s to at most n characters, replacing invalid utf-8 which strict databases would reject as well
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+func (a *AuditEvent) ToDTO() *dtos.AuditEvent {
+	return &dtos.AuditEvent{
+		ID:        a.ID,
+		Type:      a.Type,
+		UserID:    a.UserID,
+		ActorID:   a.ActorID,
+		Email:     a.Email,
+		Success:   a.Success,
+		Method:    a.Method,
+		Details:   a.Details,
+		IP:        a.IP,
+		UserAgent: a.UserAgent,
+		RequestID: a.RequestID,
+		CreatedAt: a.CreatedAt,
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"authentication-service/dtos"
 	"time"
 )
 
@@ -13,3 +14,12 @@ type RefreshToken struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime"` // Automatically set on insert and update
 	Revoked   bool      `gorm:"not null;default:false"`
 }
+
+func (t *RefreshToken) ToSessionDTO() *dtos.Session {
+	return &dtos.Session{
+		ID:        t.ID,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		Revoked:   t.Revoked,
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuthorizationCode is a single use code issued by the authorization endpoint
+type AuthorizationCode struct {
+	ID                  uint   `gorm:"primaryKey"`
+	CodeHash            string `gorm:"not null;uniqueIndex;size:64"`
+	ClientID            string `gorm:"not null;index;size:64"`
+	UserID              uint   `gorm:"not null"`
+	RedirectURI         string `gorm:"not null"`
+	Scope               string
+	Nonce               string
+	CodeChallenge       string    `gorm:"not null"`
+	CodeChallengeMethod string    `gorm:"not null"`
+	AuthTime            time.Time `gorm:"not null"`
+	ExpiresAt           time.Time `gorm:"not null"`
+	Used                bool      `gorm:"not null;default:false"`
+	CreatedAt           time.Time `gorm:"autoCreateTime"`
+}
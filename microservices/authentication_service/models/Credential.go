@@ -0,0 +1,70 @@
+package models
+
+import (
+	"authentication-service/dtos"
+	"strings"
+	"time"
+)
+
+// Credential is what the auth service stores about a user, profile data such as the name is owned by the user service
+type Credential struct {
+	//id of the user in the user service
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Email        string `gorm:"unique"` // stored normalized, so lookups don't depend on the database's collation
+	PasswordHash string
+	//RoleAdmin grants access to support tools such as impersonation
+	Role string `gorm:"not null;default:user"`
+	//mirrors the user's status in the user service, only active users can get tokens
+	Status    string `gorm:"not null;default:active;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// roles a user can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// statuses a user can have
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusDeactivated = "deactivated"
+)
+
+func NewCredential(userID uint, email, passwordHash string) *Credential {
+	return &Credential{
+		UserID:       userID,
+		Email:        NormalizeEmail(email),
+		PasswordHash: passwordHash,
+		Role:         RoleUser,
+		Status:       StatusActive,
+	}
+}
+
+// emails are compared case insensitively, they're lowercased before they're stored or looked up
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// converts the credential to what's exported of it, leaving out the password hash
+func (c *Credential) ToDataDTO() *dtos.CredentialData {
+	return &dtos.CredentialData{
+		Email:       c.Email,
+		Role:        c.Role,
+		Status:      c.Status,
+		HasPassword: c.PasswordHash != "",
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+}
+
+// converts the credential to a user dto, the name is left empty since it isn't stored here
+func (c *Credential) ToUserDTO() *dtos.User {
+	return &dtos.User{
+		Id:    c.UserID,
+		Email: c.Email,
+		Role:  c.Role,
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"authentication-service/dtos"
+	"time"
+)
+
+// ImpersonationSession is the audit record of an admin acting as another user
+type ImpersonationSession struct {
+	ID           uint      `gorm:"primaryKey"`
+	ActorID      uint      `gorm:"not null;index"`
+	TargetUserID uint      `gorm:"not null;index"`
+	Reason       string    `gorm:"not null"`
+	TokenID      string    `gorm:"not null;uniqueIndex;size:64"` // jti of the issued access token
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (s *ImpersonationSession) ToDTO() *dtos.ImpersonationSession {
+	return &dtos.ImpersonationSession{
+		ID:           s.ID,
+		ActorID:      s.ActorID,
+		TargetUserID: s.TargetUserID,
+		Reason:       s.Reason,
+		ExpiresAt:    s.ExpiresAt,
+		CreatedAt:    s.CreatedAt,
+	}
+}
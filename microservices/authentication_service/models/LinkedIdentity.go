@@ -0,0 +1,45 @@
+package models
+
+import (
+	"authentication-service/dtos"
+	"time"
+)
+
+// LinkedIdentity maps a subject at an external identity provider to a local user
+type LinkedIdentity struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_provider"`
+	Provider  string    `gorm:"not null;size:64;uniqueIndex:idx_provider_subject;uniqueIndex:idx_user_provider"`
+	Subject   string    `gorm:"not null;size:255;uniqueIndex:idx_provider_subject"`
+	Email     string    // email reported by the provider when the identity was linked
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func NewLinkedIdentity(userID uint, provider, subject, email string) *LinkedIdentity {
+	return &LinkedIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}
+}
+
+func (i *LinkedIdentity) ToDTO() *dtos.LinkedIdentity {
+	return &dtos.LinkedIdentity{
+		Provider: i.Provider,
+		Email:    i.Email,
+		LinkedAt: i.CreatedAt,
+	}
+}
+
+// FederationState tracks a login started with an external provider until its callback
+type FederationState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"not null;uniqueIndex;size:64"`
+	Provider     string    `gorm:"not null;size:64"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	LinkUserID   uint      // set when the login links an identity to an existing user
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
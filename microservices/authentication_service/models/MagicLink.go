@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MagicLink is a single use login link emailed to a user
+type MagicLink struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;index"`
+	TokenHash string     `gorm:"not null;uniqueIndex;size:64"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set once the link has been used to log in
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
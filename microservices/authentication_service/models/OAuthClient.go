@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is a registered service identity allowed to request tokens
+type OAuthClient struct {
+	ID           uint   `gorm:"primaryKey"`
+	ClientID     string `gorm:"not null;uniqueIndex;size:64"`
+	SecretHash   string `gorm:"not null"`
+	Name         string
+	Scopes       string    // space separated list of scopes the client may request
+	Audience     string    `gorm:"not null"`
+	RedirectURIs string    // space separated list of redirect uris allowed for the authorization code flow
+	FirstParty   bool      `gorm:"not null;default:false"` // first party clients are not asked for consent
+	Public       bool      `gorm:"not null;default:false"` // public clients cannot keep a secret and rely on PKCE
+	Revoked      bool      `gorm:"not null;default:false"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func NewOAuthClient(clientID, secretHash, name string, scopes []string, audience string) *OAuthClient {
+	return &OAuthClient{
+		ClientID:   clientID,
+		SecretHash: secretHash,
+		Name:       name,
+		Scopes:     strings.Join(scopes, " "),
+		Audience:   audience,
+	}
+}
+
+// returns the scopes the client is allowed to request
+func (c *OAuthClient) AllowedScopes() []string {
+	return strings.Fields(c.Scopes)
+}
+
+// returns the redirect uris registered for the client
+func (c *OAuthClient) AllowedRedirectURIs() []string {
+	return strings.Fields(c.RedirectURIs)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"authentication-service/dtos"
+	"encoding/base64"
+	"time"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID           uint       `gorm:"primaryKey"`
+	UserID       uint       `gorm:"not null;index"`
+	CredentialID []byte     `gorm:"not null;uniqueIndex;size:255"`
+	Name         string     `gorm:"not null"`
+	Data         string     `gorm:"type:text;not null"` // json encoded credential record, including the public key
+	LastUsedAt   *time.Time // set whenever the credential is used to log in
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime"`
+}
+
+func (c *WebAuthnCredential) ToDTO() *dtos.WebAuthnCredential {
+	return &dtos.WebAuthnCredential{
+		ID:           c.ID,
+		Name:         c.Name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(c.CredentialID),
+		CreatedAt:    c.CreatedAt,
+		LastUsedAt:   c.LastUsedAt,
+	}
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony until it's finished
+type WebAuthnSession struct {
+	ID             uint      `gorm:"primaryKey"`
+	SessionHash    string    `gorm:"not null;uniqueIndex;size:64"`
+	Purpose        string    `gorm:"not null;size:32"`
+	UserID         uint      // zero for logins where the user is identified by the passkey
+	CredentialName string    // name given to a credential being registered
+	Data           string    `gorm:"type:text;not null"` // json encoded ceremony session data
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
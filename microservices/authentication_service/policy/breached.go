@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+)
+
+// BreachChecker reports whether a password is known to have been breached
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// length of the sha1 prefix used to bucket hashes, the same as the pwned passwords range api
+const prefixLength = 5
+
+// FileBreachChecker looks passwords up in a local list of sha1 hashes in the pwned passwords
+// format, one HASH:COUNT per line. Hashes are bucketed by prefix like the k-anonymity range api,
+// so a lookup only compares against the suffixes sharing the password hash's prefix.
+type FileBreachChecker struct {
+	Path string
+
+	once    sync.Once
+	err     error
+	buckets map[string]map[string]struct{}
+}
+
+// creates a checker for a hash list file, returns nil when no file is configured
+func NewFileBreachChecker(path string) BreachChecker {
+	if path == "" {
+		return nil
+	}
+	return &FileBreachChecker{Path: path}
+}
+
+func (c *FileBreachChecker) Breached(password string) (bool, error) {
+	//the list is loaded on first use
+	c.once.Do(c.load)
+	if c.err != nil {
+		return false, c.err
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := c.buckets[hash[:prefixLength]][hash[prefixLength:]]
+	return found, nil
+}
+
+func (c *FileBreachChecker) load() {
+	file, err := os.Open(c.Path)
+	if err != nil {
+		c.err = err
+		return
+	}
+	defer file.Close()
+
+	c.buckets = make(map[string]map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != 2*sha1.Size {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+
+		bucket, ok := c.buckets[hash[:prefixLength]]
+		if !ok {
+			bucket = make(map[string]struct{})
+			c.buckets[hash[:prefixLength]] = bucket
+		}
+		bucket[hash[prefixLength:]] = struct{}{}
+	}
+	c.err = scanner.Err()
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Policy describes the rules a new password has to follow
+type Policy struct {
+	MinLength int
+	//longer passwords are rejected so hashing them can't be used to exhaust the service
+	MaxLength int
+	//number of character classes (lowercase, uppercase, digits, symbols) a password must mix
+	MinCharacterClasses int
+	//longest run of a single repeated character, 0 allows any
+	MaxRepeats int
+	//rejects passwords containing the user's email or name
+	DisallowPersonalInfo bool
+	//rejects passwords found in known breaches, nil skips the check
+	Breached BreachChecker
+}
+
+// details of the user a password is being set for
+type User struct {
+	Name  string
+	Email string
+}
+
+// checks a password against the policy, returning every rule it breaks
+func (p *Policy) Validate(password string, user User) ([]string, error) {
+	var violations []string
+	length := len([]rune(password))
+
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+	if classes := characterClasses(password); classes < p.MinCharacterClasses {
+		violations = append(violations, fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+	if p.MaxRepeats > 0 && longestRun(password) > p.MaxRepeats {
+		violations = append(violations, fmt.Sprintf("must not repeat a character more than %d times in a row", p.MaxRepeats))
+	}
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, user) {
+		violations = append(violations, "must not contain your name or email")
+	}
+
+	//only worth looking up passwords that are otherwise acceptable
+	if len(violations) == 0 && p.Breached != nil {
+		breached, err := p.Breached.Breached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach, choose a different password")
+		}
+	}
+
+	return violations, nil
+}
+
+// counts the character classes used in a password
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// length of the longest run of one repeated character
+func longestRun(password string) int {
+	longest, run := 0, 0
+	var previous rune
+	for i, r := range []rune(password) {
+		if i > 0 && r == previous {
+			run++
+		} else {
+			run = 1
+		}
+		previous = r
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// whether the password contains the email's local part or any part of the name
+func containsPersonalInfo(password string, user User) bool {
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(user.Name))
+	if local, _, ok := strings.Cut(strings.ToLower(user.Email), "@"); ok {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		//very short parts would reject too many unrelated passwords
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
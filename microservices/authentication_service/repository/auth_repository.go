@@ -2,14 +2,56 @@ package repository
 
 import (
 	. "authentication-service/models"
+	"time"
 )
 
-// UserRepository defines the interface for user data operations
+// AuditEventFilter narrows down audit event queries, zero values match everything
+type AuditEventFilter struct {
+	UserID uint
+	Type   string
+	Since  time.Time
+	Until  time.Time
+}
+
+// AuthRepository defines the interface for credential, token and session data operations
 type AuthRepository interface {
-	FindUserByID(id uint) (*User, error)
-	FindUserByEmail(email string) (*User, error)
-	UserExistsByEmail(email string) (bool, error)
+	FindCredentialByUserID(userID uint) (*Credential, error)
+	FindCredentialByEmail(email string) (*Credential, error)
+	CredentialExistsByEmail(email string) (bool, error)
+	CreateCredential(credential *Credential) error
+	SaveCredential(credential *Credential) error
+	UpdateCredentialPassword(userID uint, passwordHash string) error
+	UpdateCredentialRole(userID uint, role string) error
+	UpdateCredentialStatus(userID uint, status string) error
+	DeleteCredential(userID uint) error
 	FindTokenByUserID(id uint) (*RefreshToken, error)
 	CreateNewRefreshToken(t *RefreshToken) error
 	RevokeAllTokensByUserID(userId uint) error
+	RevokeOtherTokensByUserID(userId uint, keepTokenHash string) error
+	CreateOAuthClient(client *OAuthClient) error
+	FindOAuthClientByClientID(clientID string) (*OAuthClient, error)
+	CreateAuthorizationCode(code *AuthorizationCode) error
+	ConsumeAuthorizationCode(codeHash string) (*AuthorizationCode, error)
+	CreateFederationState(state *FederationState) error
+	ConsumeFederationState(stateHash string) (*FederationState, error)
+	FindLinkedIdentity(provider, subject string) (*LinkedIdentity, error)
+	FindLinkedIdentitiesByUserID(userID uint) ([]LinkedIdentity, error)
+	CreateLinkedIdentity(identity *LinkedIdentity) error
+	DeleteLinkedIdentity(userID uint, provider string) error
+	CreateMagicLink(link *MagicLink) error
+	ConsumeMagicLink(tokenHash string) (*MagicLink, error)
+	CreateWebAuthnCredential(credential *WebAuthnCredential) error
+	FindWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error)
+	FindWebAuthnCredentialByCredentialID(credentialID []byte) (*WebAuthnCredential, error)
+	UpdateWebAuthnCredential(credential *WebAuthnCredential) error
+	DeleteWebAuthnCredential(userID, id uint) error
+	CreateWebAuthnSession(session *WebAuthnSession) error
+	ConsumeWebAuthnSession(sessionHash, purpose string) (*WebAuthnSession, error)
+	CreateImpersonationSession(session *ImpersonationSession) error
+	FindImpersonationSessions(actorID, targetUserID uint) ([]ImpersonationSession, error)
+	CreateAuditEvent(event *AuditEvent) error
+	FindAuditEvents(filter AuditEventFilter, offset, limit int) ([]AuditEvent, int64, error)
+	FindAuditEventsAfter(filter AuditEventFilter, afterID uint, limit int) ([]AuditEvent, error)
+	FindRefreshTokensByUserID(userID uint) ([]RefreshToken, error)
+	EraseUserData(userID uint, email string) error
 }
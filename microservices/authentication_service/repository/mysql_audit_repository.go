@@ -0,0 +1,53 @@
+package repository
+
+import (
+	. "authentication-service/models"
+
+	"gorm.io/gorm"
+)
+
+// audit events are only ever inserted, there are deliberately no update or delete methods. The one exception is
+// EraseUserData anonymizing the events of erased users
+func (r MysqlAuthRepository) CreateAuditEvent(event *AuditEvent) error {
+	return r.DB.Create(event).Error
+}
+
+// finds a page of audit events newest first, along with the total matching the filter
+func (r MysqlAuthRepository) FindAuditEvents(filter AuditEventFilter, offset, limit int) ([]AuditEvent, int64, error) {
+	var total int64
+	if err := r.filterAuditEvents(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []AuditEvent
+	if err := r.filterAuditEvents(filter).Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// finds audit events oldest first after the given id, used to export the log in batches
+func (r MysqlAuthRepository) FindAuditEventsAfter(filter AuditEventFilter, afterID uint, limit int) ([]AuditEvent, error) {
+	var events []AuditEvent
+	if err := r.filterAuditEvents(filter).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r MysqlAuthRepository) filterAuditEvents(filter AuditEventFilter) *gorm.DB {
+	query := r.DB.Model(&AuditEvent{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	return query
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	. "authentication-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r MysqlAuthRepository) CreateFederationState(state *FederationState) error {
+	return r.DB.Create(state).Error
+}
+
+// removes a pending login and returns it, a state can only be used once
+func (r MysqlAuthRepository) ConsumeFederationState(stateHash string) (*FederationState, error) {
+	var state FederationState
+	if err := r.DB.Where("state_hash = ?", stateHash).First(&state).Error; err != nil {
+		return nil, err
+	}
+
+	result := r.DB.Delete(&state)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	//another request consumed the state first or it has expired
+	if result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &state, nil
+}
+
+func (r MysqlAuthRepository) FindLinkedIdentity(provider, subject string) (*LinkedIdentity, error) {
+	var identity LinkedIdentity
+	result := r.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &identity, nil
+}
+
+func (r MysqlAuthRepository) FindLinkedIdentitiesByUserID(userID uint) ([]LinkedIdentity, error) {
+	var identities []LinkedIdentity
+	result := r.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return identities, nil
+}
+
+func (r MysqlAuthRepository) CreateLinkedIdentity(identity *LinkedIdentity) error {
+	return r.DB.Create(identity).Error
+}
+
+func (r MysqlAuthRepository) DeleteLinkedIdentity(userID uint, provider string) error {
+	result := r.DB.Where("user_id = ? AND provider = ?", userID, provider).Delete(&LinkedIdentity{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
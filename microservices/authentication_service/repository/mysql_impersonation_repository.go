@@ -0,0 +1,26 @@
+package repository
+
+import (
+	. "authentication-service/models"
+)
+
+func (r MysqlAuthRepository) CreateImpersonationSession(session *ImpersonationSession) error {
+	return r.DB.Create(session).Error
+}
+
+// finds impersonation sessions newest first, zero ids match any actor or target
+func (r MysqlAuthRepository) FindImpersonationSessions(actorID, targetUserID uint) ([]ImpersonationSession, error) {
+	query := r.DB.Model(&ImpersonationSession{})
+	if actorID != 0 {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if targetUserID != 0 {
+		query = query.Where("target_user_id = ?", targetUserID)
+	}
+
+	var sessions []ImpersonationSession
+	if err := query.Order("created_at DESC, id DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
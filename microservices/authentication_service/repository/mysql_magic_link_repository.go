@@ -0,0 +1,33 @@
+package repository
+
+import (
+	. "authentication-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r MysqlAuthRepository) CreateMagicLink(link *MagicLink) error {
+	return r.DB.Create(link).Error
+}
+
+// marks an unused, unexpired magic link as used and returns it, a link can only be used once
+func (r MysqlAuthRepository) ConsumeMagicLink(tokenHash string) (*MagicLink, error) {
+	now := time.Now()
+	result := r.DB.Model(&MagicLink{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("used_at", now)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var link MagicLink
+	if err := r.DB.Where("token_hash = ?", tokenHash).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	. "authentication-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r MysqlAuthRepository) CreateOAuthClient(client *OAuthClient) error {
+	return r.DB.Create(client).Error
+}
+
+func (r MysqlAuthRepository) FindOAuthClientByClientID(clientID string) (*OAuthClient, error) {
+	var client OAuthClient
+	result := r.DB.Where("client_id = ? AND revoked = ?", clientID, false).First(&client)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &client, nil
+}
+
+func (r MysqlAuthRepository) CreateAuthorizationCode(code *AuthorizationCode) error {
+	return r.DB.Create(code).Error
+}
+
+// marks an unused, unexpired code as used and returns it, a code can only be consumed once
+func (r MysqlAuthRepository) ConsumeAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	result := r.DB.Model(&AuthorizationCode{}).
+		Where("code_hash = ? AND used = ? AND expires_at > ?", codeHash, false, time.Now()).
+		Update("used", true)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var code AuthorizationCode
+	if err := r.DB.Where("code_hash = ?", codeHash).First(&code).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
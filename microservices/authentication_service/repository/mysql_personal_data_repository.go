@@ -0,0 +1,47 @@
+package repository
+
+import (
+	. "authentication-service/models"
+
+	"gorm.io/gorm"
+)
+
+// finds a user's refresh tokens newest first, including revoked and expired ones
+func (r MysqlAuthRepository) FindRefreshTokensByUserID(userID uint) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// removes everything stored for a user and anonymizes their audit events and the impersonations of them, which are
+// kept since they're the security record. Audit events of failed logins with the user's email are anonymized too.
+// Users without a credential aren't an error, so erasing is idempotent
+func (r MysqlAuthRepository) EraseUserData(userID uint, email string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		models := []interface{}{&RefreshToken{}, &LinkedIdentity{}, &WebAuthnCredential{}, &WebAuthnSession{}, &MagicLink{}, &AuthorizationCode{}}
+		for _, model := range models {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("link_user_id = ?", userID).Delete(&FederationState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Credential{}, userID).Error; err != nil {
+			return err
+		}
+
+		//the reason an admin gave for impersonating the user may describe them
+		if err := tx.Model(&ImpersonationSession{}).Where("target_user_id = ?", userID).Update("reason", "").Error; err != nil {
+			return err
+		}
+
+		events := tx.Model(&AuditEvent{}).Where("user_id = ?", userID)
+		if email != "" {
+			events = events.Or("email = ?", email)
+		}
+		return events.Updates(map[string]interface{}{"email": "", "ip": "", "user_agent": "", "details": ""}).Error
+	})
+}
@@ -5,6 +5,7 @@ import (
 	. "authentication-service/models"
 	"errors"
 	"fmt"
+	"log"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -32,44 +33,151 @@ func NewMysqlAuthRepository(db *gorm.DB) AuthRepository {
 		}
 	}
 
-	if err := db.AutoMigrate(&User{}, &RefreshToken{}); err != nil {
+	if err := db.AutoMigrate(&Credential{}, &RefreshToken{}, &OAuthClient{}, &AuthorizationCode{},
+		&LinkedIdentity{}, &FederationState{}, &MagicLink{},
+		&WebAuthnCredential{}, &WebAuthnSession{}, &ImpersonationSession{},
+		&AuditEvent{}); err != nil {
 		panic("failed to migrate database: " + err.Error())
 	}
 
+	if err := normalizeCredentialEmails(db); err != nil {
+		panic("failed to normalize credential emails: " + err.Error())
+	}
+
+	if config.LoadConfig().MigrateLegacyUsers {
+		if err := migrateLegacyUsers(db); err != nil {
+			panic("failed to migrate legacy users: " + err.Error())
+		}
+	}
+
 	return MysqlAuthRepository{
 		DB: db,
 	}
 }
 
-func (r MysqlAuthRepository) FindUserByID(id uint) (*User, error) {
-	var user User
-	result := r.DB.First(&user, id)
+// copies the credentials of users stored in the users table shared with the user service before the auth service
+// had its own table, rows that already have credentials are left alone so this is safe to run on every start
+func migrateLegacyUsers(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable("users") || !migrator.HasColumn("users", "password") {
+		return nil
+	}
+
+	role := "'" + RoleUser + "'"
+	if migrator.HasColumn("users", "role") {
+		role = "COALESCE(users.role, " + role + ")"
+	}
+
+	result := db.Exec(`INSERT INTO credentials (user_id, email, password_hash, role, created_at, updated_at)
+		SELECT users.id, LOWER(users.email), COALESCE(users.password, ''), ` + role + `, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+		FROM users
+		WHERE NOT EXISTS (SELECT 1 FROM credentials WHERE credentials.user_id = users.id OR credentials.email = LOWER(users.email))`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("migrated credentials of %d legacy users", result.RowsAffected)
+	}
+	return nil
+}
+
+// lowercases emails stored before they were normalized. Case insensitive collations never see a difference, they
+// match the stored emails either way
+func normalizeCredentialEmails(db *gorm.DB) error {
+	result := db.Exec("UPDATE credentials SET email = LOWER(email) WHERE email <> LOWER(email)")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("normalized the emails of %d credentials", result.RowsAffected)
+	}
+	return nil
+}
+
+func (r MysqlAuthRepository) FindCredentialByUserID(userID uint) (*Credential, error) {
+	var credential Credential
+	result := r.DB.First(&credential, userID)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return &user, nil
+	return &credential, nil
 }
 
-func (r MysqlAuthRepository) FindUserByEmail(email string) (*User, error) {
-	var user User
-	result := r.DB.Where("email = ?", email).First(&user)
+func (r MysqlAuthRepository) FindCredentialByEmail(email string) (*Credential, error) {
+	var credential Credential
+	result := r.DB.Where("email = ?", NormalizeEmail(email)).First(&credential)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return &user, nil
+	return &credential, nil
 }
 
-func (r MysqlAuthRepository) UserExistsByEmail(email string) (bool, error) {
+func (r MysqlAuthRepository) CredentialExistsByEmail(email string) (bool, error) {
 	var count int64
-	result := r.DB.Model(&User{}).Where("email = ?", email).Count(&count)
+	result := r.DB.Model(&Credential{}).Where("email = ?", NormalizeEmail(email)).Count(&count)
 	if result.Error != nil {
 		return false, result.Error
 	}
 	return count > 0, nil
 }
 
+func (r MysqlAuthRepository) CreateCredential(credential *Credential) error {
+	return r.DB.Create(credential).Error
+}
+
+// creates the credential or replaces the stored one for the same user
+func (r MysqlAuthRepository) SaveCredential(credential *Credential) error {
+	return r.DB.Save(credential).Error
+}
+
+func (r MysqlAuthRepository) UpdateCredentialPassword(userID uint, passwordHash string) error {
+	return r.DB.Model(&Credential{}).Where("user_id = ?", userID).Update("password_hash", passwordHash).Error
+}
+
+func (r MysqlAuthRepository) UpdateCredentialRole(userID uint, role string) error {
+	result := r.DB.Model(&Credential{}).Where("user_id = ?", userID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r MysqlAuthRepository) UpdateCredentialStatus(userID uint, status string) error {
+	result := r.DB.Model(&Credential{}).Where("user_id = ?", userID).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// removes a user's credential along with their refresh tokens, linked identities and passkeys
+func (r MysqlAuthRepository) DeleteCredential(userID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&RefreshToken{}, &LinkedIdentity{}, &WebAuthnCredential{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Delete(&Credential{}, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
 func (r MysqlAuthRepository) FindTokenByUserID(id uint) (*RefreshToken, error) {
 	var token RefreshToken
 	result := r.DB.Model(&RefreshToken{}).
@@ -137,3 +245,10 @@ func (r MysqlAuthRepository) RevokeAllTokensByUserID(userId uint) error {
 
 	return nil
 }
+
+func (r MysqlAuthRepository) RevokeOtherTokensByUserID(userId uint, keepTokenHash string) error {
+	// revoke every refresh token for the user except the one with the given hash
+	return r.DB.Model(&RefreshToken{}).
+		Where("user_id = ? AND token_hash <> ?", userId, keepTokenHash).
+		Update("revoked", true).Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	. "authentication-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r MysqlAuthRepository) CreateWebAuthnCredential(credential *WebAuthnCredential) error {
+	return r.DB.Create(credential).Error
+}
+
+func (r MysqlAuthRepository) FindWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	result := r.DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return credentials, nil
+}
+
+func (r MysqlAuthRepository) FindWebAuthnCredentialByCredentialID(credentialID []byte) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	result := r.DB.Where("credential_id = ?", credentialID).First(&credential)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &credential, nil
+}
+
+func (r MysqlAuthRepository) UpdateWebAuthnCredential(credential *WebAuthnCredential) error {
+	return r.DB.Save(credential).Error
+}
+
+func (r MysqlAuthRepository) DeleteWebAuthnCredential(userID, id uint) error {
+	result := r.DB.Where("user_id = ? AND id = ?", userID, id).Delete(&WebAuthnCredential{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r MysqlAuthRepository) CreateWebAuthnSession(session *WebAuthnSession) error {
+	return r.DB.Create(session).Error
+}
+
+// removes a ceremony session and returns it, a session can only be finished once
+func (r MysqlAuthRepository) ConsumeWebAuthnSession(sessionHash, purpose string) (*WebAuthnSession, error) {
+	var session WebAuthnSession
+	if err := r.DB.Where("session_hash = ? AND purpose = ?", sessionHash, purpose).First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	result := r.DB.Delete(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	//another request finished the ceremony first or it has expired
+	if result.RowsAffected == 0 || time.Now().After(session.ExpiresAt) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,84 @@
+package AuthService
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"authentication-service/repository"
+	"iter"
+	"log"
+	"net/http"
+)
+
+// number of events loaded at a time while exporting the audit log
+const auditExportBatchSize = 500
+
+// appends an event to the audit log, failures are logged so they never block the action being audited
+func (s *AuthService) RecordAuditEvent(event *dtos.AuditEvent) {
+	if err := s.AuthRepo.CreateAuditEvent(models.NewAuditEvent(event)); err != nil {
+		log.Printf("failed to record %s audit event for user %d: %v", event.Type, event.UserID, err)
+	}
+}
+
+// returns a page of audit events newest first, admins only
+func (s *AuthService) ListAuditEvents(claims *dtos.CustomClaims, query *dtos.AuditEventQuery) (*dtos.AuditEventPage, *e.Error) {
+	if _, err := s.requireAdmin(claims); err != nil {
+		return nil, err
+	}
+
+	events, total, err := s.AuthRepo.FindAuditEvents(auditEventFilter(query), (query.Page-1)*query.PageSize, query.PageSize)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get audit events", err)
+	}
+
+	page := &dtos.AuditEventPage{
+		Events:   make([]*dtos.AuditEvent, 0, len(events)),
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Total:    total,
+	}
+	for i := range events {
+		page.Events = append(page.Events, events[i].ToDTO())
+	}
+	return page, nil
+}
+
+// returns every audit event matching the query oldest first, admins only. Pagination is ignored,
+// events are loaded in batches while iterating so the whole log is never held in memory
+func (s *AuthService) ExportAuditEvents(claims *dtos.CustomClaims, query *dtos.AuditEventQuery) (iter.Seq2[*dtos.AuditEvent, error], *e.Error) {
+	if _, err := s.requireAdmin(claims); err != nil {
+		return nil, err
+	}
+
+	filter := auditEventFilter(query)
+	return func(yield func(*dtos.AuditEvent, error) bool) {
+		var afterID uint
+		for {
+			events, err := s.AuthRepo.FindAuditEventsAfter(filter, afterID, auditExportBatchSize)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for i := range events {
+				if !yield(events[i].ToDTO(), nil) {
+					return
+				}
+			}
+
+			if len(events) < auditExportBatchSize {
+				return
+			}
+			afterID = events[len(events)-1].ID
+		}
+	}, nil
+}
+
+func auditEventFilter(query *dtos.AuditEventQuery) repository.AuditEventFilter {
+	return repository.AuditEventFilter{
+		UserID: query.UserID,
+		Type:   query.Type,
+		Since:  query.Since,
+		Until:  query.Until,
+	}
+}
@@ -4,22 +4,50 @@ import (
 	c "authentication-service/config"
 	"authentication-service/dtos"
 	e "authentication-service/errors"
+	"authentication-service/federation"
+	"authentication-service/hashing"
+	"authentication-service/mailer"
 	"authentication-service/models"
+	"authentication-service/policy"
+	"authentication-service/ratelimit"
 	"authentication-service/repository" // Assuming you'll have a repository layer
+	"authentication-service/userclient"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// client id the auth service uses in tokens it mints for itself
+const serviceClientID = "auth-service"
+
 // AuthService handles business logic for user operations
 type AuthService struct {
 	AuthRepo repository.AuthRepository
+	Mailer   mailer.Mailer
+	Hasher   hashing.PasswordHasher
+	Policy   *policy.Policy
+	//user profiles are owned by the user service, only credentials are stored here
+	Users userclient.Directory
+
+	//key used to sign openid connect id tokens, loaded on first use
+	oidcKey     *rsa.PrivateKey
+	oidcKeyErr  error
+	oidcKeyOnce sync.Once
+
+	//external identity providers, created from config on first use
+	providers   map[string]*federation.Provider
+	providersMu sync.Mutex
+
+	//limits how many magic links can be requested per email
+	magicLinkLimiter *ratelimit.Limiter
 }
 
 // NewAuthService creates a new instance of AuthService
@@ -27,15 +55,34 @@ func NewAuthService(AuthRepo repository.AuthRepository) *AuthService {
 	if AuthRepo == nil {
 		AuthRepo = repository.NewMysqlAuthRepository(nil)
 	}
-	return &AuthService{
+	conf := c.LoadConfig()
+	hasher, err := hashing.NewPasswordHasher(conf.PasswordHashAlgorithm,
+		hashing.NewArgon2idHasher(uint32(conf.Argon2MemoryKB), uint32(conf.Argon2Iterations), uint8(conf.Argon2Parallelism)), conf.BcryptCost)
+	if err != nil {
+		panic("failed to create password hasher: " + err.Error())
+	}
+	s := &AuthService{
 		AuthRepo: AuthRepo,
+		Mailer:   mailer.NewMailer(conf),
+		Hasher:   hasher,
+		Policy: &policy.Policy{
+			MinLength:            conf.PasswordMinLength,
+			MaxLength:            conf.PasswordMaxLength,
+			MinCharacterClasses:  conf.PasswordMinCharacterClasses,
+			MaxRepeats:           conf.PasswordMaxRepeats,
+			DisallowPersonalInfo: conf.PasswordDisallowPersonalInfo,
+			Breached:             policy.NewFileBreachChecker(conf.BreachedPasswordsFile),
+		},
+		magicLinkLimiter: ratelimit.NewLimiter(conf.MagicLinkRateLimit, time.Duration(conf.MagicLinkRateWindowMinutes)*time.Minute),
 	}
+	s.Users = userclient.NewHTTPDirectory(conf.UserServiceURL, s.serviceToken)
+	return s
 }
 
 // service used to login users (generate new tokens and revoke old ones)
 func (s *AuthService) UserLogin(u *dtos.UserLogin) (*dtos.UserLoginResponse, *e.Error) {
 	//make sure user exists
-	existing, err := s.AuthRepo.FindUserByEmail(u.Email)
+	existing, err := s.AuthRepo.FindCredentialByEmail(u.Email)
 	if err != nil {
 		if errors.Is(err, e.ErrRecordNotFound) {
 			return nil, e.NewError(http.StatusNotFound, "No user exists with matching email", err)
@@ -44,21 +91,53 @@ func (s *AuthService) UserLogin(u *dtos.UserLogin) (*dtos.UserLoginResponse, *e.
 	}
 
 	//ensure password lines up with salted hash for user
-	if err := bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(u.Password)); err != nil {
-		return nil, e.NewError(http.StatusUnauthorized, "Invalid password", err)
+	match, err := s.Hasher.Verify(u.Password, existing.PasswordHash)
+	if err != nil || !match {
+		return nil, e.NewError(http.StatusUnauthorized, "Invalid password", fmt.Errorf("password mismatch: %v", err))
+	}
+
+	//the plain password is only available here, so hashes made with an outdated algorithm or cost are upgraded now
+	if s.Hasher.NeedsRehash(existing.PasswordHash) {
+		s.rehashPassword(existing, u.Password)
+	}
+
+	return s.createSession(existing)
+}
+
+// replaces a user's stored hash with one from the configured hasher, failures only mean the upgrade is retried next login
+func (s *AuthService) rehashPassword(credential *models.Credential, password string) {
+	hash, err := s.Hasher.Hash(password)
+	if err != nil {
+		log.Printf("failed to rehash password for user %d: %v", credential.UserID, err)
+		return
+	}
+
+	if err := s.AuthRepo.UpdateCredentialPassword(credential.UserID, hash); err != nil {
+		log.Printf("failed to store rehashed password for user %d: %v", credential.UserID, err)
+		return
+	}
+	credential.PasswordHash = hash
+}
+
+// issues a new access and refresh token pair for a user, revoking their previous refresh token
+func (s *AuthService) createSession(user *models.Credential) (*dtos.UserLoginResponse, *e.Error) {
+	//every way of logging in ends here, so suspended and deactivated users can't get tokens however they sign in
+	if err := checkStatus(user); err != nil {
+		return nil, err
 	}
 
 	//convert user to DTO
-	existingDTO := existing.ToUserDTO()
+	userDTO := user.ToUserDTO()
+	conf := c.LoadConfig()
 
 	//generate access token
-	accessToken, err := s.generateJWT(existingDTO, 15*time.Minute)
+	accessToken, err := s.generateJWT(userDTO, conf.AccessTokenTTL)
 	if err != nil {
 		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate access token", err)
 	}
 
 	//generate refresh token
-	rawRefreshToken, err := s.generateJWT(existingDTO, 7*24*time.Hour)
+	rawRefreshToken, err := s.generateJWT(userDTO, conf.RefreshTokenTTL)
 	if err != nil {
 		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate refresh token", err)
 	}
@@ -68,9 +147,9 @@ func (s *AuthService) UserLogin(u *dtos.UserLogin) (*dtos.UserLoginResponse, *e.
 
 	//store refresh token in database and revoke all old refresh tokens
 	refreshToken := &models.RefreshToken{
-		UserID:    existing.ID,
+		UserID:    user.UserID,
 		TokenHash: string(hashedToken),
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: time.Now().Add(conf.RefreshTokenTTL),
 	}
 
 	if err := s.AuthRepo.CreateNewRefreshToken(refreshToken); err != nil {
@@ -80,15 +159,47 @@ func (s *AuthService) UserLogin(u *dtos.UserLogin) (*dtos.UserLoginResponse, *e.
 	return dtos.NewUserLoginResponse(accessToken, rawRefreshToken), nil
 }
 
+// rejects users who aren't active
+func checkStatus(user *models.Credential) *e.Error {
+	switch user.Status {
+	case models.StatusActive:
+		return nil
+	case models.StatusSuspended:
+		return e.NewError(http.StatusForbidden, "Account is suspended", fmt.Errorf("user %d is suspended", user.UserID))
+	default:
+		return e.NewError(http.StatusForbidden, "Account is deactivated", fmt.Errorf("user %d is %s", user.UserID, user.Status))
+	}
+}
+
 // function used to refresh access token given a valid refresh token
 func (s *AuthService) RefreshToken(refreshToken string) (*dtos.RefreshResponse, *e.Error) {
+	user, err := s.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	//sessions are revoked when a user is suspended, this catches refresh tokens stored before that happened
+	if err := checkStatus(user); err != nil {
+		if revokeErr := s.AuthRepo.RevokeAllTokensByUserID(user.UserID); revokeErr != nil {
+			log.Printf("failed to revoke sessions of %s user %d: %v", user.Status, user.UserID, revokeErr)
+		}
+		return nil, err
+	}
+
+	//generate new access token
+	newAccessToken, genErr := s.generateJWT(user.ToUserDTO(), c.LoadConfig().AccessTokenTTL) // short-lived access token
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate new access token", genErr)
+	}
+
+	return dtos.NewRefreshResponse(newAccessToken), nil
+}
+
+// validates a refresh token against the one stored for its user, returning the user it belongs to
+func (s *AuthService) ValidateRefreshToken(refreshToken string) (*models.Credential, *e.Error) {
 	//parse and validate the refresh token
 	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, e.NewError(http.StatusUnauthorized, "Unexpected signing method", nil)
-		}
 		return []byte(c.LoadConfig().JwtSecret), nil
-	})
+	}, s.parserOptions(c.LoadConfig().JwtAudience)...)
 
 	if err != nil || !token.Valid {
 		return nil, e.NewError(http.StatusUnauthorized, "Invalid refresh token", err)
@@ -103,7 +214,7 @@ func (s *AuthService) RefreshToken(refreshToken string) (*dtos.RefreshResponse,
 	userID := uint(claims["userID"].(float64))
 
 	//ensure user actually exists
-	user, err := s.AuthRepo.FindUserByID(userID)
+	user, err := s.AuthRepo.FindCredentialByUserID(userID)
 
 	if err != nil {
 		if errors.Is(err, e.ErrRecordNotFound) {
@@ -127,13 +238,7 @@ func (s *AuthService) RefreshToken(refreshToken string) (*dtos.RefreshResponse,
 		return nil, e.NewError(http.StatusUnauthorized, "refresh token does not matched stored token", fmt.Errorf("refresh token does not matched stored token"))
 	}
 
-	//generate new access token
-	newAccessToken, err := s.generateJWT(user.ToUserDTO(), 15*time.Minute) // short-lived access token
-	if err != nil {
-		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate new access token", err)
-	}
-
-	return dtos.NewRefreshResponse(newAccessToken), nil
+	return user, nil
 }
 
 // function used to logout a user within the service (revoke all tokens under them)
@@ -146,14 +251,17 @@ func (s *AuthService) Logout(userId uint) *e.Error {
 
 // Helper function to generate JWT
 func (s *AuthService) generateJWT(u *dtos.User, duration time.Duration) (string, error) {
+	return s.generateScopedJWT(u, "", c.LoadConfig().JwtAudience, duration)
+}
 
+// helper function to generate a JWT for the audience, limited to the given scope
+func (s *AuthService) generateScopedJWT(u *dtos.User, scope, audience string, duration time.Duration) (string, error) {
 	claims := dtos.CustomClaims{
-		UserID: u.Id,
-		Email:  u.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		UserID:           u.Id,
+		Email:            u.Email,
+		Scope:            scope,
+		Role:             u.Role,
+		RegisteredClaims: s.registeredClaims(fmt.Sprint(u.Id), audience, duration),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -164,10 +272,10 @@ func (s *AuthService) generateJWT(u *dtos.User, duration time.Duration) (string,
 func (s *AuthService) ParseJWT(tokenString *string) (*dtos.CustomClaims, error) {
 	claims := &dtos.CustomClaims{}
 
-	// Parse the token with the claims and validate
+	// Parse the token with the claims and validate, only accepting tokens this environment issued for its users
 	token, err := jwt.ParseWithClaims(*tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(c.LoadConfig().JwtSecret), nil
-	})
+	}, s.parserOptions(c.LoadConfig().JwtAudience)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("token parse error: %w", err)
@@ -177,9 +285,62 @@ func (s *AuthService) ParseJWT(tokenString *string) (*dtos.CustomClaims, error)
 		return nil, fmt.Errorf("invalid token")
 	}
 
+	//tokens issued to oauth clients are never sessions, even when they were given the first party audience
+	if len(claims.Audience) != 1 || claims.ClientID != "" || claims.Scope != "" {
+		return nil, fmt.Errorf("token was not issued for a session")
+	}
+
 	return claims, nil
 }
 
+// looks up a user's name in the user service, names are only cosmetic so failures are logged and an empty name returned
+func (s *AuthService) profileName(userID uint) string {
+	profile, err := s.Users.GetUser(userID)
+	if err != nil {
+		log.Printf("failed to get profile of user %d: %v", userID, err)
+		return ""
+	}
+	return profile.Name
+}
+
+// mints a short lived token the auth service uses to call the user service
+func (s *AuthService) serviceToken() (string, error) {
+	conf := c.LoadConfig()
+	claims := dtos.CustomClaims{
+		ClientID:         serviceClientID,
+		Scope:            "users:write",
+		RegisteredClaims: s.registeredClaims(serviceClientID, conf.UserServiceAudience, 5*time.Minute),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(conf.JwtSecret))
+}
+
+// registered claims shared by every token the service signs
+func (s *AuthService) registeredClaims(subject, audience string, duration time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    c.LoadConfig().Issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+}
+
+// options enforcing the algorithm, issuer, audience and lifetime of tokens signed by the service
+func (s *AuthService) parserOptions(audience string) []jwt.ParserOption {
+	conf := c.LoadConfig()
+	return []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(conf.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(conf.JwtLeeway),
+		jwt.WithExpirationRequired(),
+	}
+}
+
 func (s *AuthService) hashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(hash[:])
@@ -0,0 +1,87 @@
+package AuthService
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/hashing"
+	"authentication-service/models"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// scope service clients need to manage credentials through the internal api
+const ScopeCredentialsWrite = "credentials:write"
+
+// creates or updates the credential of a user owned by the user service
+func (s *AuthService) SetCredential(userID uint, req *dtos.CredentialUpsert) *e.Error {
+	credential, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+		return e.NewError(http.StatusInternalServerError, "Failed to get credential", err)
+	}
+
+	//another user's credential can't be taken over by using their email
+	email := models.NormalizeEmail(req.Email)
+	if credential == nil || credential.Email != email {
+		existing, err := s.AuthRepo.FindCredentialByEmail(req.Email)
+		if err == nil && existing.UserID != userID {
+			return e.NewError(http.StatusConflict, "Email already exists", fmt.Errorf("email belongs to user %d", existing.UserID))
+		}
+		if err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+		}
+	}
+
+	if credential == nil {
+		credential = models.NewCredential(userID, req.Email, "")
+	}
+	credential.Email = email
+
+	if req.Password != "" {
+		if e := s.validatePassword("password", req.Password, req.Name, req.Email); e != nil {
+			return e
+		}
+
+		hash, err := s.Hasher.Hash(req.Password)
+		if err != nil {
+			if errors.Is(err, hashing.ErrPasswordTooLong) {
+				return e.NewError(http.StatusBadRequest, "Password too long", err)
+			}
+			return e.NewError(http.StatusInternalServerError, "Failed to hash password", err)
+		}
+		credential.PasswordHash = hash
+	}
+
+	if err := s.AuthRepo.SaveCredential(credential); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to store credential", err)
+	}
+	return nil
+}
+
+// sets the status of a user's credential, revoking the sessions of users who are no longer active
+func (s *AuthService) SetCredentialStatus(userID uint, req *dtos.CredentialStatus) *e.Error {
+	if err := s.AuthRepo.UpdateCredentialStatus(userID, req.Status); err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "Credential doesn't exist", err)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to update credential status", err)
+	}
+
+	if req.Status != models.StatusActive {
+		if err := s.AuthRepo.RevokeAllTokensByUserID(userID); err != nil {
+			return e.NewError(http.StatusInternalServerError, "Failed to revoke sessions", err)
+		}
+	}
+	return nil
+}
+
+// removes a user's credential, which also ends their sessions
+func (s *AuthService) DeleteCredential(userID uint) *e.Error {
+	if err := s.AuthRepo.DeleteCredential(userID); err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "Credential doesn't exist", err)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to delete credential", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/federation"
+	"authentication-service/models"
+	"authentication-service/userclient"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// how long a user has to complete a login with an external provider
+var federationStateDuration = 10 * time.Minute
+
+// returns the names of the configured external providers
+func (s *AuthService) ListProviders() []string {
+	names := []string{}
+	for _, provider := range c.LoadConfig().Providers {
+		names = append(names, provider.Name)
+	}
+	return names
+}
+
+// starts a login with an external provider, linking the identity to linkUserID when it's set
+func (s *AuthService) BeginFederatedLogin(providerName string, linkUserID uint) (*dtos.FederationRedirect, *e.Error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, genErr := randomToken(32)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate state", genErr)
+	}
+	nonce, genErr := randomToken(32)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate nonce", genErr)
+	}
+	verifier, genErr := randomToken(32)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate code verifier", genErr)
+	}
+
+	pending := &models.FederationState{
+		StateHash:    s.hashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(federationStateDuration),
+	}
+	if err := s.AuthRepo.CreateFederationState(pending); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to store login state", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL, urlErr := provider.AuthCodeURL(state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if urlErr != nil {
+		return nil, e.NewError(http.StatusBadGateway, "Failed to reach identity provider", urlErr)
+	}
+
+	return &dtos.FederationRedirect{AuthorizationURL: authURL, State: state}, nil
+}
+
+// completes a login with an external provider, either signing the user in or linking the identity
+func (s *AuthService) CompleteFederatedLogin(providerName, state, code string) (*dtos.FederationResult, *e.Error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, repoErr := s.AuthRepo.ConsumeFederationState(s.hashToken(state))
+	if repoErr != nil {
+		if errors.Is(repoErr, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusBadRequest, "Login state is invalid or expired", repoErr)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to load login state", repoErr)
+	}
+	if pending.Provider != providerName {
+		return nil, e.NewError(http.StatusBadRequest, "Login state was issued for another provider", fmt.Errorf("provider mismatch"))
+	}
+
+	claims, exchangeErr := provider.Exchange(code, pending.CodeVerifier, pending.Nonce)
+	if exchangeErr != nil {
+		return nil, e.NewError(http.StatusUnauthorized, "Failed to verify identity with provider", exchangeErr)
+	}
+
+	if pending.LinkUserID != 0 {
+		identity, err := s.linkIdentity(pending.LinkUserID, providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &dtos.FederationResult{Identity: identity.ToDTO(), UserID: pending.LinkUserID}, nil
+	}
+
+	user, err := s.federatedUser(providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.createSession(user)
+	if err != nil {
+		return nil, err
+	}
+	return &dtos.FederationResult{Login: session}, nil
+}
+
+// lists the external identities linked to a user
+func (s *AuthService) ListIdentities(userID uint) ([]*dtos.LinkedIdentity, *e.Error) {
+	identities, err := s.AuthRepo.FindLinkedIdentitiesByUserID(userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get linked identities", err)
+	}
+
+	result := []*dtos.LinkedIdentity{}
+	for i := range identities {
+		result = append(result, identities[i].ToDTO())
+	}
+	return result, nil
+}
+
+// unlinks an external identity, refusing to remove a user's last way to sign in
+func (s *AuthService) UnlinkIdentity(userID uint, providerName string) *e.Error {
+	user, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	identities, err := s.AuthRepo.FindLinkedIdentitiesByUserID(userID)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to get linked identities", err)
+	}
+	if user.PasswordHash == "" && len(identities) <= 1 {
+		return e.NewError(http.StatusConflict, "Cannot unlink the only way to sign in", fmt.Errorf("user has no password and no other linked identity"))
+	}
+
+	if err := s.AuthRepo.DeleteLinkedIdentity(userID, providerName); err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "No identity is linked for this provider", err)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to unlink identity", err)
+	}
+
+	return nil
+}
+
+// finds the user an external identity belongs to, creating one for new identities
+func (s *AuthService) federatedUser(providerName string, claims *federation.Claims) (*models.Credential, *e.Error) {
+	identity, err := s.AuthRepo.FindLinkedIdentity(providerName, claims.Subject)
+	if err == nil {
+		user, err := s.AuthRepo.FindCredentialByUserID(identity.UserID)
+		if err != nil {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, e.ErrRecordNotFound) {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get linked identity", err)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, e.NewError(http.StatusForbidden, "Identity provider did not return a verified email", fmt.Errorf("verified email required"))
+	}
+
+	//accounts are never linked automatically by email, the owner has to sign in and link it
+	exists, err := s.AuthRepo.CredentialExistsByEmail(claims.Email)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+	}
+	if exists {
+		return nil, e.NewError(http.StatusConflict, "An account with this email already exists, sign in and link the identity instead", fmt.Errorf("email already registered"))
+	}
+
+	//the profile is created in the user service, federated users have no password until they set one
+	profile, err := s.Users.CreateUser(claims.Name, claims.Email)
+	if err != nil {
+		if errors.Is(err, userclient.ErrUserExists) {
+			return nil, e.NewError(http.StatusConflict, "An account with this email already exists, sign in and link the identity instead", err)
+		}
+		return nil, e.NewError(http.StatusBadGateway, "Failed to create user", err)
+	}
+
+	user := models.NewCredential(profile.Id, claims.Email, "")
+	if err := s.AuthRepo.CreateCredential(user); err != nil {
+		s.abandonSignUp(profile.Id, false)
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to create user", err)
+	}
+
+	if _, err := s.linkIdentity(user.UserID, providerName, claims); err != nil {
+		//without the identity the user has neither a password nor a way to sign in
+		s.abandonSignUp(user.UserID, true)
+		return nil, err
+	}
+	return user, nil
+}
+
+// removes what a failed federated sign up created, otherwise the profile would keep the email taken without anyone
+// being able to sign in
+func (s *AuthService) abandonSignUp(userID uint, credentialCreated bool) {
+	if credentialCreated {
+		if err := s.AuthRepo.DeleteCredential(userID); err != nil {
+			log.Printf("failed to remove credential of user %d after their sign up failed: %v", userID, err)
+		}
+	}
+	if err := s.Users.DeleteUser(userID); err != nil {
+		log.Printf("failed to remove profile of user %d after their sign up failed: %v", userID, err)
+	}
+}
+
+// links an external identity to an existing user
+func (s *AuthService) linkIdentity(userID uint, providerName string, claims *federation.Claims) (*models.LinkedIdentity, *e.Error) {
+	existing, err := s.AuthRepo.FindLinkedIdentity(providerName, claims.Subject)
+	if err == nil {
+		if existing.UserID == userID {
+			return existing, nil
+		}
+		return nil, e.NewError(http.StatusConflict, "Identity is already linked to another account", fmt.Errorf("identity already linked"))
+	}
+	if !errors.Is(err, e.ErrRecordNotFound) {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get linked identity", err)
+	}
+
+	identity := models.NewLinkedIdentity(userID, providerName, claims.Subject, claims.Email)
+	if err := s.AuthRepo.CreateLinkedIdentity(identity); err != nil {
+		return nil, e.NewError(http.StatusConflict, "Failed to link identity, a different identity may already be linked for this provider", err)
+	}
+	return identity, nil
+}
+
+// returns the external provider with the given name
+func (s *AuthService) provider(name string) (*federation.Provider, *e.Error) {
+	s.providersMu.Lock()
+	defer s.providersMu.Unlock()
+
+	if provider, ok := s.providers[name]; ok {
+		return provider, nil
+	}
+
+	conf, ok := c.LoadConfig().Provider(name)
+	if !ok {
+		return nil, e.NewError(http.StatusNotFound, "Unknown identity provider", fmt.Errorf("provider %q is not configured", name))
+	}
+
+	if s.providers == nil {
+		s.providers = make(map[string]*federation.Provider)
+	}
+	s.providers[name] = federation.NewProvider(*conf)
+	return s.providers[name], nil
+}
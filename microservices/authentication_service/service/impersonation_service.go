@@ -0,0 +1,141 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// issues a short lived access token letting an admin act as another user, recording the session for auditing
+func (s *AuthService) Impersonate(actorClaims *dtos.CustomClaims, targetUserID uint, req *dtos.ImpersonationRequest) (*dtos.ImpersonationResponse, *e.Error) {
+	actor, err := s.requireAdmin(actorClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetUserID == actor.UserID {
+		return nil, e.NewError(http.StatusBadRequest, "Admins can't impersonate themselves", fmt.Errorf("user %d tried to impersonate themselves", actor.UserID))
+	}
+
+	target, findErr := s.AuthRepo.FindCredentialByUserID(targetUserID)
+	if findErr != nil {
+		if errors.Is(findErr, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", findErr)
+	}
+
+	//acting as another admin would hand out their privileges
+	if target.Role == models.RoleAdmin {
+		return nil, e.NewError(http.StatusForbidden, "Admins can't be impersonated", fmt.Errorf("user %d tried to impersonate admin %d", actor.UserID, target.UserID))
+	}
+
+	tokenID, genErr := randomToken(16)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate token id", genErr)
+	}
+
+	//the session is recorded before the token exists so every token has an audit record
+	session := &models.ImpersonationSession{
+		ActorID:      actor.UserID,
+		TargetUserID: target.UserID,
+		Reason:       req.Reason,
+		TokenID:      tokenID,
+		ExpiresAt:    time.Now().Add(time.Duration(c.LoadConfig().ImpersonationTTLMinutes) * time.Minute),
+	}
+	if err := s.AuthRepo.CreateImpersonationSession(session); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to record impersonation session", err)
+	}
+	log.Printf("impersonation session %d: admin %d acting as user %d until %s: %s",
+		session.ID, actor.UserID, target.UserID, session.ExpiresAt.Format(time.RFC3339), session.Reason)
+
+	accessToken, genErr := s.generateImpersonationJWT(actor, target, session)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate access token", genErr)
+	}
+
+	return &dtos.ImpersonationResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   session.ExpiresAt,
+		SessionID:   session.ID,
+	}, nil
+}
+
+// lists impersonation sessions for admins, zero ids match any actor or target
+func (s *AuthService) ListImpersonationSessions(actorClaims *dtos.CustomClaims, actorID, targetUserID uint) ([]*dtos.ImpersonationSession, *e.Error) {
+	if _, err := s.requireAdmin(actorClaims); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.AuthRepo.FindImpersonationSessions(actorID, targetUserID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get impersonation sessions", err)
+	}
+
+	response := make([]*dtos.ImpersonationSession, 0, len(sessions))
+	for i := range sessions {
+		response = append(response, sessions[i].ToDTO())
+	}
+	return response, nil
+}
+
+// changes a user's role
+func (s *AuthService) SetUserRole(userID uint, role string) *e.Error {
+	if err := s.AuthRepo.UpdateCredentialRole(userID, role); err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to update role", err)
+	}
+	return nil
+}
+
+// checks the token belongs to a user who is currently an admin, acting for themselves
+func (s *AuthService) requireAdmin(claims *dtos.CustomClaims) (*models.Credential, *e.Error) {
+	//service clients and impersonation tokens never carry admin rights
+	if claims.ClientID != "" || claims.Act != nil {
+		return nil, e.NewError(http.StatusForbidden, "Admin access requires an admin's own token", fmt.Errorf("token isn't an admin's own token"))
+	}
+
+	//the role is checked against the database so revoking it takes effect immediately
+	user, err := s.AuthRepo.FindCredentialByUserID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusForbidden, "Admin access required", e.ErrNotFound)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	if user.Role != models.RoleAdmin {
+		return nil, e.NewError(http.StatusForbidden, "Admin access required", fmt.Errorf("user %d isn't an admin", user.UserID))
+	}
+	return user, nil
+}
+
+// helper function to generate an access token for the target carrying the admin as its actor
+func (s *AuthService) generateImpersonationJWT(actor, target *models.Credential, session *models.ImpersonationSession) (string, error) {
+	claims := dtos.CustomClaims{
+		UserID: target.UserID,
+		Email:  target.Email,
+		Role:   target.Role,
+		Act: &dtos.Actor{
+			Subject: fmt.Sprint(actor.UserID),
+			UserID:  actor.UserID,
+			Email:   actor.Email,
+		},
+		RegisteredClaims: s.registeredClaims(fmt.Sprint(target.UserID), c.LoadConfig().JwtAudience, time.Until(session.ExpiresAt)),
+	}
+	claims.ID = session.TokenID
+	claims.ExpiresAt = jwt.NewNumericDate(session.ExpiresAt)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(c.LoadConfig().JwtSecret))
+}
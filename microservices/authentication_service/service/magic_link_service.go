@@ -0,0 +1,137 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// lifetime of a magic link
+var magicLinkDuration = 15 * time.Minute
+
+// purpose claim that keeps magic link tokens from being used anywhere else
+const magicLinkPurpose = "magic_link"
+
+// claims carried by a magic link token
+type magicLinkClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// emails a single use login link to the user, silently doing nothing for unknown emails
+func (s *AuthService) RequestMagicLink(req *dtos.MagicLinkRequest) *e.Error {
+	email := models.NormalizeEmail(req.Email)
+
+	//limited per email whether or not it exists so the limit doesn't reveal registered emails
+	if !s.magicLinkLimiter.Allow(email) {
+		return e.NewError(http.StatusTooManyRequests, "Too many login links requested, try again later", fmt.Errorf("rate limit exceeded for %s", email))
+	}
+
+	user, err := s.AuthRepo.FindCredentialByEmail(email)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil
+		}
+		return e.NewError(http.StatusInternalServerError, "An error occurred when fetching the user", err)
+	}
+
+	id, err := randomToken(32)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to generate login link", err)
+	}
+
+	expiresAt := time.Now().Add(magicLinkDuration)
+	link := &models.MagicLink{
+		UserID:    user.UserID,
+		TokenHash: s.hashToken(id),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.AuthRepo.CreateMagicLink(link); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to store login link", err)
+	}
+
+	token, err := s.signMagicLink(user.UserID, id, expiresAt)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to sign login link", err)
+	}
+
+	body := fmt.Sprintf("Use the link below to log in. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you didn't request this email you can ignore it.",
+		int(magicLinkDuration.Minutes()), s.magicLinkURL(token))
+	if err := s.Mailer.Send(user.Email, "Your login link", body); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to send login link", err)
+	}
+
+	return nil
+}
+
+// logs a user in with a magic link token, the link can't be used again afterwards
+func (s *AuthService) RedeemMagicLink(token string) (*dtos.UserLoginResponse, *e.Error) {
+	claims := &magicLinkClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.magicLinkKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil || claims.Purpose != magicLinkPurpose {
+		return nil, e.NewError(http.StatusUnauthorized, "Invalid login link", fmt.Errorf("invalid magic link token: %v", err))
+	}
+
+	link, err := s.AuthRepo.ConsumeMagicLink(s.hashToken(claims.ID))
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusUnauthorized, "Login link has already been used or has expired", err)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to check login link", err)
+	}
+
+	user, err := s.AuthRepo.FindCredentialByUserID(link.UserID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	return s.createSession(user)
+}
+
+// signs a magic link token referencing the stored link by id
+func (s *AuthService) signMagicLink(userID uint, id string, expiresAt time.Time) (string, error) {
+	claims := magicLinkClaims{
+		Purpose: magicLinkPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Subject:   fmt.Sprint(userID),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(s.magicLinkKey())
+}
+
+// magic links are signed with their own key so they can never be accepted as access tokens
+func (s *AuthService) magicLinkKey() []byte {
+	return []byte(c.LoadConfig().JwtSecret + ":" + magicLinkPurpose)
+}
+
+// builds the link sent to the user
+func (s *AuthService) magicLinkURL(token string) string {
+	link, err := url.Parse(c.LoadConfig().MagicLinkURL)
+	if err != nil {
+		return c.LoadConfig().MagicLinkURL + "?token=" + url.QueryEscape(token)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
@@ -0,0 +1,157 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// grant types supported by the token endpoint
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// registers a new oauth client, returning its secret which is only available at creation
+func (s *AuthService) RegisterClient(req *dtos.OAuthClientCreate) (*dtos.OAuthClientCredentials, *e.Error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate client id", err)
+	}
+	clientID := hex.EncodeToString(idBytes)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to generate client secret", err)
+	}
+
+	//secrets are stored the same way as user passwords
+	hashedSecret, err := s.Hasher.Hash(secret)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to hash client secret", err)
+	}
+
+	client := models.NewOAuthClient(clientID, hashedSecret, req.Name, req.Scopes, req.Audience)
+	client.RedirectURIs = strings.Join(req.RedirectURIs, " ")
+	client.FirstParty = req.FirstParty
+	client.Public = req.Public
+
+	if err := s.AuthRepo.CreateOAuthClient(client); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to store client", err)
+	}
+
+	return dtos.NewOAuthClientCredentials(clientID, secret, client.Name, client.AllowedScopes(), client.Audience, client.AllowedRedirectURIs()), nil
+}
+
+// issues tokens for a request made to the token endpoint based on its grant type
+func (s *AuthService) Token(req *dtos.TokenRequest) (*dtos.TokenResponse, *e.Error) {
+	switch req.GrantType {
+	case GrantTypeClientCredentials:
+		return s.ClientCredentialsToken(req)
+	case GrantTypeAuthorizationCode:
+		return s.AuthorizationCodeToken(req)
+	default:
+		return nil, e.NewError(http.StatusBadRequest, "unsupported_grant_type", fmt.Errorf("grant type %q is not supported", req.GrantType))
+	}
+}
+
+// issues an access token for a service client using the client credentials grant
+func (s *AuthService) ClientCredentialsToken(req *dtos.TokenRequest) (*dtos.TokenResponse, *e.Error) {
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	//default to every scope the client is allowed when none are requested
+	scopes := client.AllowedScopes()
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(client.AllowedScopes(), scope) {
+				return nil, e.NewError(http.StatusBadRequest, "invalid_scope", fmt.Errorf("scope %q is not allowed for this client", scope))
+			}
+		}
+	}
+	scope := strings.Join(scopes, " ")
+
+	duration := c.LoadConfig().AccessTokenTTL
+	accessToken, genErr := s.generateClientJWT(client, scope, duration)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", genErr)
+	}
+
+	return dtos.NewTokenResponse(accessToken, int64(duration.Seconds()), scope), nil
+}
+
+// parses a JWT and ensures it was issued for the given audience
+func (s *AuthService) ParseJWTForAudience(tokenString *string, audience string) (*dtos.CustomClaims, error) {
+	claims := &dtos.CustomClaims{}
+
+	token, err := jwt.ParseWithClaims(*tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(c.LoadConfig().JwtSecret), nil
+	}, s.parserOptions(audience)...)
+
+	if err != nil {
+		return nil, fmt.Errorf("token parse error: %w", err)
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// looks up a client and verifies its secret
+func (s *AuthService) authenticateClient(clientID, clientSecret string) (*models.OAuthClient, *e.Error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, e.NewError(http.StatusUnauthorized, "invalid_client", fmt.Errorf("client credentials are required"))
+	}
+
+	client, err := s.AuthRepo.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusUnauthorized, "invalid_client", fmt.Errorf("unknown client"))
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+
+	if match, err := s.Hasher.Verify(clientSecret, client.SecretHash); err != nil || !match {
+		return nil, e.NewError(http.StatusUnauthorized, "invalid_client", fmt.Errorf("invalid client secret"))
+	}
+
+	return client, nil
+}
+
+// helper function to generate a JWT for a service client
+func (s *AuthService) generateClientJWT(client *models.OAuthClient, scope string, duration time.Duration) (string, error) {
+	claims := dtos.CustomClaims{
+		ClientID:         client.ClientID,
+		Scope:            scope,
+		RegisteredClaims: s.registeredClaims(client.ClientID, client.Audience, duration),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(c.LoadConfig().JwtSecret))
+}
+
+// generates a url safe random string from n random bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,380 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// lifetime of authorization codes and id tokens
+var (
+	authorizationCodeDuration = 1 * time.Minute
+	idTokenDuration           = 15 * time.Minute
+)
+
+// scopes understood by the openid connect provider
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// validates the client and redirect uri of an authentication request, once a client is
+// returned its redirect uri can be trusted and further errors should be sent to it
+func (s *AuthService) ValidateAuthorizeRequest(req *dtos.AuthorizeRequest) (*models.OAuthClient, *e.Error) {
+	client, err := s.AuthRepo.FindOAuthClientByClientID(req.ClientID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusBadRequest, "invalid_client", fmt.Errorf("unknown client"))
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+
+	//redirect uris must match a registered uri exactly
+	if !slices.Contains(client.AllowedRedirectURIs(), req.RedirectURI) {
+		return nil, e.NewError(http.StatusBadRequest, "invalid_request", fmt.Errorf("redirect_uri is not registered for this client"))
+	}
+
+	return client, nil
+}
+
+// checks the remaining parameters of an authentication request for a validated client
+func (s *AuthService) ValidateAuthorizeParams(client *models.OAuthClient, req *dtos.AuthorizeRequest) *e.Error {
+	if req.ResponseType != "code" {
+		return e.NewError(http.StatusBadRequest, "unsupported_response_type", fmt.Errorf("only the code response type is supported"))
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, "openid") {
+		return e.NewError(http.StatusBadRequest, "invalid_scope", fmt.Errorf("the openid scope is required"))
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(oidcScopes, scope) && !slices.Contains(client.AllowedScopes(), scope) {
+			return e.NewError(http.StatusBadRequest, "invalid_scope", fmt.Errorf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	//PKCE is required for every client
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return e.NewError(http.StatusBadRequest, "invalid_request", fmt.Errorf("a S256 code_challenge is required"))
+	}
+
+	//consent screens are not supported yet, so only first party clients may use the flow
+	if !client.FirstParty {
+		return e.NewError(http.StatusForbidden, "consent_required", fmt.Errorf("client requires user consent"))
+	}
+
+	return nil
+}
+
+// issues an authorization code for the user and returns the url to redirect them to
+func (s *AuthService) IssueAuthorizationCode(req *dtos.AuthorizeRequest, userID uint, authTime time.Time) (string, *e.Error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+
+	authCode := &models.AuthorizationCode{
+		CodeHash:            s.hashToken(code),
+		ClientID:            req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            authTime,
+		ExpiresAt:           time.Now().Add(authorizationCodeDuration),
+	}
+
+	if err := s.AuthRepo.CreateAuthorizationCode(authCode); err != nil {
+		return "", e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+
+	return AuthorizeRedirectURL(req, url.Values{"code": {code}})
+}
+
+// builds the redirect back to the client, always echoing the state parameter
+func AuthorizeRedirectURL(req *dtos.AuthorizeRequest, params url.Values) (string, *e.Error) {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return "", e.NewError(http.StatusBadRequest, "invalid_request", err)
+	}
+
+	query := redirect.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	return redirect.String(), nil
+}
+
+// exchanges an authorization code for an access token and id token
+func (s *AuthService) AuthorizationCodeToken(req *dtos.TokenRequest) (*dtos.TokenResponse, *e.Error) {
+	client, err := s.FindClient(req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	//confidential clients must also authenticate with their secret
+	if !client.Public {
+		if _, err := s.authenticateClient(req.ClientID, req.ClientSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	code, repoErr := s.AuthRepo.ConsumeAuthorizationCode(s.hashToken(req.Code))
+	if repoErr != nil {
+		if errors.Is(repoErr, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusBadRequest, "invalid_grant", fmt.Errorf("authorization code is invalid or expired"))
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", repoErr)
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, e.NewError(http.StatusBadRequest, "invalid_grant", fmt.Errorf("authorization code was issued to another client or redirect_uri"))
+	}
+
+	//verify the PKCE code verifier against the challenge sent to the authorization endpoint
+	verifierHash := sha256.Sum256([]byte(req.CodeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(verifierHash[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		return nil, e.NewError(http.StatusBadRequest, "invalid_grant", fmt.Errorf("code_verifier does not match code_challenge"))
+	}
+
+	user, repoErr := s.AuthRepo.FindCredentialByUserID(code.UserID)
+	if repoErr != nil {
+		return nil, e.NewError(http.StatusBadRequest, "invalid_grant", fmt.Errorf("user no longer exists"))
+	}
+	if err := checkStatus(user); err != nil {
+		return nil, e.NewError(http.StatusBadRequest, "invalid_grant", err)
+	}
+
+	duration := c.LoadConfig().AccessTokenTTL
+	//the access token is only meant for the client, so it isn't accepted as a session
+	accessToken, genErr := s.generateScopedJWT(user.ToUserDTO(), code.Scope, client.ClientID, duration)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", genErr)
+	}
+
+	idToken, genErr := s.generateIDToken(user, client.ClientID, code)
+	if genErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", genErr)
+	}
+
+	response := dtos.NewTokenResponse(accessToken, int64(duration.Seconds()), code.Scope)
+	response.IDToken = idToken
+	return response, nil
+}
+
+// looks up a client without authenticating it
+func (s *AuthService) FindClient(clientID string) (*models.OAuthClient, *e.Error) {
+	client, err := s.AuthRepo.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusUnauthorized, "invalid_client", fmt.Errorf("unknown client"))
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+	return client, nil
+}
+
+// parses a bearer token presented to the userinfo endpoint, which accepts sessions as well as the access
+// tokens issued to openid connect clients for their own client id
+func (s *AuthService) ParseAccessToken(tokenString *string) (*dtos.CustomClaims, error) {
+	if claims, err := s.ParseJWT(tokenString); err == nil {
+		return claims, nil
+	}
+
+	//the audience names the client, it's verified by parsing the token again for that client
+	unverified := &dtos.CustomClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(*tokenString, unverified); err != nil {
+		return nil, fmt.Errorf("token parse error: %w", err)
+	}
+	if len(unverified.Audience) != 1 {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if _, err := s.AuthRepo.FindOAuthClientByClientID(unverified.Audience[0]); err != nil {
+		return nil, fmt.Errorf("token was not issued to a client: %w", err)
+	}
+
+	claims, err := s.ParseJWTForAudience(tokenString, unverified.Audience[0])
+	if err != nil {
+		return nil, err
+	}
+	if claims.ClientID != "" || !slices.Contains(strings.Fields(claims.Scope), "openid") {
+		return nil, fmt.Errorf("token was not issued through openid connect")
+	}
+	return claims, nil
+}
+
+// returns the claims about the user an access token was issued for, limited by its scope
+func (s *AuthService) UserInfo(claims *dtos.CustomClaims) (*dtos.UserInfo, *e.Error) {
+	if claims.UserID == 0 {
+		return nil, e.NewError(http.StatusUnauthorized, "invalid_token", fmt.Errorf("token was not issued to a user"))
+	}
+
+	user, err := s.AuthRepo.FindCredentialByUserID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusUnauthorized, "invalid_token", fmt.Errorf("user no longer exists"))
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "server_error", err)
+	}
+
+	info := &dtos.UserInfo{Sub: strconv.FormatUint(uint64(user.UserID), 10)}
+
+	//tokens issued outside of the authorization code flow have no scope and see every claim
+	scopes := strings.Fields(claims.Scope)
+	if claims.Scope == "" || slices.Contains(scopes, "profile") {
+		info.Name = s.profileName(user.UserID)
+	}
+	if claims.Scope == "" || slices.Contains(scopes, "email") {
+		info.Email = user.Email
+	}
+
+	return info, nil
+}
+
+// builds the openid connect discovery document
+func (s *AuthService) Discovery() *dtos.DiscoveryDocument {
+	issuer := c.LoadConfig().Issuer
+
+	return &dtos.DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.SigningMethodRS256.Alg()},
+		ScopesSupported:                   oidcScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "email"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// returns the public keys used to sign id tokens
+func (s *AuthService) JWKS() (*dtos.JWKS, error) {
+	key, kid, err := s.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.JWKS{Keys: []dtos.JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Kid: kid,
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}, nil
+}
+
+// helper function to generate an id token for a user
+func (s *AuthService) generateIDToken(user *models.Credential, audience string, code *models.AuthorizationCode) (string, error) {
+	key, kid, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	claims := dtos.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime.Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    c.LoadConfig().Issuer,
+			Subject:   strconv.FormatUint(uint64(user.UserID), 10),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(idTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	scopes := strings.Fields(code.Scope)
+	if slices.Contains(scopes, "profile") {
+		claims.Name = s.profileName(user.UserID)
+	}
+	if slices.Contains(scopes, "email") {
+		claims.Email = user.Email
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// loads the id token signing key once, generating an ephemeral one when none is configured
+func (s *AuthService) signingKey() (*rsa.PrivateKey, string, error) {
+	s.oidcKeyOnce.Do(func() {
+		path := c.LoadConfig().OIDCSigningKeyFile
+		if path == "" {
+			log.Println("OIDC_SIGNING_KEY_FILE is not set, generating an ephemeral id token signing key")
+			s.oidcKey, s.oidcKeyErr = rsa.GenerateKey(rand.Reader, 2048)
+		} else {
+			s.oidcKey, s.oidcKeyErr = loadRSAKey(path)
+		}
+	})
+
+	if s.oidcKeyErr != nil {
+		return nil, "", s.oidcKeyErr
+	}
+
+	//key id is derived from the public key so it changes whenever the key does
+	der, err := x509.MarshalPKIXPublicKey(&s.oidcKey.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(der)
+	return s.oidcKey, base64.RawURLEncoding.EncodeToString(hash[:12]), nil
+}
+
+// reads a pem encoded rsa private key in either PKCS#1 or PKCS#8 form
+func loadRSAKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem data found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key in %s is not an rsa key", path)
+	}
+	return key, nil
+}
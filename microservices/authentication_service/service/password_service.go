@@ -0,0 +1,65 @@
+package AuthService
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/policy"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// changes a user's password, signing out every session except the one making the change
+func (s *AuthService) ChangePassword(userID uint, req *dtos.PasswordChange, currentRefreshToken string) *e.Error {
+	user, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	//users without a password (signed up through a provider) have nothing to verify against
+	match, err := s.Hasher.Verify(req.CurrentPassword, user.PasswordHash)
+	if err != nil || !match {
+		return e.NewError(http.StatusUnauthorized, "Invalid password", fmt.Errorf("current password mismatch: %v", err))
+	}
+
+	if e := s.validatePassword("new_password", req.NewPassword, s.profileName(user.UserID), user.Email); e != nil {
+		return e
+	}
+
+	hash, err := s.Hasher.Hash(req.NewPassword)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to hash password", err)
+	}
+	if err := s.AuthRepo.UpdateCredentialPassword(user.UserID, hash); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to update password", err)
+	}
+
+	//the current session is only kept when its refresh token really belongs to the user
+	keep := ""
+	if currentRefreshToken != "" {
+		if owner, e := s.ValidateRefreshToken(currentRefreshToken); e == nil && owner.UserID == user.UserID {
+			keep = s.hashToken(currentRefreshToken)
+		}
+	}
+	if err := s.AuthRepo.RevokeOtherTokensByUserID(user.UserID, keep); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to revoke sessions", err)
+	}
+
+	return nil
+}
+
+// checks a new password against the password policy, reporting violations under the given field
+func (s *AuthService) validatePassword(field, password, name, email string) *e.Error {
+	violations, err := s.Policy.Validate(password, policy.User{Name: name, Email: email})
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to check password", err)
+	}
+
+	if len(violations) > 0 {
+		return e.NewValidationError("Password doesn't meet the password policy", map[string][]string{field: violations})
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package AuthService
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/repository"
+	"errors"
+	"net/http"
+)
+
+// scope service clients need to export and erase users' data through the internal api
+const ScopePersonalData = "personal_data"
+
+// ExportUserData gathers everything stored about a user, called by the user service for data export requests
+func (s *AuthService) ExportUserData(userID uint) (*dtos.PersonalData, *e.Error) {
+	data := &dtos.PersonalData{
+		UserID:           userID,
+		Sessions:         []*dtos.Session{},
+		LinkedIdentities: []*dtos.LinkedIdentity{},
+		Passkeys:         []*dtos.WebAuthnCredential{},
+		Impersonations:   []*dtos.ImpersonationSession{},
+		AuditEvents:      []*dtos.AuditEvent{},
+	}
+
+	credential, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get credential", err)
+	}
+	if credential != nil {
+		data.Credential = credential.ToDataDTO()
+	}
+
+	tokens, err := s.AuthRepo.FindRefreshTokensByUserID(userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get sessions", err)
+	}
+	for i := range tokens {
+		data.Sessions = append(data.Sessions, tokens[i].ToSessionDTO())
+	}
+
+	identities, err := s.AuthRepo.FindLinkedIdentitiesByUserID(userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get linked identities", err)
+	}
+	for i := range identities {
+		data.LinkedIdentities = append(data.LinkedIdentities, identities[i].ToDTO())
+	}
+
+	passkeys, err := s.AuthRepo.FindWebAuthnCredentialsByUserID(userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get passkeys", err)
+	}
+	for i := range passkeys {
+		data.Passkeys = append(data.Passkeys, passkeys[i].ToDTO())
+	}
+
+	//only sessions where the user was impersonated, the admin's identity is part of the user's record
+	impersonations, err := s.AuthRepo.FindImpersonationSessions(0, userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get impersonations", err)
+	}
+	for i := range impersonations {
+		data.Impersonations = append(data.Impersonations, impersonations[i].ToDTO())
+	}
+
+	filter := repository.AuditEventFilter{UserID: userID}
+	var afterID uint
+	for {
+		events, err := s.AuthRepo.FindAuditEventsAfter(filter, afterID, auditExportBatchSize)
+		if err != nil {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to get audit events", err)
+		}
+		for i := range events {
+			data.AuditEvents = append(data.AuditEvents, events[i].ToDTO())
+		}
+		if len(events) < auditExportBatchSize {
+			break
+		}
+		afterID = events[len(events)-1].ID
+	}
+
+	return data, nil
+}
+
+// EraseUserData revokes a user's sessions, removes everything stored about them and anonymizes their audit
+// events. Erasing a user who was erased already isn't an error
+func (s *AuthService) EraseUserData(userID uint) *e.Error {
+	credential, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+		return e.NewError(http.StatusInternalServerError, "Failed to get credential", err)
+	}
+	email := ""
+	if credential != nil {
+		email = credential.Email
+	}
+
+	//revoked before anything is removed, so a failed erasure still ends every session
+	if err := s.AuthRepo.RevokeAllTokensByUserID(userID); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to revoke sessions", err)
+	}
+	if err := s.AuthRepo.EraseUserData(userID, email); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to erase user data", err)
+	}
+
+	s.RecordAuditEvent(&dtos.AuditEvent{
+		Type:    dtos.AuditUserErased,
+		UserID:  userID,
+		Method:  "service",
+		Success: true,
+	})
+	return nil
+}
@@ -0,0 +1,64 @@
+package AuthService
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/events"
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// queue group shared by every instance so each event is handled once
+const userEventsQueue = "auth-service"
+
+// subscribes to the user service's events, ending the sessions of deleted users, removing the credentials of purged
+// ones and erasing the data of erased ones
+func (s *AuthService) SubscribeUserEvents(broker events.Broker) error {
+	for _, subject := range []string{events.UserDeleted, events.UserPurged, events.UserErased} {
+		if _, err := broker.Subscribe(subject, userEventsQueue, s.handleUserEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AuthService) handleUserEvent(data []byte) {
+	var event events.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("failed to decode user event: %v", err)
+		return
+	}
+
+	switch event.Type {
+	case events.UserDeleted:
+		s.userDeleted(event.AggregateID)
+	case events.UserPurged:
+		//the user service usually removed the credential already, so an already missing credential isn't an error
+		if err := s.AuthRepo.DeleteCredential(event.AggregateID); err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+			log.Printf("failed to delete credential of purged user %d: %v", event.AggregateID, err)
+		}
+	case events.UserErased:
+		//the user service erased the data here before publishing, this catches erasures that happened while the
+		//auth service was unreachable
+		if err := s.EraseUserData(event.AggregateID); err != nil {
+			log.Printf("failed to erase data of user %d: %v", event.AggregateID, err)
+		}
+	}
+}
+
+// revokes every session of a deleted user. Their credential was deactivated by the user service once the deletion
+// was committed and is kept until they're purged, it isn't changed here since the user may have been restored since
+func (s *AuthService) userDeleted(userID uint) {
+	if err := s.AuthRepo.RevokeAllTokensByUserID(userID); err != nil {
+		log.Printf("failed to revoke sessions of deleted user %d: %v", userID, err)
+		return
+	}
+
+	s.RecordAuditEvent(&dtos.AuditEvent{
+		Type:    dtos.AuditTokensRevoked,
+		UserID:  userID,
+		Success: true,
+		Details: "user deleted",
+	})
+}
@@ -0,0 +1,373 @@
+package AuthService
+
+import (
+	c "authentication-service/config"
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// purposes of a webauthn ceremony session
+const (
+	webAuthnRegistration = "registration"
+	webAuthnLogin        = "login"
+)
+
+// how long a user has to finish a webauthn ceremony
+var webAuthnSessionDuration = 5 * time.Minute
+
+// webAuthnUser adapts a user and their passkeys to what the webauthn library expects
+type webAuthnUser struct {
+	user        *models.Credential
+	name        string
+	credentials []webauthn.Credential
+}
+
+// the user handle is the big endian user id, letting passkey logins identify the user
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.UserID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	if u.name != "" {
+		return u.name
+	}
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// starts registering a new passkey for a user
+func (s *AuthService) BeginPasskeyRegistration(userID uint, req *dtos.WebAuthnRegistrationStart) (*dtos.WebAuthnCeremony, *e.Error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	//the display name is only shown by authenticators when the passkey is created
+	user.name = s.profileName(userID)
+
+	//don't let the same authenticator be registered twice
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, waErr := wa.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if waErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to start passkey registration", waErr)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	sessionID, err := s.storeWebAuthnSession(webAuthnRegistration, userID, name, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.WebAuthnCeremony{SessionID: sessionID, Options: options}, nil
+}
+
+// verifies the authenticator's response and stores the new passkey
+func (s *AuthService) FinishPasskeyRegistration(userID uint, sessionID string, response *protocol.ParsedCredentialCreationData) (*dtos.WebAuthnCredential, *e.Error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, session, err := s.loadWebAuthnSession(webAuthnRegistration, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if stored.UserID != userID {
+		return nil, e.NewError(http.StatusBadRequest, "Registration was started by another user", fmt.Errorf("session user mismatch"))
+	}
+
+	user, _, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, waErr := wa.CreateCredential(user, *session, response)
+	if waErr != nil {
+		return nil, e.NewError(http.StatusBadRequest, "Failed to verify passkey", waErr)
+	}
+
+	data, jsonErr := json.Marshal(credential)
+	if jsonErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to store passkey", jsonErr)
+	}
+
+	record := &models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		Name:         stored.CredentialName,
+		Data:         string(data),
+	}
+	if err := s.AuthRepo.CreateWebAuthnCredential(record); err != nil {
+		return nil, e.NewError(http.StatusConflict, "Failed to store passkey, it may already be registered", err)
+	}
+
+	return record.ToDTO(), nil
+}
+
+// starts a passkey login, limited to the user's passkeys when an email is given
+func (s *AuthService) BeginPasskeyLogin(req *dtos.WebAuthnLoginStart) (*dtos.WebAuthnCeremony, *e.Error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		options *protocol.CredentialAssertion
+		session *webauthn.SessionData
+		waErr   error
+		userID  uint
+	)
+
+	if req.Email == "" {
+		options, session, waErr = wa.BeginDiscoverableLogin()
+	} else {
+		existing, repoErr := s.AuthRepo.FindCredentialByEmail(req.Email)
+		if repoErr != nil {
+			if errors.Is(repoErr, e.ErrRecordNotFound) {
+				return nil, e.NewError(http.StatusNotFound, "No passkeys are registered for this email", repoErr)
+			}
+			return nil, e.NewError(http.StatusInternalServerError, "An error occurred when fetching the user", repoErr)
+		}
+
+		user, _, err := s.loadWebAuthnUser(existing.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if len(user.credentials) == 0 {
+			return nil, e.NewError(http.StatusNotFound, "No passkeys are registered for this email", fmt.Errorf("user has no passkeys"))
+		}
+
+		userID = existing.UserID
+		options, session, waErr = wa.BeginLogin(user)
+	}
+
+	if waErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to start passkey login", waErr)
+	}
+
+	sessionID, err := s.storeWebAuthnSession(webAuthnLogin, userID, "", session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.WebAuthnCeremony{SessionID: sessionID, Options: options}, nil
+}
+
+// verifies a passkey assertion and logs the user in with the same token pair as UserLogin
+func (s *AuthService) FinishPasskeyLogin(sessionID string, response *protocol.ParsedCredentialAssertionData) (*dtos.UserLoginResponse, *e.Error) {
+	wa, err := s.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, session, err := s.loadWebAuthnSession(webAuthnLogin, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		user       *webAuthnUser
+		records    []models.WebAuthnCredential
+		credential *webauthn.Credential
+		waErr      error
+	)
+
+	if stored.UserID != 0 {
+		user, records, err = s.loadWebAuthnUser(stored.UserID)
+		if err != nil {
+			return nil, err
+		}
+		credential, waErr = wa.ValidateLogin(user, *session, response)
+	} else {
+		//the user is identified by the user handle stored on the authenticator
+		credential, waErr = wa.ValidateDiscoverableLogin(func(rawID, handle []byte) (webauthn.User, error) {
+			if len(handle) != 8 {
+				return nil, fmt.Errorf("invalid user handle")
+			}
+			var loadErr *e.Error
+			user, records, loadErr = s.loadWebAuthnUser(uint(binary.BigEndian.Uint64(handle)))
+			if loadErr != nil {
+				return nil, loadErr
+			}
+			return user, nil
+		}, *session, response)
+	}
+
+	if waErr != nil {
+		return nil, e.NewError(http.StatusUnauthorized, "Failed to verify passkey", waErr)
+	}
+
+	//keep the stored sign count up to date so cloned authenticators can be detected
+	for i := range records {
+		if string(records[i].CredentialID) != string(credential.ID) {
+			continue
+		}
+		if credential.Authenticator.CloneWarning {
+			return nil, e.NewError(http.StatusUnauthorized, "Passkey may have been cloned", fmt.Errorf("sign count did not increase"))
+		}
+
+		data, jsonErr := json.Marshal(credential)
+		if jsonErr != nil {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to update passkey", jsonErr)
+		}
+		now := time.Now()
+		records[i].Data = string(data)
+		records[i].LastUsedAt = &now
+		if err := s.AuthRepo.UpdateWebAuthnCredential(&records[i]); err != nil {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to update passkey", err)
+		}
+	}
+
+	return s.createSession(user.user)
+}
+
+// lists the passkeys registered by a user
+func (s *AuthService) ListPasskeys(userID uint) ([]*dtos.WebAuthnCredential, *e.Error) {
+	records, err := s.AuthRepo.FindWebAuthnCredentialsByUserID(userID)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get passkeys", err)
+	}
+
+	result := []*dtos.WebAuthnCredential{}
+	for i := range records {
+		result = append(result, records[i].ToDTO())
+	}
+	return result, nil
+}
+
+// removes one of a user's passkeys
+func (s *AuthService) DeletePasskey(userID, id uint) *e.Error {
+	if err := s.AuthRepo.DeleteWebAuthnCredential(userID, id); err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return e.NewError(http.StatusNotFound, "Passkey doesn't exist", err)
+		}
+		return e.NewError(http.StatusInternalServerError, "Failed to delete passkey", err)
+	}
+	return nil
+}
+
+// loads a user along with their passkeys
+func (s *AuthService) loadWebAuthnUser(userID uint) (*webAuthnUser, []models.WebAuthnCredential, *e.Error) {
+	user, err := s.AuthRepo.FindCredentialByUserID(userID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, nil, e.NewError(http.StatusNotFound, "User Doesn't exist", e.ErrNotFound)
+		}
+		return nil, nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	records, err := s.AuthRepo.FindWebAuthnCredentialsByUserID(userID)
+	if err != nil {
+		return nil, nil, e.NewError(http.StatusInternalServerError, "Failed to get passkeys", err)
+	}
+
+	credentials := []webauthn.Credential{}
+	for _, record := range records {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(record.Data), &credential); err != nil {
+			return nil, nil, e.NewError(http.StatusInternalServerError, "Failed to read passkey", err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, records, nil
+}
+
+// stores ceremony session data, returning the id the client sends back when finishing
+func (s *AuthService) storeWebAuthnSession(purpose string, userID uint, name string, session *webauthn.SessionData) (string, *e.Error) {
+	sessionID, err := randomToken(32)
+	if err != nil {
+		return "", e.NewError(http.StatusInternalServerError, "Failed to generate session", err)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", e.NewError(http.StatusInternalServerError, "Failed to store session", err)
+	}
+
+	record := &models.WebAuthnSession{
+		SessionHash:    s.hashToken(sessionID),
+		Purpose:        purpose,
+		UserID:         userID,
+		CredentialName: name,
+		Data:           string(data),
+		ExpiresAt:      time.Now().Add(webAuthnSessionDuration),
+	}
+	if err := s.AuthRepo.CreateWebAuthnSession(record); err != nil {
+		return "", e.NewError(http.StatusInternalServerError, "Failed to store session", err)
+	}
+
+	return sessionID, nil
+}
+
+// loads and removes ceremony session data
+func (s *AuthService) loadWebAuthnSession(purpose, sessionID string) (*models.WebAuthnSession, *webauthn.SessionData, *e.Error) {
+	stored, err := s.AuthRepo.ConsumeWebAuthnSession(s.hashToken(sessionID), purpose)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, nil, e.NewError(http.StatusBadRequest, "Session is invalid or expired", err)
+		}
+		return nil, nil, e.NewError(http.StatusInternalServerError, "Failed to load session", err)
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(stored.Data), &session); err != nil {
+		return nil, nil, e.NewError(http.StatusInternalServerError, "Failed to load session", err)
+	}
+
+	return stored, &session, nil
+}
+
+// creates the relying party from config
+func (s *AuthService) webAuthn() (*webauthn.WebAuthn, *e.Error) {
+	conf := c.LoadConfig()
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          conf.WebAuthnRPID,
+		RPDisplayName: conf.WebAuthnRPName,
+		RPOrigins:     conf.WebAuthnOrigins,
+	})
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Passkeys are not configured correctly", err)
+	}
+	return wa, nil
+}
+
+// encodes a user id as a webauthn user handle
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoginsAreAudited(t *testing.T) {
+	router, authService := setupRouter(t)
+	admin := createUser(t, authService, "Support", "support@example.com", "password123")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	makeAdmin(t, router, admin.UserID)
+	adminToken := loginUser(t, router, "support@example.com", "password123")
+
+	for _, password := range []string{"wrong password", "password123"} {
+		body, _ := json.Marshal(dtos.UserLogin{Email: "jane@example.com", Password: password})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "audit-test")
+		req.Header.Set("X-Request-ID", "request-"+password)
+		router.ServeHTTP(w, req)
+
+		if w.Header().Get("X-Request-ID") != "request-"+password {
+			t.Errorf("Expected request id to be echoed, got '%s'", w.Header().Get("X-Request-ID"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/audit-events?type=login.failed", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var page dtos.AuditEventPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Total != 1 || page.Events[0].Email != "jane@example.com" || page.Events[0].UserAgent != "audit-test" ||
+		page.Events[0].RequestID != "request-wrong password" {
+		t.Errorf("Expected the failed login to be recorded, got %s", w.Body.String())
+	}
+
+	//export everything for the user as json lines, oldest first
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/auth/audit-events/export?user_id=%d", user.UserID), nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Expected json lines, got '%s'", w.Header().Get("Content-Type"))
+	}
+
+	var types []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event dtos.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Couldn't parse exported line: %v\n", err)
+		}
+		types = append(types, event.Type)
+	}
+	//the failed login is for an email, only the successful one is tied to the user
+	if len(types) != 1 || types[0] != dtos.AuditLoginSucceeded {
+		t.Errorf("Expected one successful login for the user, got %v", types)
+	}
+}
+
+func TestAuditLogRequiresAdmin(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+
+	for _, path := range []string{"/auth/audit-events", "/auth/audit-events/export"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusForbidden, path, w.Code)
+		}
+	}
+}
+
+func TestAuditEventsAreTruncatedToTheirColumns(t *testing.T) {
+	router, authService := setupRouter(t)
+	admin := createUser(t, authService, "Support", "support@example.com", "password123")
+	makeAdmin(t, router, admin.UserID)
+	adminToken := loginUser(t, router, "support@example.com", "password123")
+
+	//strict databases reject overlong values, which would keep the failed login out of the log
+	body, _ := json.Marshal(dtos.UserLogin{Email: "jane@example.com", Password: "wrong password"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", strings.Repeat("ü", 2000))
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/audit-events?type=login.failed", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	router.ServeHTTP(w, req)
+
+	var page dtos.AuditEventPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Total != 1 || page.Events[0].UserAgent != strings.Repeat("ü", 512) {
+		t.Errorf("Expected the user agent to be cut to 512 characters, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"authentication-service/controller"
+	"authentication-service/dtos"
+	"authentication-service/models"
+	"authentication-service/repository"
+	authservice "authentication-service/service"
+	"authentication-service/userclient"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testAdminKey = "test-admin-key"
+
+func setupRouter(t *testing.T) (*gin.Engine, *authservice.AuthService) {
+	// Switch to test mode
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("ADMIN_API_KEY", testAdminKey)
+	//keep argon2id cheap so tests stay fast
+	t.Setenv("ARGON2_MEMORY_KB", "1024")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+
+	// use a fresh in memory database for every test
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Couldn't open database: %v\n", err)
+	}
+
+	r := gin.Default()
+	authService := authservice.NewAuthService(repository.NewMysqlAuthRepository(db))
+	authService.Users = newFakeDirectory()
+	authController := controller.NewAuthController(authService)
+	authController.DefineRoutes(r)
+	return r, authService
+}
+
+// fakeDirectory stands in for the user service's profiles
+type fakeDirectory struct {
+	mu    sync.Mutex
+	users map[uint]*dtos.User
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{users: map[uint]*dtos.User{}}
+}
+
+func (d *fakeDirectory) GetUser(id uint) (*dtos.User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if user, ok := d.users[id]; ok {
+		return user, nil
+	}
+	return nil, userclient.ErrUserNotFound
+}
+
+func (d *fakeDirectory) CreateUser(name, email string) (*dtos.User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, user := range d.users {
+		if user.Email == email {
+			return nil, userclient.ErrUserExists
+		}
+	}
+	user := dtos.NewUser(uint(len(d.users)+1), name, email)
+	d.users[user.Id] = user
+	return user, nil
+}
+
+func (d *fakeDirectory) DeleteUser(id uint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.users[id]; !ok {
+		return userclient.ErrUserNotFound
+	}
+	delete(d.users, id)
+	return nil
+}
+
+// creates a profile in the fake user service and stores its credential, as the user service would through the internal api
+func createUser(t *testing.T, authService *authservice.AuthService, name, email, password string) *models.Credential {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Couldn't hash password: %v\n", err)
+	}
+
+	profile, err := authService.Users.CreateUser(name, email)
+	if err != nil {
+		t.Fatalf("Couldn't create profile: %v\n", err)
+	}
+
+	credential := models.NewCredential(profile.Id, email, string(hash))
+	if err := authService.AuthRepo.CreateCredential(credential); err != nil {
+		t.Fatalf("Couldn't create user: %v\n", err)
+	}
+	return credential
+}
+
+func TestHealth(t *testing.T) {
+	router, _ := setupRouter(t)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/auth/health", nil)
+	if err != nil {
+		t.Fatalf("Couldn't create request: %v\n", err)
+	}
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+
+	expectedResponse := "This is the auth service"
+	if response != expectedResponse {
+		t.Errorf("Expected response body '%s', got '%s'", expectedResponse, response)
+	}
+}
+
+// registers an oauth client through the api
+func registerClient(t *testing.T, router *gin.Engine, body string) *dtos.OAuthClientCredentials {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/oauth/clients", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Key", testAdminKey)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var credentials dtos.OAuthClientCredentials
+	if err := json.Unmarshal(w.Body.Bytes(), &credentials); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+	return &credentials
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	router, authService := setupRouter(t)
+	client := registerClient(t, router, `{"name":"inventory","scopes":["users:read","users:write"],"audience":"user-service"}`)
+
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var token dtos.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+	if token.Scope != "users:read" {
+		t.Errorf("Expected scope 'users:read', got '%s'", token.Scope)
+	}
+
+	claims, err := authService.ParseJWTForAudience(&token.AccessToken, "user-service")
+	if err != nil {
+		t.Fatalf("Expected token to be valid for its audience: %v", err)
+	}
+	if claims.ClientID != client.ClientID {
+		t.Errorf("Expected client id '%s', got '%s'", client.ClientID, claims.ClientID)
+	}
+
+	if _, err := authService.ParseJWTForAudience(&token.AccessToken, "inventory-service"); err == nil {
+		t.Errorf("Expected token to be rejected for another audience")
+	}
+}
+
+func TestClientCredentialsGrantRejectsBadSecret(t *testing.T) {
+	router, _ := setupRouter(t)
+	client := registerClient(t, router, `{"name":"inventory","scopes":["users:read"],"audience":"user-service"}`)
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client.ClientID},
+		"client_secret": {"not-the-secret"},
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	var oauthErr dtos.OAuthError
+	if err := json.Unmarshal(w.Body.Bytes(), &oauthErr); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+	if oauthErr.Error != "invalid_client" {
+		t.Errorf("Expected error 'invalid_client', got '%s'", oauthErr.Error)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"authentication-service/models"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func putCredentialStatus(router *gin.Engine, token, userID, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/auth/internal/credentials/"+userID+"/status", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSuspendedUsersCannotGetTokens(t *testing.T) {
+	router, authService := setupRouter(t)
+	token := serviceToken(t, router, `["credentials:write"]`, "auth-service")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	cookies := loginCookies(t, router, "jane@example.com", "password123")
+
+	userID := strconv.FormatUint(uint64(user.UserID), 10)
+	w := putCredentialStatus(router, token, userID, `{"status":"suspended","reason":"chargeback"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	//the session was revoked with the suspension
+	w = cookieRequest(router, "POST", "/auth/refresh", cookies, cookies["csrf_token"].Value, "")
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected refresh to fail for a suspended user, got %d", w.Code)
+	}
+	if cookies := loginCookies(t, router, "jane@example.com", "password123"); cookies["refresh_token"] != nil {
+		t.Errorf("Expected login to fail for a suspended user")
+	}
+
+	if w := putCredentialStatus(router, token, userID, `{"status":"active"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	loginUser(t, router, "jane@example.com", "password123")
+
+	for _, body := range []string{`{"status":"banned"}`, `{}`} {
+		if w := putCredentialStatus(router, token, userID, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+	if w := putCredentialStatus(router, token, "99", `{"status":"suspended"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown user, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRefreshRevokesSessionsOfInactiveUsers(t *testing.T) {
+	router, authService := setupRouter(t)
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	cookies := loginCookies(t, router, "jane@example.com", "password123")
+
+	//a session left over from before the user was deactivated
+	if err := authService.AuthRepo.UpdateCredentialStatus(user.UserID, models.StatusDeactivated); err != nil {
+		t.Fatalf("Couldn't update status: %v", err)
+	}
+
+	w := cookieRequest(router, "POST", "/auth/refresh", cookies, cookies["csrf_token"].Value, "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	if _, err := authService.AuthRepo.FindTokenByUserID(user.UserID); err == nil {
+		t.Errorf("Expected the refresh token to be revoked")
+	}
+}
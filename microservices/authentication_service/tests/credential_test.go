@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// gets a client credentials token for a client registered with the given scopes and audience
+func serviceToken(t *testing.T, router *gin.Engine, scopes, audience string) string {
+	client := registerClient(t, router, `{"name":"user-service","scopes":`+scopes+`,"audience":"`+audience+`"}`)
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ClientID, client.ClientSecret)
+	router.ServeHTTP(w, req)
+
+	var token dtos.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &token)
+	return token.AccessToken
+}
+
+func putCredential(router *gin.Engine, token, userID, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/auth/internal/credentials/"+userID, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestInternalCredentialsAPI(t *testing.T) {
+	router, _ := setupRouter(t)
+	token := serviceToken(t, router, `["credentials:write"]`, "auth-service")
+
+	w := putCredential(router, token, "7", `{"email":"jane@example.com","name":"Jane","password":"correct horse battery"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	loginUser(t, router, "jane@example.com", "correct horse battery")
+
+	//changing only the email keeps the password
+	w = putCredential(router, token, "7", `{"email":"jane.doe@example.com"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	loginUser(t, router, "jane.doe@example.com", "correct horse battery")
+
+	//passwords are checked against the policy
+	w = putCredential(router, token, "7", `{"email":"jane.doe@example.com","name":"Jane","password":"short"}`)
+	var errorBody struct{ Fields map[string][]string }
+	json.Unmarshal(w.Body.Bytes(), &errorBody)
+	if w.Code != http.StatusBadRequest || len(errorBody.Fields["password"]) == 0 {
+		t.Errorf("Expected a policy violation for password, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//another user's email can't be taken
+	w = putCredential(router, token, "8", `{"email":"jane.doe@example.com","password":"correct horse battery"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	//deleting the credential stops the user from logging in
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/auth/internal/credentials/7", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	body, _ := json.Marshal(dtos.UserLogin{Email: "jane.doe@example.com", Password: "correct horse battery"})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted user to be unknown, got %d", w.Code)
+	}
+}
+
+func TestInternalCredentialsAPIAppliesPolicy(t *testing.T) {
+	sum := sha1.Sum([]byte("Tr0ub4dor&3"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "0000000000000000000000000000000000000000:1\n" + hex.EncodeToString(sum[:]) + ":42\n"
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatalf("Couldn't write hash list: %v\n", err)
+	}
+	t.Setenv("BREACHED_PASSWORDS_FILE", path)
+	t.Setenv("PASSWORD_MIN_CHARACTER_CLASSES", "3")
+	router, _ := setupRouter(t)
+	token := serviceToken(t, router, `["credentials:write"]`, "auth-service")
+
+	var errorBody struct{ Fields map[string][]string }
+	w := putCredential(router, token, "7", `{"email":"jane@example.com","name":"Jane Doe","password":"janeeee1"}`)
+	json.Unmarshal(w.Body.Bytes(), &errorBody)
+	//too few character classes, too many repeats and contains the name
+	if w.Code != http.StatusBadRequest || len(errorBody.Fields["password"]) != 3 {
+		t.Errorf("Expected 3 password violations, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = putCredential(router, token, "7", `{"email":"jane@example.com","name":"Jane","password":"Tr0ub4dor&3"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a breached password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = putCredential(router, token, "7", `{"email":"jane@example.com","name":"Jane","password":"Correct Horse Battery 9"}`)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+func TestInternalCredentialsAPIRequiresScope(t *testing.T) {
+	router, _ := setupRouter(t)
+	body := `{"email":"jane@example.com","password":"correct horse battery"}`
+
+	//tokens for another audience are rejected
+	token := serviceToken(t, router, `["credentials:write"]`, "user-service")
+	if w := putCredential(router, token, "7", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	//as are tokens without the scope
+	token = serviceToken(t, router, `["users:read"]`, "auth-service")
+	if w := putCredential(router, token, "7", body); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestLegacyUsersAreMigrated(t *testing.T) {
+	//a users table left behind from when the auth service shared the user service's table
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Couldn't open database: %v\n", err)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	db.Exec("CREATE TABLE users (id integer primary key, name text, email text unique, password text)")
+	db.Exec("INSERT INTO users (id, name, email, password) VALUES (42, 'Jane', 'jane@example.com', ?)", string(hash))
+
+	router, authService := setupRouter(t)
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+
+	claims, err := authService.ParseJWT(&accessToken)
+	if err != nil || claims.UserID != 42 || claims.Role != "user" {
+		t.Errorf("Expected a token for legacy user 42, got %+v (%v)", claims, err)
+	}
+}
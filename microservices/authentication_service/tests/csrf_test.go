@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// logs in and returns the session cookies by name
+func loginCookies(t *testing.T, router http.Handler, email, password string) map[string]*http.Cookie {
+	body, _ := json.Marshal(dtos.UserLogin{Email: email, Password: password})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+// sends a request carrying the session cookies, with optional csrf and origin headers
+func cookieRequest(router http.Handler, method, path string, cookies map[string]*http.Cookie, csrfToken, origin string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Host = "auth.example.com"
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCookieEndpointsRequireCSRFToken(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	cookies := loginCookies(t, router, "jane@example.com", "password123")
+
+	if cookies["refresh_token"].SameSite != http.SameSiteLaxMode || cookies["csrf_token"] == nil {
+		t.Fatalf("Expected a SameSite=Lax refresh cookie and a csrf cookie, got %v", cookies)
+	}
+	csrfToken := cookies["csrf_token"].Value
+
+	w := cookieRequest(router, "POST", "/auth/refresh", cookies, "", "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected refresh without csrf token to be rejected, got %d", w.Code)
+	}
+
+	w = cookieRequest(router, "POST", "/auth/refresh", cookies, csrfToken, "https://evil.example.com")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected cross site refresh to be rejected, got %d", w.Code)
+	}
+
+	w = cookieRequest(router, "POST", "/auth/refresh", cookies, csrfToken, "https://auth.example.com")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected refresh with csrf token to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//the old GET endpoint still works but is marked as deprecated
+	w = cookieRequest(router, "GET", "/auth/refresh", cookies, "", "")
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected deprecated refresh to succeed, got %d with Deprecation '%s'", w.Code, w.Header().Get("Deprecation"))
+	}
+
+	w = cookieRequest(router, "POST", "/auth/logout", cookies, "", "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected logout without csrf token to be rejected, got %d", w.Code)
+	}
+
+	w = cookieRequest(router, "POST", "/auth/logout", cookies, csrfToken, "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected logout with csrf token to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTrustedOriginsAndSameSite(t *testing.T) {
+	t.Setenv("COOKIE_SAMESITE", "strict")
+	t.Setenv("CSRF_TRUSTED_ORIGINS", "https://app.example.com")
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	cookies := loginCookies(t, router, "jane@example.com", "password123")
+
+	if cookies["refresh_token"].SameSite != http.SameSiteStrictMode {
+		t.Errorf("Expected a SameSite=Strict refresh cookie")
+	}
+
+	w := cookieRequest(router, "POST", "/auth/refresh", cookies, cookies["csrf_token"].Value, "https://app.example.com")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected refresh from a trusted origin to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
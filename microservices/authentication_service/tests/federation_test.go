@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"authentication-service/models"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP is a minimal openid connect provider used to test federated login
+type stubIdP struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	nonce   string
+	subject string
+	email   string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v\n", err)
+	}
+	idp := &stubIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            "auth-service",
+			"sub":            idp.subject,
+			"email":          idp.email,
+			"email_verified": true,
+			"name":           "Stub User",
+			"nonce":          idp.nonce,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "stub"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	t.Setenv("OIDC_PROVIDERS", "stub")
+	t.Setenv("OIDC_STUB_ISSUER", idp.server.URL)
+	t.Setenv("OIDC_STUB_CLIENT_ID", "auth-service")
+	t.Setenv("OIDC_STUB_CLIENT_SECRET", "stub-secret")
+	return idp
+}
+
+// follows the authorization url to the stub, returning the state to send to the callback
+func (idp *stubIdP) authorize(t *testing.T, authorizationURL string) string {
+	location, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatalf("Couldn't parse authorization url: %v\n", err)
+	}
+	idp.nonce = location.Query().Get("nonce")
+	return location.Query().Get("state")
+}
+
+// the cookie binding a login with a provider to the browser that started it
+func federationStateCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "federation_state" {
+			return cookie
+		}
+	}
+	t.Fatalf("Expected a federation_state cookie")
+	return nil
+}
+
+// calls the callback with the state returned by the stub, sending the cookie when it's set
+func federationCallback(router *gin.Engine, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/federation/stub/callback?code=abc&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// logs in with a password and returns the access token
+func loginUser(t *testing.T, router *gin.Engine, email, password string) string {
+	body, _ := json.Marshal(dtos.UserLogin{Email: email, Password: password})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response dtos.RefreshResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.AccessToken
+}
+
+func TestFederatedLoginCreatesUser(t *testing.T) {
+	router, _ := setupRouter(t)
+	idp := newStubIdP(t)
+	idp.subject, idp.email = "stub-123", "new@example.com"
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/federation/stub/login", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+	state := idp.authorize(t, w.Header().Get("Location"))
+	cookie := federationStateCookie(t, w)
+
+	//the callback only completes in the browser that started the login
+	if w = federationCallback(router, state, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a callback without the state cookie to be rejected, got %d", w.Code)
+	}
+
+	w = federationCallback(router, state, cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response dtos.RefreshResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	//the new user can list their linked identity
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/identities", nil)
+	req.Header.Set("Authorization", "Bearer "+response.AccessToken)
+	router.ServeHTTP(w, req)
+
+	var identities []dtos.LinkedIdentity
+	json.Unmarshal(w.Body.Bytes(), &identities)
+	if len(identities) != 1 || identities[0].Provider != "stub" {
+		t.Fatalf("Expected one stub identity, got %s", w.Body.String())
+	}
+
+	//states can't be replayed
+	if w = federationCallback(router, state, cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected replayed state to be rejected, got %d", w.Code)
+	}
+}
+
+func TestFederatedLoginDoesNotTakeOverExistingEmail(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	idp := newStubIdP(t)
+	idp.subject, idp.email = "stub-456", "jane@example.com"
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/federation/stub/login", nil)
+	router.ServeHTTP(w, req)
+	state := idp.authorize(t, w.Header().Get("Location"))
+
+	w = federationCallback(router, state, federationStateCookie(t, w))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+}
+
+func TestLinkAndUnlinkIdentity(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	idp := newStubIdP(t)
+	idp.subject, idp.email = "stub-789", "jane.personal@example.com"
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/identities/stub/link", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var redirect dtos.FederationRedirect
+	json.Unmarshal(w.Body.Bytes(), &redirect)
+	state := idp.authorize(t, redirect.AuthorizationURL)
+
+	w = federationCallback(router, state, federationStateCookie(t, w))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/auth/identities/stub", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+func TestFederatedSignUpRemovesProfileWhenCredentialFails(t *testing.T) {
+	router, authService := setupRouter(t)
+	idp := newStubIdP(t)
+	idp.subject, idp.email = "stub-321", "new@example.com"
+
+	//a credential without a profile takes the id the fake user service hands out next
+	if err := authService.AuthRepo.CreateCredential(models.NewCredential(1, "orphan@example.com", "")); err != nil {
+		t.Fatalf("Couldn't create credential: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/federation/stub/login", nil)
+	router.ServeHTTP(w, req)
+	state := idp.authorize(t, w.Header().Get("Location"))
+
+	if w = federationCallback(router, state, federationStateCookie(t, w)); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+	if _, err := authService.Users.GetUser(1); err == nil {
+		t.Errorf("Expected the profile created for the failed sign up to be removed")
+	}
+}
+
+func TestFederatedSignUpRemovesCredentialAndProfileWhenLinkingFails(t *testing.T) {
+	router, authService := setupRouter(t)
+	idp := newStubIdP(t)
+	idp.subject, idp.email = "stub-654", "new@example.com"
+
+	//a stale identity for the id the fake user service hands out next makes linking the new one fail
+	if err := authService.AuthRepo.CreateLinkedIdentity(models.NewLinkedIdentity(1, "stub", "stub-stale", "stale@example.com")); err != nil {
+		t.Fatalf("Couldn't create linked identity: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/federation/stub/login", nil)
+	router.ServeHTTP(w, req)
+	state := idp.authorize(t, w.Header().Get("Location"))
+
+	if w = federationCallback(router, state, federationStateCookie(t, w)); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if _, err := authService.AuthRepo.FindCredentialByUserID(1); err == nil {
+		t.Errorf("Expected the credential created for the failed sign up to be removed")
+	}
+	if _, err := authService.Users.GetUser(1); err == nil {
+		t.Errorf("Expected the profile created for the failed sign up to be removed")
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"authentication-service/hashing"
+	"authentication-service/models"
+	"authentication-service/repository"
+	"strings"
+	"testing"
+)
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hasher := hashing.NewArgon2idHasher(1024, 1, 1)
+
+	//longer than bcrypt's 72 byte limit
+	password := strings.Repeat("long password ", 10)
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Couldn't hash password: %v\n", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected a PHC formatted argon2id hash, got '%s'", hash)
+	}
+
+	if match, err := hasher.Verify(password, hash); err != nil || !match {
+		t.Errorf("Expected password to match its hash, got %v", err)
+	}
+	if match, _ := hasher.Verify("wrong password", hash); match {
+		t.Errorf("Expected wrong password not to match")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("Expected hash with current parameters not to need a rehash")
+	}
+	if !hashing.NewArgon2idHasher(2048, 1, 1).NeedsRehash(hash) {
+		t.Errorf("Expected hash with less memory to need a rehash")
+	}
+}
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	router, authService := setupRouter(t)
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+
+	loginUser(t, router, "jane@example.com", "password123")
+
+	var stored models.Credential
+	authService.AuthRepo.(repository.MysqlAuthRepository).DB.First(&stored, user.UserID)
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Fatalf("Expected bcrypt hash to be replaced with argon2id, got '%s'", stored.PasswordHash)
+	}
+
+	//the upgraded hash still logs the user in
+	loginUser(t, router, "jane@example.com", "password123")
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requests an impersonation token for the target user
+func impersonate(router *gin.Engine, accessToken string, userID uint) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/auth/impersonate/%d", userID), bytes.NewBufferString(`{"reason":"ticket 42"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// grants a user the admin role through the admin api
+func makeAdmin(t *testing.T, router *gin.Engine, userID uint) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/auth/users/%d/role", userID), bytes.NewBufferString(`{"role":"admin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Key", testAdminKey)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+func TestAdminImpersonation(t *testing.T) {
+	router, authService := setupRouter(t)
+	admin := createUser(t, authService, "Support", "support@example.com", "password123")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	makeAdmin(t, router, admin.UserID)
+	adminToken := loginUser(t, router, "support@example.com", "password123")
+
+	w := impersonate(router, adminToken, user.UserID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var response dtos.ImpersonationResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	claims, err := authService.ParseJWT(&response.AccessToken)
+	if err != nil {
+		t.Fatalf("Couldn't parse impersonation token: %v\n", err)
+	}
+	if claims.UserID != user.UserID || claims.Act == nil || claims.Act.UserID != admin.UserID {
+		t.Errorf("Expected token for user %d acted on by %d, got %+v", user.UserID, admin.UserID, claims)
+	}
+
+	//downstream services checking the token see who is really acting
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/", nil)
+	req.Header.Set("Authorization", "Bearer "+response.AccessToken)
+	router.ServeHTTP(w, req)
+	if w.Header().Get("X-Impersonated-By") != fmt.Sprint(admin.UserID) {
+		t.Errorf("Expected X-Impersonated-By to be %d, got '%s'", admin.UserID, w.Header().Get("X-Impersonated-By"))
+	}
+
+	//impersonation tokens can't change the user's credentials
+	w = changePassword(router, response.AccessToken, nil, "password123", "a new passphrase")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	//or remove the user's ways to sign in
+	for _, path := range []string{"/auth/webauthn/credentials/1", "/auth/identities/stub"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("DELETE", path, nil)
+		req.Header.Set("Authorization", "Bearer "+response.AccessToken)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d for DELETE %s, got %d: %s", http.StatusForbidden, path, w.Code, w.Body.String())
+		}
+	}
+
+	//the session is in the audit log
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/auth/impersonations?user_id=%d", user.UserID), nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	router.ServeHTTP(w, req)
+
+	var sessions []dtos.ImpersonationSession
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 1 || sessions[0].ActorID != admin.UserID || sessions[0].Reason != "ticket 42" {
+		t.Errorf("Expected one audited session, got %s", w.Body.String())
+	}
+}
+
+func TestImpersonationRequiresAdmin(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Mallory", "mallory@example.com", "password123")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	accessToken := loginUser(t, router, "mallory@example.com", "password123")
+
+	w := impersonate(router, accessToken, user.UserID)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+
+	//admins can't be impersonated
+	admin := createUser(t, authService, "Support", "support@example.com", "password123")
+	makeAdmin(t, router, admin.UserID)
+	makeAdmin(t, router, user.UserID)
+	adminToken := loginUser(t, router, "support@example.com", "password123")
+
+	w = impersonate(router, adminToken, user.UserID)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureMailer keeps sent emails in memory
+type captureMailer struct {
+	sent []string
+}
+
+func (m *captureMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, body)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+func requestMagicLink(router *gin.Engine, email string) int {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/magic-link", bytes.NewBufferString(`{"email":"`+email+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	router, authService := setupRouter(t)
+	//emails match whatever their case, even on databases comparing them case sensitively
+	createUser(t, authService, "Jane", "Jane@Example.com", "password123")
+	mailer := &captureMailer{}
+	authService.Mailer = mailer
+
+	if code := requestMagicLink(router, "jane@example.com"); code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, code)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("Expected one email to be sent, got %d", len(mailer.sent))
+	}
+
+	link, err := url.Parse(linkPattern.FindString(mailer.sent[0]))
+	if err != nil {
+		t.Fatalf("Couldn't parse link from email: %v\n", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/magic-link/callback?"+link.RawQuery, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !slices.ContainsFunc(w.Result().Cookies(), func(cookie *http.Cookie) bool { return cookie.Name == "refresh_token" }) {
+		t.Errorf("Expected refresh_token cookie to be set")
+	}
+
+	//links are single use
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/magic-link/callback?"+link.RawQuery, nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected reused link to be rejected, got %d", w.Code)
+	}
+}
+
+func TestMagicLinkUnknownEmailAndRateLimit(t *testing.T) {
+	router, authService := setupRouter(t)
+	mailer := &captureMailer{}
+	authService.Mailer = mailer
+
+	//unknown emails get the same response but no email
+	for i := 0; i < 3; i++ {
+		if code := requestMagicLink(router, "nobody@example.com"); code != http.StatusAccepted {
+			t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, code)
+		}
+	}
+	if len(mailer.sent) != 0 {
+		t.Errorf("Expected no emails for an unknown address, got %d", len(mailer.sent))
+	}
+
+	if code := requestMagicLink(router, "nobody@example.com"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
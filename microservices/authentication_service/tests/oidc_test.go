@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testRedirectURI = "http://localhost:3000/callback"
+
+// performs a form post against the router
+func postForm(router *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// fetches the jwks endpoint and returns its first key
+func fetchSigningKey(t *testing.T, router *gin.Engine) *rsa.PublicKey {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+
+	var jwks dtos.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil || len(jwks.Keys) == 0 {
+		t.Fatalf("Couldn't parse jwks: %v\n", err)
+	}
+
+	n, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	client := registerClient(t, router, `{"name":"dashboard","audience":"dashboard","redirect_uris":["`+testRedirectURI+`"],"first_party":true,"public":true}`)
+
+	verifier := "a-sufficiently-long-code-verifier-for-the-pkce-test"
+	hash := sha256.Sum256([]byte(verifier))
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid profile email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(hash[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	//without a session the login page is shown
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oauth/authorize?"+authorize.Encode(), nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<form") {
+		t.Fatalf("Expected login page, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//the form has to carry the csrf token from the cookie set with the page
+	var csrf *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "csrf_token" {
+			csrf = cookie
+		}
+	}
+	if csrf == nil || !strings.Contains(w.Body.String(), csrf.Value) {
+		t.Fatalf("Expected the login page to set a csrf token")
+	}
+	login := url.Values{"email": {"jane@example.com"}, "password": {"password123"}}
+	for key, values := range authorize {
+		login[key] = values
+	}
+	if w = postForm(router, "/auth/oauth/authorize", login); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a login without csrf token to be rejected, got %d", w.Code)
+	}
+
+	//logging in redirects back to the client with a code
+	login.Set("csrf_token", csrf.Value)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/oauth/authorize", strings.NewReader(login.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(csrf)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusFound, w.Code, w.Body.String())
+	}
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+		t.Fatalf("Expected code and state in redirect, got %s", location)
+	}
+
+	//exchange the code using the verifier
+	w = postForm(router, "/auth/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.ClientID},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var token dtos.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+
+	//the id token is verifiable with the published key
+	key := fetchSigningKey(t, router)
+	idClaims := &dtos.IDTokenClaims{}
+	if _, err := jwt.ParseWithClaims(token.IDToken, idClaims, func(*jwt.Token) (interface{}, error) { return key, nil },
+		jwt.WithAudience(client.ClientID), jwt.WithValidMethods([]string{"RS256"})); err != nil {
+		t.Fatalf("Expected a valid id token: %v", err)
+	}
+	if idClaims.Nonce != "n-0S6_WzA2Mj" || idClaims.Email != "jane@example.com" || idClaims.Name != "Jane" {
+		t.Errorf("Unexpected id token claims: %+v", idClaims)
+	}
+
+	//the access token works against the userinfo endpoint
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "jane@example.com") {
+		t.Errorf("Expected userinfo for jane, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//but it's issued to the client, so it isn't a session
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/claims", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the client's access token to be rejected as a session, got %d", w.Code)
+	}
+
+	//codes can only be used once
+	w = postForm(router, "/auth/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.ClientID},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected reused code to be rejected, got %d", w.Code)
+	}
+}
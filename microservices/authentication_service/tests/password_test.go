@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	e "authentication-service/errors"
+	"authentication-service/models"
+	"authentication-service/repository"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// posts a password change with the access token and optional refresh cookie
+func changePassword(router *gin.Engine, accessToken string, refreshCookie *http.Cookie, current, next string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(dtos.PasswordChange{CurrentPassword: current, NewPassword: next})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/password/change", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if refreshCookie != nil {
+		req.AddCookie(refreshCookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestChangePasswordKeepsCurrentSession(t *testing.T) {
+	router, authService := setupRouter(t)
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	db := authService.AuthRepo.(repository.MysqlAuthRepository).DB
+
+	body, _ := json.Marshal(dtos.UserLogin{Email: "jane@example.com", Password: "password123"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var login dtos.RefreshResponse
+	json.Unmarshal(w.Body.Bytes(), &login)
+	var refreshCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "refresh_token" {
+			refreshCookie = cookie
+		}
+	}
+
+	//a session on another device
+	db.Create(&models.RefreshToken{UserID: user.UserID, TokenHash: "other-device", ExpiresAt: time.Now().Add(time.Hour)})
+
+	w = changePassword(router, login.AccessToken, refreshCookie, "wrong password", "a new passphrase")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+
+	w = changePassword(router, login.AccessToken, refreshCookie, "password123", "a new passphrase")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	var active []models.RefreshToken
+	db.Where("user_id = ? AND revoked = ?", user.UserID, false).Find(&active)
+	if len(active) != 1 || active[0].TokenHash == "other-device" {
+		t.Errorf("Expected only the current session to stay active, got %d sessions", len(active))
+	}
+
+	//the current session can still refresh
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/auth/refresh", nil)
+	req.AddCookie(refreshCookie)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected current session to refresh, got %d: %s", w.Code, w.Body.String())
+	}
+
+	loginUser(t, router, "jane@example.com", "a new passphrase")
+}
+
+func TestChangePasswordAppliesPolicy(t *testing.T) {
+	router, authService := setupRouter(t)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+
+	w := changePassword(router, accessToken, nil, "password123", "jane1")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	//too short and contains the name
+	if len(response.Fields["new_password"]) != 2 {
+		t.Errorf("Expected 2 new_password violations, got %v", response.Fields)
+	}
+}
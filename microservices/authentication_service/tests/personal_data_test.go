@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func personalDataRequest(router *gin.Engine, method, token, userID string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, "/auth/internal/users/"+userID+"/personal-data", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func exportPersonalData(t *testing.T, router *gin.Engine, token, userID string) *dtos.PersonalData {
+	t.Helper()
+	w := personalDataRequest(router, "GET", token, userID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "$2a$") || strings.Contains(w.Body.String(), "argon2id") {
+		t.Errorf("Expected the export to leave out the password hash, got %s", w.Body.String())
+	}
+
+	var data dtos.PersonalData
+	json.Unmarshal(w.Body.Bytes(), &data)
+	return &data
+}
+
+func TestPersonalDataExportAndErasure(t *testing.T) {
+	router, authService := setupRouter(t)
+	token := serviceToken(t, router, `["personal_data"]`, "auth-service")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	loginUser(t, router, "jane@example.com", "password123")
+	userID := strconv.FormatUint(uint64(user.UserID), 10)
+
+	admin := createUser(t, authService, "Support", "support@example.com", "password123")
+	makeAdmin(t, router, admin.UserID)
+	if w := impersonate(router, loginUser(t, router, "support@example.com", "password123"), user.UserID); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	data := exportPersonalData(t, router, token, userID)
+	if data.Credential == nil || data.Credential.Email != "jane@example.com" || !data.Credential.HasPassword {
+		t.Errorf("Expected the credential to be exported, got %+v", data.Credential)
+	}
+	if len(data.Sessions) == 0 || len(data.AuditEvents) == 0 {
+		t.Errorf("Expected the sessions and audit events to be exported, got %+v", data)
+	}
+
+	if w := personalDataRequest(router, "DELETE", token, userID); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if cookies := loginCookies(t, router, "jane@example.com", "password123"); cookies["refresh_token"] != nil {
+		t.Errorf("Expected login to fail for an erased user")
+	}
+
+	data = exportPersonalData(t, router, token, userID)
+	if data.Credential != nil || len(data.Sessions) != 0 {
+		t.Errorf("Expected the credential and sessions to be removed, got %+v", data)
+	}
+	erased := false
+	for _, event := range data.AuditEvents {
+		if event.Email != "" || event.IP != "" || event.UserAgent != "" {
+			t.Errorf("Expected audit events to be anonymized, got %+v", event)
+		}
+		erased = erased || event.Type == dtos.AuditUserErased
+	}
+	if !erased {
+		t.Errorf("Expected the erasure to be audited")
+	}
+
+	sessions, err := authService.AuthRepo.FindImpersonationSessions(0, user.UserID)
+	if err != nil || len(sessions) != 1 || sessions[0].ActorID != admin.UserID || sessions[0].Reason != "" {
+		t.Errorf("Expected the impersonation to be kept without its reason, got %+v (%v)", sessions, err)
+	}
+
+	//erasing is idempotent
+	if w := personalDataRequest(router, "DELETE", token, userID); w.Code != http.StatusNoContent {
+		t.Errorf("Expected erasing again to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPersonalDataRequiresScope(t *testing.T) {
+	router, authService := setupRouter(t)
+	token := serviceToken(t, router, `["credentials:write"]`, "auth-service")
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+
+	userID := strconv.FormatUint(uint64(user.UserID), 10)
+	for _, method := range []string{"GET", "DELETE"} {
+		if w := personalDataRequest(router, method, token, userID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d for %s without the scope, got %d", http.StatusForbidden, method, w.Code)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"authentication-service/policy"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicyFromConfig(t *testing.T) {
+	sum := sha1.Sum([]byte("Tr0ub4dor&3"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "0000000000000000000000000000000000000000:1\n" + hex.EncodeToString(sum[:]) + ":42\n"
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatalf("Couldn't write hash list: %v\n", err)
+	}
+	t.Setenv("BREACHED_PASSWORDS_FILE", path)
+	t.Setenv("PASSWORD_MIN_CHARACTER_CLASSES", "3")
+	_, authService := setupRouter(t)
+
+	//too few character classes, too many repeats and contains the name
+	violations, err := authService.Policy.Validate("janeeee1", policy.User{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil || len(violations) != 3 {
+		t.Errorf("Expected 3 password violations, got %v (%v)", violations, err)
+	}
+
+	violations, err = authService.Policy.Validate("Tr0ub4dor&3", policy.User{Name: "Jane", Email: "jane@example.com"})
+	if err != nil || len(violations) != 1 {
+		t.Errorf("Expected a breached password to be rejected, got %v (%v)", violations, err)
+	}
+
+	violations, err = authService.Policy.Validate("Correct Horse Battery 9", policy.User{Name: "Jane", Email: "jane@example.com"})
+	if err != nil || len(violations) != 0 {
+		t.Errorf("Expected the password to be accepted, got %v (%v)", violations, err)
+	}
+}
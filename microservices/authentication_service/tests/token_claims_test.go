@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAccessTokenRegisteredClaims(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "5m")
+	t.Setenv("ISSUER", "https://auth.staging.example.com")
+	t.Setenv("JWT_AUDIENCE", "staging")
+	router, authService := setupRouter(t)
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+	claims, err := authService.ParseJWT(&accessToken)
+	if err != nil {
+		t.Fatalf("Couldn't parse access token: %v\n", err)
+	}
+
+	if claims.Issuer != "https://auth.staging.example.com" || claims.Subject != fmt.Sprint(user.UserID) ||
+		len(claims.Audience) != 1 || claims.Audience[0] != "staging" || claims.NotBefore == nil {
+		t.Errorf("Expected iss, sub, aud and nbf to be set, got %+v", claims.RegisteredClaims)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != 5*time.Minute {
+		t.Errorf("Expected a 5 minute access token, got %s", lifetime)
+	}
+
+	//tokens from another environment sharing the secret are rejected
+	t.Setenv("ISSUER", "https://auth.example.com")
+	if _, err := authService.ParseJWT(&accessToken); err == nil {
+		t.Errorf("Expected token from another issuer to be rejected")
+	}
+	t.Setenv("ISSUER", "https://auth.staging.example.com")
+	t.Setenv("JWT_AUDIENCE", "production")
+	if _, err := authService.ParseJWT(&accessToken); err == nil {
+		t.Errorf("Expected token for another audience to be rejected")
+	}
+}
+
+func TestParseJWTEnforcesAlgorithmAndLeeway(t *testing.T) {
+	_, authService := setupRouter(t)
+
+	claims := jwt.MapClaims{
+		"iss":    "http://localhost:8080/auth",
+		"aud":    "basic-go-micro",
+		"sub":    "1",
+		"userID": 1,
+		"exp":    time.Now().Add(-10 * time.Second).Unix(),
+	}
+
+	//expired within the leeway
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if _, err := authService.ParseJWT(&token); err != nil {
+		t.Errorf("Expected token expired within the leeway to be accepted, got %v", err)
+	}
+
+	t.Setenv("JWT_LEEWAY", "0s")
+	if _, err := authService.ParseJWT(&token); err == nil {
+		t.Errorf("Expected expired token to be rejected without leeway")
+	}
+
+	//only HS256 is accepted
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, _ = jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("test-secret"))
+	if _, err := authService.ParseJWT(&token); err == nil {
+		t.Errorf("Expected HS512 token to be rejected")
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"authentication-service/events"
+	"authentication-service/models"
+	"authentication-service/repository"
+	"encoding/json"
+	"testing"
+)
+
+func TestUserDeletedEventRevokesSessions(t *testing.T) {
+	router, authService := setupRouter(t)
+	user := createUser(t, authService, "Jane", "jane@example.com", "password123")
+	loginUser(t, router, "jane@example.com", "password123")
+
+	broker := events.NewMemoryBroker()
+	if err := authService.SubscribeUserEvents(broker); err != nil {
+		t.Fatalf("Couldn't subscribe: %v\n", err)
+	}
+
+	event, _ := events.NewEvent(events.UserDeleted, user.UserID, events.UserData{ID: user.UserID})
+	data, _ := json.Marshal(event)
+	broker.Publish(events.UserDeleted, data)
+
+	db := authService.AuthRepo.(repository.MysqlAuthRepository).DB
+	var active int64
+	db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked = ?", user.UserID, false).Count(&active)
+	if active != 0 {
+		t.Errorf("Expected every refresh token to be revoked, %d are active", active)
+	}
+
+	//deleted users can be restored, so their credential is kept until they're purged
+	if _, err := authService.AuthRepo.FindCredentialByUserID(user.UserID); err != nil {
+		t.Errorf("Expected the credential of the deleted user to be kept: %v", err)
+	}
+
+	//events are handled idempotently
+	broker.Publish(events.UserDeleted, data)
+
+	event, _ = events.NewEvent(events.UserPurged, user.UserID, events.UserData{ID: user.UserID})
+	data, _ = json.Marshal(event)
+	broker.Publish(events.UserPurged, data)
+	if _, err := authService.AuthRepo.FindCredentialByUserID(user.UserID); err == nil {
+		t.Errorf("Expected the credential of the purged user to be removed")
+	}
+	broker.Publish(events.UserPurged, data)
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"authentication-service/dtos"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+const testOrigin = "http://localhost:8080"
+
+// softAuthenticator is an in memory authenticator producing "none" attestations
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %v\n", err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// authenticator data with the given flags, optionally followed by attested credential data
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte("localhost"))
+	a.signCount++
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(kind, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": kind, "challenge": challenge, "origin": testOrigin})
+	return data
+}
+
+// builds the response to navigator.credentials.create
+func (a *softAuthenticator) create(t *testing.T, options map[string]interface{}) []byte {
+	publicKey := options["publicKey"].(map[string]interface{})
+	challenge := publicKey["challenge"].(string)
+	userID := publicKey["user"].(map[string]interface{})["id"].(string)
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(userID)
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2 key type
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't encode key: %v\n", err)
+	}
+
+	attested := make([]byte, 16) // zero aaguid
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x01|0x04|0x40, attested), // user present, user verified, attested data
+	})
+	if err != nil {
+		t.Fatalf("Couldn't encode attestation: %v\n", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+		},
+	})
+	return body
+}
+
+// builds the response to navigator.credentials.get
+func (a *softAuthenticator) get(t *testing.T, options map[string]interface{}) []byte {
+	challenge := options["publicKey"].(map[string]interface{})["challenge"].(string)
+
+	authData := a.authData(0x01|0x04, nil)
+	clientData := a.clientData("webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("Couldn't sign assertion: %v\n", err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	return body
+}
+
+// posts a json body with optional bearer token and webauthn session
+func postWebAuthn(router *gin.Engine, path string, body []byte, accessToken, session string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	if session != "" {
+		req.Header.Set("X-WebAuthn-Session", session)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decodes a ceremony response into its session id and raw options
+func parseCeremony(t *testing.T, w *httptest.ResponseRecorder) (string, map[string]interface{}) {
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var ceremony struct {
+		SessionID string                 `json:"session_id"`
+		Options   map[string]interface{} `json:"options"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ceremony); err != nil {
+		t.Fatalf("Couldn't parse response body: %v\n", err)
+	}
+	return ceremony.SessionID, ceremony.Options
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	router, authService := setupRouter(t)
+	t.Setenv("WEBAUTHN_ORIGINS", testOrigin)
+	createUser(t, authService, "Jane", "jane@example.com", "password123")
+	accessToken := loginUser(t, router, "jane@example.com", "password123")
+	authenticator := newSoftAuthenticator(t)
+
+	//register a passkey
+	session, options := parseCeremony(t, postWebAuthn(router, "/auth/webauthn/register/begin", []byte(`{"name":"laptop"}`), accessToken, ""))
+	w := postWebAuthn(router, "/auth/webauthn/register/finish", authenticator.create(t, options), accessToken, session)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var credential dtos.WebAuthnCredential
+	json.Unmarshal(w.Body.Bytes(), &credential)
+	if credential.Name != "laptop" {
+		t.Errorf("Expected passkey name 'laptop', got '%s'", credential.Name)
+	}
+
+	//log in with the passkey without giving an email
+	session, options = parseCeremony(t, postWebAuthn(router, "/auth/webauthn/login/begin", nil, "", ""))
+	w = postWebAuthn(router, "/auth/webauthn/login/finish", authenticator.get(t, options), "", session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var login dtos.RefreshResponse
+	json.Unmarshal(w.Body.Bytes(), &login)
+	claims, err := authService.ParseJWT(&login.AccessToken)
+	if err != nil || claims.Email != "jane@example.com" {
+		t.Errorf("Expected an access token for jane, got %v", err)
+	}
+
+	//log in with the passkey for a specific email
+	session, options = parseCeremony(t, postWebAuthn(router, "/auth/webauthn/login/begin", []byte(`{"email":"jane@example.com"}`), "", ""))
+	w = postWebAuthn(router, "/auth/webauthn/login/finish", authenticator.get(t, options), "", session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	//sessions can't be reused
+	w = postWebAuthn(router, "/auth/webauthn/login/finish", authenticator.get(t, options), "", session)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected reused session to be rejected, got %d", w.Code)
+	}
+}
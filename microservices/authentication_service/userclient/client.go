@@ -0,0 +1,104 @@
+package userclient
+
+import (
+	"authentication-service/dtos"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user with email already exists")
+)
+
+// Directory gives access to the user profiles owned by the user service
+type Directory interface {
+	GetUser(id uint) (*dtos.User, error)
+	//creates a user without a password, used when someone signs up through an external provider
+	CreateUser(name, email string) (*dtos.User, error)
+	//removes a user created by CreateUser whose sign up couldn't be completed
+	DeleteUser(id uint) error
+}
+
+// HTTPDirectory calls the user service's api, authenticating with tokens from TokenSource
+type HTTPDirectory struct {
+	BaseURL     string
+	TokenSource func() (string, error)
+	HTTPClient  *http.Client
+}
+
+func NewHTTPDirectory(baseURL string, tokenSource func() (string, error)) *HTTPDirectory {
+	return &HTTPDirectory{
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		TokenSource: tokenSource,
+		HTTPClient:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (d *HTTPDirectory) GetUser(id uint) (*dtos.User, error) {
+	var user dtos.User
+	if err := d.do(http.MethodGet, fmt.Sprintf("/users/%d", id), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (d *HTTPDirectory) CreateUser(name, email string) (*dtos.User, error) {
+	var user dtos.User
+	body := map[string]string{"name": name, "email": email}
+	if err := d.do(http.MethodPost, "/users/internal", body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (d *HTTPDirectory) DeleteUser(id uint) error {
+	return d.do(http.MethodDelete, fmt.Sprintf("/users/internal/%d", id), nil, nil)
+}
+
+// sends a json request to the user service and decodes the response into out
+func (d *HTTPDirectory) do(method, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, d.BaseURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := d.TokenSource()
+	if err != nil {
+		return fmt.Errorf("failed to get service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("user service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUserNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return ErrUserExists
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("user service responded with status %d", resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,169 @@
+package authclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialStore manages the credentials the auth service keeps for each user
+type CredentialStore interface {
+	//creates or updates a user's credential, an empty password keeps the current one
+	SetCredential(userID uint, email, name, password string) error
+	//sets whether the user can get tokens, sessions of users who aren't active are revoked
+	SetCredentialStatus(userID uint, status, reason string) error
+	DeleteCredential(userID uint) error
+}
+
+// PersonalDataStore exports and erases what the auth service keeps about users, for data subject requests
+type PersonalDataStore interface {
+	//returns the auth service's data about a user, such as their sessions and audit events, as json
+	ExportUserData(userID uint) (json.RawMessage, error)
+	//revokes a user's sessions and erases their data, erasing a user twice isn't an error
+	EraseUserData(userID uint) error
+}
+
+// Error is returned when the auth service rejects a request
+type Error struct {
+	Status  int
+	Message string
+	//problems with individual fields, such as password policy violations
+	Fields map[string][]string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("auth service responded with status %d: %s", e.Status, e.Message)
+}
+
+// HTTPCredentialStore calls the auth service's internal api using a client credentials token, it's also the
+// PersonalDataStore when the client has the personal_data scope
+type HTTPCredentialStore struct {
+	BaseURL      string
+	ClientID     string
+	ClientSecret string
+	HTTPClient   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewHTTPCredentialStore(baseURL, clientID, clientSecret string) *HTTPCredentialStore {
+	return &HTTPCredentialStore{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (s *HTTPCredentialStore) SetCredential(userID uint, email, name, password string) error {
+	body := map[string]string{"email": email, "name": name, "password": password}
+	return s.do(http.MethodPut, fmt.Sprintf("/auth/internal/credentials/%d", userID), body, nil)
+}
+
+func (s *HTTPCredentialStore) SetCredentialStatus(userID uint, status, reason string) error {
+	body := map[string]string{"status": status, "reason": reason}
+	return s.do(http.MethodPut, fmt.Sprintf("/auth/internal/credentials/%d/status", userID), body, nil)
+}
+
+func (s *HTTPCredentialStore) DeleteCredential(userID uint) error {
+	return s.do(http.MethodDelete, fmt.Sprintf("/auth/internal/credentials/%d", userID), nil, nil)
+}
+
+func (s *HTTPCredentialStore) ExportUserData(userID uint) (json.RawMessage, error) {
+	var data json.RawMessage
+	if err := s.do(http.MethodGet, fmt.Sprintf("/auth/internal/users/%d/personal-data", userID), nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *HTTPCredentialStore) EraseUserData(userID uint) error {
+	return s.do(http.MethodDelete, fmt.Sprintf("/auth/internal/users/%d/personal-data", userID), nil, nil)
+}
+
+// sends a json request to the internal api, decoding the response into response unless it's nil and turning error
+// responses into an *Error
+func (s *HTTPCredentialStore) do(method, path string, body, response interface{}) error {
+	token, err := s.token()
+	if err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, s.BaseURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("auth service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		if response != nil {
+			return json.NewDecoder(resp.Body).Decode(response)
+		}
+		return nil
+	}
+
+	apiErr := &Error{Status: resp.StatusCode}
+	json.NewDecoder(resp.Body).Decode(apiErr)
+	return apiErr
+}
+
+// returns a cached access token, requesting a new one shortly before it expires
+func (s *HTTPCredentialStore) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, s.BaseURL+"/auth/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.ClientID, s.ClientSecret)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get auth service token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get auth service token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	s.accessToken = token.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+	return s.accessToken, nil
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -10,21 +12,119 @@ type Config struct {
 	DBName     string
 	DBUser     string
 	DBPassword string
+	//the auth service stores credentials, the user service calls it as an oauth client with the credentials:write and
+	//personal_data scopes
+	AuthServiceURL   string
+	AuthClientID     string
+	AuthClientSecret string
+	//passwords are sent to the auth service, in production it has to be reached over https
+	Production bool
+	//used to verify tokens of services calling the internal api
+	JwtSecret       string
+	Issuer          string
+	ServiceAudience string
+	//audience of the access tokens the auth service issues to users, matching its JWT_AUDIENCE
+	UserTokenAudience string
+	//broker user events are published to, memory keeps them within the process
+	EventBroker string
+	NATSURL     string
+	//how often the outbox relay looks for events to publish, how many it publishes at once
+	//and the longest it waits before retrying a failed event
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxMaxBackoff   time.Duration
+	//whether deleted users' emails can be used by new users before they're purged, deleted users can't be
+	//restored once someone else took their email
+	ReleaseDeletedEmails bool
+	//how long deleted users can be restored before they're purged, and how often the purge runs
+	DeletedUserRetention time.Duration
+	PurgeInterval        time.Duration
+	//how phone verification codes are sent, how long they're valid and how many wrong guesses are allowed
+	SMSSender            string
+	PhoneCodeTTL         time.Duration
+	PhoneCodeMaxAttempts int
+	//where uploaded files such as avatars are stored, and the largest avatar that can be uploaded
+	BlobStore      string
+	BlobDir        string
+	AvatarMaxBytes int
+	//directory of json schemas preference values are validated against, named after the key they're for such as
+	//web.theme.json, and how large and how many preferences a user can have
+	PreferenceSchemasDir string
+	PreferenceMaxBytes   int
+	PreferenceMaxCount   int
+	//how often data export and erasure requests are looked for, how often a failing request is tried and how long
+	//export archives can be downloaded
+	DataRequestPollInterval time.Duration
+	DataRequestMaxAttempts  int
+	DataExportRetention     time.Duration
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Using type constraints to limit T to supported types
+func getEnvOrDefault[T string | int | float64 | bool | time.Duration](key string, defaultValue T) T {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
+
+	// Use type switch on the type parameter T
+	switch any(defaultValue).(type) {
+	case string:
+		return any(value).(T)
+	case time.Duration:
+		if v, err := time.ParseDuration(value); err == nil {
+			return any(v).(T)
+		}
+	case int:
+		if v, err := strconv.Atoi(value); err == nil {
+			return any(v).(T)
+		}
+	case float64:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return any(v).(T)
+		}
+	case bool:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return any(v).(T)
+		}
+	}
+
 	return defaultValue
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		DBHost:     getEnvOrDefault("DB_HOST", "user-db"),
-		DBPort:     getEnvOrDefault("DB_PORT", "3306"),
-		DBName:     getEnvOrDefault("DB_NAME", "users"),
-		DBUser:     getEnvOrDefault("DB_USER", "root"),
-		DBPassword: getEnvOrDefault("DB_PASSWORD", ""),
+		DBHost:                  getEnvOrDefault("DB_HOST", "user-db"),
+		DBPort:                  getEnvOrDefault("DB_PORT", "3306"),
+		DBName:                  getEnvOrDefault("DB_NAME", "users"),
+		DBUser:                  getEnvOrDefault("DB_USER", "root"),
+		DBPassword:              getEnvOrDefault("DB_PASSWORD", ""),
+		AuthServiceURL:          getEnvOrDefault("AUTH_SERVICE_URL", "http://auth-service:8080"),
+		AuthClientID:            getEnvOrDefault("AUTH_CLIENT_ID", ""),
+		AuthClientSecret:        getEnvOrDefault("AUTH_CLIENT_SECRET", ""),
+		Production:              getEnvOrDefault("PRODUCTION", false),
+		JwtSecret:               getEnvOrDefault("JWT_SECRET", ""),
+		Issuer:                  getEnvOrDefault("ISSUER", "http://localhost:8080/auth"),
+		ServiceAudience:         getEnvOrDefault("SERVICE_AUDIENCE", "user-service"),
+		UserTokenAudience:       getEnvOrDefault("USER_TOKEN_AUDIENCE", "basic-go-micro"),
+		EventBroker:             getEnvOrDefault("EVENT_BROKER", "memory"),
+		NATSURL:                 getEnvOrDefault("NATS_URL", "nats://nats:4222"),
+		OutboxPollInterval:      getEnvOrDefault("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxBatchSize:         getEnvOrDefault("OUTBOX_BATCH_SIZE", 100),
+		OutboxMaxBackoff:        getEnvOrDefault("OUTBOX_MAX_BACKOFF", 5*time.Minute),
+		ReleaseDeletedEmails:    getEnvOrDefault("RELEASE_DELETED_EMAILS", false),
+		DeletedUserRetention:    getEnvOrDefault("DELETED_USER_RETENTION", 30*24*time.Hour),
+		PurgeInterval:           getEnvOrDefault("PURGE_INTERVAL", time.Hour),
+		SMSSender:               getEnvOrDefault("SMS_SENDER", "log"),
+		PhoneCodeTTL:            getEnvOrDefault("PHONE_CODE_TTL", 10*time.Minute),
+		PhoneCodeMaxAttempts:    getEnvOrDefault("PHONE_CODE_MAX_ATTEMPTS", 5),
+		BlobStore:               getEnvOrDefault("BLOB_STORE", "local"),
+		BlobDir:                 getEnvOrDefault("BLOB_DIR", "data/blobs"),
+		AvatarMaxBytes:          getEnvOrDefault("AVATAR_MAX_BYTES", 5<<20),
+		PreferenceSchemasDir:    getEnvOrDefault("PREFERENCE_SCHEMAS_DIR", ""),
+		PreferenceMaxBytes:      getEnvOrDefault("PREFERENCE_MAX_BYTES", 16<<10),
+		PreferenceMaxCount:      getEnvOrDefault("PREFERENCE_MAX_COUNT", 200),
+		DataRequestPollInterval: getEnvOrDefault("DATA_REQUEST_POLL_INTERVAL", 10*time.Second),
+		DataRequestMaxAttempts:  getEnvOrDefault("DATA_REQUEST_MAX_ATTEMPTS", 5),
+		DataExportRetention:     getEnvOrDefault("DATA_EXPORT_RETENTION", 7*24*time.Hour),
 	}
 }
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"user-service/dtos"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDataExport handles POST requests for an archive of a user's data, the request is processed in the
+// background and its status can be followed at the returned location
+func (uc *UserController) RequestDataExport(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+	if claims, ok := uc.authorizeSubjectOrAdmin(c, id); !ok || uc.rejectImpersonation(c, claims) {
+		return
+	}
+
+	request, e := uc.userService.RequestDataExport(id)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	acceptDataRequest(c, id, request)
+}
+
+// RequestErasure handles POST requests to erase a user's personal data in every service
+func (uc *UserController) RequestErasure(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+	if claims, ok := uc.authorizeSubjectOrAdmin(c, id); !ok || uc.rejectImpersonation(c, claims) {
+		return
+	}
+
+	request, e := uc.userService.RequestErasure(id)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	acceptDataRequest(c, id, request)
+}
+
+// GetDataRequests handles GET requests for a user's export and erasure requests
+func (uc *UserController) GetDataRequests(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	requests, e := uc.userService.GetDataRequests(id)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// GetDataRequest handles GET requests for the status of one export or erasure request
+func (uc *UserController) GetDataRequest(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+	requestID, err := parseDataRequestID(c)
+	if err != nil {
+		return
+	}
+
+	request, e := uc.userService.GetDataRequest(id, requestID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// GetDataExportArchive handles GET requests downloading the archive of a completed export
+func (uc *UserController) GetDataExportArchive(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+	if claims, ok := uc.authorizeSubjectOrAdmin(c, id); !ok || uc.rejectImpersonation(c, claims) {
+		return
+	}
+	requestID, err := parseDataRequestID(c)
+	if err != nil {
+		return
+	}
+
+	archive, e := uc.userService.GetDataExportArchive(id, requestID)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export-%d.json"`, id, requestID))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/json", archive)
+}
+
+func acceptDataRequest(c *gin.Context, id uint, request *dtos.DataRequest) {
+	c.Header("Location", fmt.Sprintf("/users/%d/data-requests/%d", id, request.ID))
+	c.JSON(http.StatusAccepted, request)
+}
+
+func parseDataRequestID(c *gin.Context) (uint, error) {
+	requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid data request ID",
+		})
+		return 0, err
+	}
+	return uint(requestID), nil
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"user-service/config"
+	"user-service/dtos"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// scope other services need to create users through the internal api
+const scopeUsersWrite = "users:write"
+
+// claims of the service tokens issued by the auth service
+type serviceClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// CreateProfile handles POST requests from other services to create a user without a password
+func (uc *UserController) CreateProfile(c *gin.Context) {
+	if !uc.requireServiceScope(c, scopeUsersWrite) {
+		return
+	}
+
+	var request dtos.ProfileCreate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, e := uc.userService.CreateProfile(request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// RemoveProfile handles DELETE requests from other services to remove a user they created but couldn't sign up
+func (uc *UserController) RemoveProfile(c *gin.Context) {
+	if !uc.requireServiceScope(c, scopeUsersWrite) {
+		return
+	}
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+
+	if e := uc.userService.RemoveProfile(id); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ensures the request carries a service token issued by the auth service for this service with the given scope
+func (uc *UserController) requireServiceScope(c *gin.Context, scope string) bool {
+	conf := config.LoadConfig()
+	tokenString, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || conf.JwtSecret == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Service token is required"})
+		return false
+	}
+
+	claims := &serviceClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(conf.JwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(conf.Issuer),
+		jwt.WithAudience(conf.ServiceAudience),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if claims.ClientID == "" || !slices.Contains(strings.Fields(claims.Scope), scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"user-service/config"
+	"user-service/dtos"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreferences handles GET requests for several of a user's preferences, filtered by the namespace and keys query
+// parameters
+func (uc *UserController) GetPreferences(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	var query dtos.PreferenceQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	preferences, e := uc.userService.GetPreferences(id, query)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// GetPreference handles GET requests for one of a user's preferences
+func (uc *UserController) GetPreference(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	preference, e := uc.userService.GetPreference(id, c.Param("key"))
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, preference)
+}
+
+// SetPreference handles PUT requests whose body is the json value of a preference
+func (uc *UserController) SetPreference(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	maxBytes := config.LoadConfig().PreferenceMaxBytes
+	value, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBytes)))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Preference values can't be larger than %d bytes", maxBytes),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	preference, created, e := uc.userService.SetPreference(id, c.Param("key"), value)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, preference)
+}
+
+// DeletePreference handles DELETE requests for one of a user's preferences
+func (uc *UserController) DeletePreference(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	if e := uc.userService.DeletePreference(id, c.Param("key")); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"user-service/config"
+	"user-service/dtos"
+	. "user-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserProfile handles GET requests for a user's profile
+func (uc *UserController) GetUserProfile(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	profile, e := uc.userService.GetUserProfile(id)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateUserProfile handles PUT requests replacing a user's profile
+func (uc *UserController) UpdateUserProfile(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	var request dtos.UserProfileUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	profile, e := uc.userService.UpdateUserProfile(id, request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SendPhoneVerification handles POST requests to text a verification code to the phone number in a user's profile
+func (uc *UserController) SendPhoneVerification(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	if e := uc.userService.SendPhoneVerification(id); e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification code sent"})
+}
+
+// ConfirmPhoneVerification handles POST requests with the code texted to a user's phone
+func (uc *UserController) ConfirmPhoneVerification(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	var request dtos.PhoneVerificationConfirm
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	profile, e := uc.userService.ConfirmPhoneVerification(id, request)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UploadAvatar handles PUT requests from the user or an admin with an image in the avatar field of a multipart form
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil || !uc.requireSubjectOrAdmin(c, id) {
+		return
+	}
+
+	//room is left for the rest of the form, the service checks the size of the image itself
+	maxBytes := int64(config.LoadConfig().AvatarMaxBytes)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("Avatar can't be larger than %d bytes", maxBytes),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	profile, e := uc.userService.UploadAvatar(id, file, header.Header.Get("Content-Type"))
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetAvatar handles GET requests for a user's avatar, the size query parameter picks a thumbnail
+func (uc *UserController) GetAvatar(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+
+	size := AvatarOriginal
+	if param := c.Query("size"); param != "" {
+		if size, err = strconv.Atoi(param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Avatar size must be one of %v", AvatarSizes),
+			})
+			return
+		}
+	}
+
+	avatar, e := uc.userService.GetAvatar(id, size)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	//the url stays the same when a new avatar is uploaded, so caches have to revalidate
+	etag := `"` + avatar.Version + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if noneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, avatar.ContentType, avatar.Data)
+}
@@ -2,9 +2,13 @@ package controller
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"user-service/dtos"
+	e "user-service/errors"
 	. "user-service/service"
 
 	"github.com/gin-gonic/gin"
@@ -30,11 +34,35 @@ func NewUserController(userService *UserService) *UserController {
 func (uc *UserController) DefineRoutes(r *gin.Engine) {
 	userGroup := r.Group("/users")
 	{
+		userGroup.GET("", uc.ListUsers)
 		userGroup.GET("/health", uc.TestConnection)
+		userGroup.GET("/search", uc.SearchUsers)
 		userGroup.GET("/:id", uc.GetUserByID)
 		userGroup.POST("/", uc.CreateUser)
+		userGroup.POST("/internal", uc.CreateProfile)
+		userGroup.DELETE("/internal/:id", uc.RemoveProfile)
 		userGroup.PUT("/:id", uc.UpdateUser)
+		userGroup.PATCH("/:id", uc.PatchUser)
 		userGroup.DELETE("/:id", uc.DeleteUser)
+		userGroup.POST("/:id/restore", uc.RestoreUser)
+		userGroup.POST("/:id/suspend", uc.changeStatus(uc.userService.SuspendUser))
+		userGroup.POST("/:id/deactivate", uc.changeStatus(uc.userService.DeactivateUser))
+		userGroup.POST("/:id/reactivate", uc.changeStatus(uc.userService.ReactivateUser))
+		userGroup.GET("/:id/profile", uc.GetUserProfile)
+		userGroup.PUT("/:id/profile", uc.UpdateUserProfile)
+		userGroup.POST("/:id/profile/phone/verification", uc.SendPhoneVerification)
+		userGroup.POST("/:id/profile/phone/verification/confirm", uc.ConfirmPhoneVerification)
+		userGroup.GET("/:id/avatar", uc.GetAvatar)
+		userGroup.PUT("/:id/avatar", uc.UploadAvatar)
+		userGroup.GET("/:id/preferences", uc.GetPreferences)
+		userGroup.GET("/:id/preferences/:key", uc.GetPreference)
+		userGroup.PUT("/:id/preferences/:key", uc.SetPreference)
+		userGroup.DELETE("/:id/preferences/:key", uc.DeletePreference)
+		userGroup.POST("/:id/export", uc.RequestDataExport)
+		userGroup.POST("/:id/erasure", uc.RequestErasure)
+		userGroup.GET("/:id/data-requests", uc.GetDataRequests)
+		userGroup.GET("/:id/data-requests/:requestId", uc.GetDataRequest)
+		userGroup.GET("/:id/data-requests/:requestId/archive", uc.GetDataExportArchive)
 	}
 }
 
@@ -55,9 +83,98 @@ func (uc *UserController) GetUserByID(c *gin.Context) {
 		return
 	}
 
+	etag := userETag(user.Version)
+	c.Header("ETag", etag)
+	if noneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
 
+// ListUsers handles GET requests from admins for a filtered, sorted and paginated list of users
+func (uc *UserController) ListUsers(c *gin.Context) {
+	if !uc.requireAdmin(c) {
+		return
+	}
+
+	var query dtos.UserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	page, e := uc.userService.ListUsers(query)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if links := pageLinks(c.Request.URL, page); len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchUsers handles GET requests from admins to find users by partial names or emails
+func (uc *UserController) SearchUsers(c *gin.Context) {
+	if !uc.requireAdmin(c) {
+		return
+	}
+
+	var query dtos.UserSearch
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid query parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	results, e := uc.userService.SearchUsers(query)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// builds RFC 8288 links to the other pages of a user list, only the next page is known when paginating by cursor
+func pageLinks(current *url.URL, page *dtos.UserPage) []string {
+	link := func(rel string, set map[string]string) string {
+		query := current.Query()
+		query.Del("page")
+		query.Del("cursor")
+		for key, value := range set {
+			query.Set(key, value)
+		}
+		target := url.URL{Path: current.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf("<%s>; rel=\"%s\"", target.String(), rel)
+	}
+
+	if page.Page == 0 {
+		if page.NextCursor == "" {
+			return nil
+		}
+		return []string{link("next", map[string]string{"cursor": page.NextCursor})}
+	}
+
+	lastPage := max(1, int((page.Total+int64(page.PageSize)-1)/int64(page.PageSize)))
+	links := []string{link("first", map[string]string{"page": "1"})}
+	if page.Page > 1 {
+		links = append(links, link("prev", map[string]string{"page": strconv.Itoa(min(page.Page-1, lastPage))}))
+	}
+	if page.Page < lastPage {
+		links = append(links, link("next", map[string]string{"page": strconv.Itoa(page.Page + 1)}))
+	}
+	return append(links, link("last", map[string]string{"page": strconv.Itoa(lastPage)}))
+}
+
 // CreateUser handles POST requests to create a new user
 func (uc *UserController) CreateUser(c *gin.Context) {
 
@@ -72,7 +189,7 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 
 	user, e := uc.userService.CreateUser(request)
 	if e != nil {
-		c.JSON(http.StatusInternalServerError, e.ToJson())
+		c.JSON(e.Code, e.ToJson())
 		return
 	}
 
@@ -98,12 +215,57 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 
 	request.Id = id
 
-	user, e := uc.userService.UpdateUser(request)
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	user, e := uc.userService.UpdateUser(request, version)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Header("ETag", userETag(user.Version))
+	c.JSON(http.StatusOK, user)
+}
+
+// PatchUser handles PATCH requests changing some of a user's fields, plain json bodies are treated as merge patches
+func (uc *UserController) PatchUser(c *gin.Context) {
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+
+	patchType := c.ContentType()
+	if patchType == gin.MIMEJSON {
+		patchType = MergePatch
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	user, e := uc.userService.PatchUser(id, version, patchType, patch)
 	if e != nil {
-		c.JSON(http.StatusInternalServerError, e.ToJson())
+		if e.Code == http.StatusUnsupportedMediaType {
+			c.Header("Accept-Patch", MergePatch+", "+JSONPatch)
+		}
+		c.JSON(e.Code, e.ToJson())
 		return
 	}
 
+	c.Header("ETag", userETag(user.Version))
 	c.JSON(http.StatusOK, user)
 }
 
@@ -114,14 +276,114 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if e := uc.userService.DeleteUser(id); e != nil {
-		c.JSON(http.StatusInternalServerError, e.ToJson())
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if e := uc.userService.DeleteUser(id, version); e != nil {
+		c.JSON(e.Code, e.ToJson())
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+// the ETag of a version of a user
+func userETag(version uint) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// reports whether an If-None-Match header matches the etag, using the weak comparison RFC 9110 asks for
+func noneMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// reads the version a change was made from out of the If-Match header, which is required so changes never overwrite
+// each other unnoticed. Writes a response and returns false when the header is missing or can't match any version
+func ifMatchVersion(c *gin.Context) (uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error": "If-Match header with the user's ETag is required",
+		})
+		return 0, false
+	}
+	if header == "*" {
+		return AnyVersion, true
+	}
+
+	//weak etags never match for If-Match
+	if unquoted, err := strconv.Unquote(header); err == nil && strings.HasPrefix(header, "\"") {
+		if version, err := strconv.ParseUint(unquoted, 10, 0); err == nil && version != uint64(AnyVersion) {
+			return uint(version), true
+		}
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error": "If-Match doesn't match the user's ETag",
+	})
+	return 0, false
+}
+
+// RestoreUser handles POST requests from admins to undo the deletion of a user
+func (uc *UserController) RestoreUser(c *gin.Context) {
+	if !uc.requireAdmin(c) {
+		return
+	}
+	id, err := uc.parseUserID(c)
+	if err != nil {
+		return
+	}
+
+	user, e := uc.userService.RestoreUser(id)
+	if e != nil {
+		c.JSON(e.Code, e.ToJson())
+		return
+	}
+
+	c.Header("ETag", userETag(user.Version))
+	c.JSON(http.StatusOK, user)
+}
+
+// changeStatus handles POST requests from admins moving a user to another status, with an optional reason in the body
+func (uc *UserController) changeStatus(change func(id uint, request dtos.StatusChange) (*dtos.User, *e.Error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !uc.requireAdmin(c) {
+			return
+		}
+		id, err := uc.parseUserID(c)
+		if err != nil {
+			return
+		}
+
+		var request dtos.StatusChange
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid request payload",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+
+		user, e := change(id, request)
+		if e != nil {
+			c.JSON(e.Code, e.ToJson())
+			return
+		}
+
+		c.Header("ETag", userETag(user.Version))
+		c.JSON(http.StatusOK, user)
+	}
+}
+
 // parseUserID is a helper function to parse and validate user IDs from requests
 func (uc *UserController) parseUserID(c *gin.Context) (uint, error) {
 	idParam := c.Param("id")
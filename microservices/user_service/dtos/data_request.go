@@ -0,0 +1,37 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type DataRequest struct {
+	ID     uint   `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	//why the request failed, once it won't be retried anymore
+	Error string `json:"error,omitempty"`
+	//export archives can be downloaded until they expire
+	ArchiveAvailable bool       `json:"archive_available"`
+	ArchiveExpiresAt *time.Time `json:"archive_expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// DataRequests lists a user's data requests newest first
+type DataRequests struct {
+	Requests []*DataRequest `json:"requests"`
+}
+
+// DataExport is the archive a user downloads after requesting their data
+type DataExport struct {
+	UserID      uint                       `json:"user_id"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+	User        *User                      `json:"user"`
+	Profile     *UserProfile               `json:"profile"`
+	Preferences map[string]json.RawMessage `json:"preferences"`
+	//earlier exports and erasures the user asked for
+	DataRequests []*DataRequest `json:"data_requests"`
+	//sessions, linked identities, passkeys and audit events kept by the auth service
+	Auth json.RawMessage `json:"auth_service"`
+}
@@ -0,0 +1,24 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Preference struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Preferences maps keys to their values
+type Preferences struct {
+	Preferences map[string]json.RawMessage `json:"preferences"`
+}
+
+// PreferenceQuery selects preferences to get at once, every preference of the user when both are empty
+type PreferenceQuery struct {
+	Namespace string `form:"namespace"`
+	//comma separated
+	Keys string `form:"keys"`
+}
@@ -0,0 +1,39 @@
+package dtos
+
+import "time"
+
+type UserProfile struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	//whether an avatar was uploaded, it's served by GET /users/:id/avatar
+	HasAvatar     bool      `json:"has_avatar"`
+	Phone         string    `json:"phone"`
+	PhoneVerified bool      `json:"phone_verified"`
+	Locale        string    `json:"locale"`
+	Timezone      string    `json:"timezone"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// UserProfileUpdate replaces every profile field, empty fields are cleared
+type UserProfileUpdate struct {
+	DisplayName string `json:"display_name" binding:"max=100"`
+	//only http and https, other schemes such as javascript: and data: could run scripts where the avatar is shown
+	AvatarURL string `json:"avatar_url" binding:"omitempty,max=2048,http_url"`
+	//E.164, such as +14155550123
+	Phone string `json:"phone" binding:"omitempty,e164"`
+	//BCP 47, such as en-US
+	Locale string `json:"locale" binding:"omitempty,max=35,bcp47_language_tag"`
+	//IANA time zone name, such as Europe/Berlin
+	Timezone string `json:"timezone" binding:"omitempty,max=64,timezone"`
+}
+
+type PhoneVerificationConfirm struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Avatar is an encoded avatar image, the version changes whenever a new avatar is uploaded
+type Avatar struct {
+	Data        []byte
+	ContentType string
+	Version     string
+}
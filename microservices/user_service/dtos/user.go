@@ -1,5 +1,7 @@
 package dtos
 
+import "time"
+
 type UserCreate struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
@@ -10,6 +12,12 @@ type User struct {
 	Id    uint   `json:"id"`
 	Name  string `json:"name" binding:"required"`
 	Email string `json:"email" binding:"required,email"`
+	//set by the service, ignored in updates
+	Status       string    `json:"status,omitempty"`
+	StatusReason string    `json:"status_reason,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	//sent as the ETag header instead of in the body
+	Version uint `json:"-"`
 }
 
 func NewUser(id uint, name, email string) *User {
@@ -19,3 +27,54 @@ func NewUser(id uint, name, email string) *User {
 		Email: email,
 	}
 }
+
+// StatusChange suspends, deactivates or reactivates a user
+type StatusChange struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// ProfileCreate is sent by other services to create a user without a password
+type ProfileCreate struct {
+	Name  string `json:"name"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+// UserQuery filters, sorts and paginates the user list. Sort is a field name, prefixed with - for descending order.
+// Pages are selected by page, or by cursor when continuing from the next_cursor of a previous page
+type UserQuery struct {
+	Email         string    `form:"email"`
+	Name          string    `form:"name"`
+	Status        string    `form:"status"`
+	CreatedAfter  time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort          string    `form:"sort,default=id"`
+	Page          int       `form:"page,default=1" binding:"min=1"`
+	PageSize      int       `form:"page_size,default=20" binding:"min=1,max=100"`
+	Cursor        string    `form:"cursor"`
+}
+
+type UserPage struct {
+	Users    []*User `json:"users"`
+	Total    int64   `json:"total"`
+	Page     int     `json:"page,omitempty"`
+	PageSize int     `json:"page_size"`
+	//empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// UserSearch is a free text query matched against the words in users' names and emails
+type UserSearch struct {
+	Q     string `form:"q" binding:"required"`
+	Limit int    `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+type UserSearchResult struct {
+	User  *User   `json:"user"`
+	Score float64 `json:"score"`
+	//matched fields with the matching parts wrapped in <em> tags, the rest is html escaped
+	Highlights map[string]string `json:"highlights"`
+}
+
+type UserSearchResults struct {
+	Results []*UserSearchResult `json:"results"`
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Publisher publishes domain events
+type Publisher interface {
+	Publish(event *Event) error
+}
+
+// Handler reacts to a published event
+type Handler func(event *Event)
+
+// Bus dispatches events to handlers within the process and forwards them to a broker for other services
+type Bus struct {
+	broker Broker
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// creates a bus forwarding to broker, events stay within the process when broker is nil
+func NewBus(broker Broker) *Bus {
+	return &Bus{broker: broker, handlers: map[string][]Handler{}}
+}
+
+// registers a handler for events of the given type
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *Bus) Publish(event *Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+
+	if b.broker == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.broker.Publish(event.Type, data)
+}
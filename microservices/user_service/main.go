@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	//the profile's timezone validation needs the time zone database, even where the os has none
+	_ "time/tzdata"
 	"user-service/controller"
 	userservice "user-service/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -13,9 +17,21 @@ func main() {
 	// Create service with repository
 	userService := userservice.NewUserService(nil)
 
+	// Publish the events written to the outbox in the background
+	go userservice.NewOutboxRelay(userService).Run(context.Background())
+
+	// Permanently remove users once they can't be restored anymore
+	go userservice.NewUserPurger(userService).Run(context.Background())
+
+	// Carry out data export and erasure requests in the background
+	go userservice.NewDataRequestProcessor(userService).Run(context.Background())
+
 	// Create controller with service
 	userController := controller.NewUserController(userService)
 	userController.DefineRoutes(r)
 
+	// Prometheus metrics, including the outbox backlog
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	r.Run("0.0.0.0:8080")
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+	"user-service/dtos"
+)
+
+// DataRequest is a user's request to export or erase their personal data, it's processed in the background
+type DataRequest struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;index"`
+	Type   string `gorm:"size:16;not null"`
+	Status string `gorm:"size:16;not null;index"`
+	//incremented whenever processing starts, failed requests are retried until the limit
+	Attempts  int
+	LastError string `gorm:"type:text"`
+	//key of the export archive in the blob store, cleared once it expires
+	ArchiveKey       string `gorm:"size:255"`
+	ArchiveExpiresAt *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	CompletedAt      *time.Time
+}
+
+// types of data requests
+const (
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+)
+
+// statuses of data requests, processing requests that take too long are picked up again
+const (
+	DataRequestPending    = "pending"
+	DataRequestProcessing = "processing"
+	DataRequestCompleted  = "completed"
+	DataRequestFailed     = "failed"
+)
+
+func NewDataRequest(userID uint, requestType string) *DataRequest {
+	return &DataRequest{
+		UserID: userID,
+		Type:   requestType,
+		Status: DataRequestPending,
+	}
+}
+
+// whether the request is still waiting to be processed or being processed
+func (r *DataRequest) Unfinished() bool {
+	return r.Status == DataRequestPending || r.Status == DataRequestProcessing
+}
+
+func (r *DataRequest) ToDTO() *dtos.DataRequest {
+	request := &dtos.DataRequest{
+		ID:               r.ID,
+		Type:             r.Type,
+		Status:           r.Status,
+		ArchiveAvailable: r.ArchiveKey != "",
+		ArchiveExpiresAt: r.ArchiveExpiresAt,
+		CreatedAt:        r.CreatedAt,
+		CompletedAt:      r.CompletedAt,
+	}
+	if r.Status == DataRequestFailed {
+		request.Error = r.LastError
+	}
+	return request
+}
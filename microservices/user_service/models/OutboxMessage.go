@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+	"user-service/events"
+)
+
+// OutboxMessage is an event stored in the same transaction as the change it describes, waiting to be published
+type OutboxMessage struct {
+	ID            uint   `gorm:"primaryKey"`
+	EventID       string `gorm:"uniqueIndex;size:32"`
+	EventType     string
+	AggregateType string `gorm:"size:64;index:idx_outbox_aggregate"`
+	AggregateID   uint   `gorm:"index:idx_outbox_aggregate"`
+	Payload       string `gorm:"type:text"`
+	CreatedAt     time.Time
+	//nil until the event was published
+	DeliveredAt *time.Time `gorm:"index"`
+	Attempts    int
+	//failed messages aren't retried before this time
+	NextAttemptAt time.Time
+	LastError     string `gorm:"type:text"`
+}
+
+func NewOutboxMessage(event *events.Event, aggregateType string) *OutboxMessage {
+	return &OutboxMessage{
+		EventID:       event.ID,
+		EventType:     event.Type,
+		AggregateType: aggregateType,
+		AggregateID:   event.AggregateID,
+		Payload:       string(event.Data),
+		CreatedAt:     event.OccurredAt,
+		NextAttemptAt: event.OccurredAt,
+	}
+}
+
+// rebuilds the event the message was written for
+func (m *OutboxMessage) ToEvent() *events.Event {
+	return &events.Event{
+		ID:          m.EventID,
+		Type:        m.EventType,
+		AggregateID: m.AggregateID,
+		OccurredAt:  m.CreatedAt,
+		Data:        json.RawMessage(m.Payload),
+	}
+}
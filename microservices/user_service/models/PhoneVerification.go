@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PhoneVerification is a code sent to a user's phone that hasn't been confirmed yet, users have at most one
+type PhoneVerification struct {
+	UserID uint `gorm:"primaryKey;autoIncrement:false"`
+	//the number the code was sent to, the code can't verify a number set later
+	Phone     string `gorm:"size:16"`
+	CodeHash  string
+	Attempts  int
+	SentAt    time.Time
+	ExpiresAt time.Time
+}
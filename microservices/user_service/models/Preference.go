@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+	"user-service/dtos"
+)
+
+// Preference is a setting a client app stores for a user, such as a theme. Keys are namespaced by the app, as in
+// web.theme, and values are JSON
+type Preference struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false;index:idx_preferences_namespace,priority:1"`
+	Key       string `gorm:"primaryKey;size:193"`
+	Namespace string `gorm:"size:64;not null;index:idx_preferences_namespace,priority:2"`
+	Value     string `gorm:"type:text;not null"`
+	UpdatedAt time.Time
+}
+
+func (p *Preference) ToDTO() *dtos.Preference {
+	return &dtos.Preference{
+		Key:       p.Key,
+		Value:     json.RawMessage(p.Value),
+		UpdatedAt: p.UpdatedAt,
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+	"user-service/dtos"
+)
+
+// Profile holds the optional details a user shares about themselves
+type Profile struct {
+	UserID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	DisplayName string `gorm:"size:100"`
+	AvatarURL   string `gorm:"size:2048"`
+	//uploaded avatar, its sizes are stored under the key with the media type they were encoded as
+	AvatarKey  string `gorm:"size:255"`
+	AvatarType string `gorm:"size:32"`
+	//E.164, PhoneVerifiedAt is cleared when the number changes until the new one is verified
+	Phone           string `gorm:"size:16"`
+	PhoneVerifiedAt *time.Time
+	//BCP 47 language tag and IANA time zone name
+	Locale    string `gorm:"size:35"`
+	Timezone  string `gorm:"size:64"`
+	UpdatedAt time.Time
+}
+
+// creates an empty profile, users have one before they fill in any field
+func NewProfile(userID uint) *Profile {
+	return &Profile{UserID: userID}
+}
+
+func (p *Profile) ToDTO() *dtos.UserProfile {
+	return &dtos.UserProfile{
+		DisplayName:   p.DisplayName,
+		AvatarURL:     p.AvatarURL,
+		HasAvatar:     p.AvatarKey != "",
+		Phone:         p.Phone,
+		PhoneVerified: p.PhoneVerifiedAt != nil,
+		Locale:        p.Locale,
+		Timezone:      p.Timezone,
+		UpdatedAt:     p.UpdatedAt,
+	}
+}
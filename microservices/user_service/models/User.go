@@ -1,26 +1,62 @@
 package models
 
-import "user-service/dtos"
+import (
+	"time"
+	"user-service/dtos"
 
+	"gorm.io/gorm"
+)
+
+// statuses a user can have
+const (
+	StatusActive = "active"
+	//suspended users are blocked by an admin
+	StatusSuspended = "suspended"
+	//deactivated users closed their account without deleting it
+	StatusDeactivated = "deactivated"
+)
+
+// User is a user's profile, their password is stored by the auth service
 type User struct {
-	ID       uint `gorm:"primaryKey"`
-	Name     string
-	Email    string `gorm:"unique"`
-	Password string
+	ID     uint   `gorm:"primaryKey"`
+	Name   string `gorm:"index;size:255"`
+	Email  string `gorm:"unique;size:255"`
+	Status string `gorm:"not null;default:active;index;size:32"`
+	//why the status was last changed and when
+	StatusReason    string `gorm:"size:500"`
+	StatusChangedAt *time.Time
+	CreatedAt       time.Time `gorm:"index"`
+	UpdatedAt       time.Time
+	//incremented on every change, updates only succeed against the version they were made from
+	Version uint `gorm:"not null;default:1"`
+	//deleted users are hidden from every query until they're restored or purged. Their email is moved aside so it
+	//can be released for new users, and put back when they're restored
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	DeletedEmail string         `gorm:"index;size:255"`
 }
 
-func NewUser(name, email, password string) *User {
+func NewUser(name, email string) *User {
 	return &User{
-		Name:     name,
-		Email:    email,
-		Password: password,
+		Name:    name,
+		Email:   email,
+		Status:  StatusActive,
+		Version: 1,
 	}
 }
 
+// whether the user's personal data was erased, erased users stay deleted until they're purged
+func (u *User) Erased() bool {
+	return u.DeletedAt.Valid && u.DeletedEmail == ""
+}
+
 func (u *User) ToUserDTO() *dtos.User {
 	return &dtos.User{
-		Id:    u.ID,
-		Name:  u.Name,
-		Email: u.Email,
+		Id:           u.ID,
+		Name:         u.Name,
+		Email:        u.Email,
+		Status:       u.Status,
+		StatusReason: u.StatusReason,
+		CreatedAt:    u.CreatedAt,
+		Version:      u.Version,
 	}
 }
@@ -2,11 +2,16 @@ package repository
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 	"user-service/config"
+	e "user-service/errors"
 	. "user-service/models"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MysqlUserRepository struct {
@@ -32,9 +37,15 @@ func NewMysqlUserRepository(db *gorm.DB) UserRepository {
 		}
 	}
 
-	if err := db.AutoMigrate(&User{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &OutboxMessage{}, &Profile{}, &PhoneVerification{}, &Preference{}, &DataRequest{}); err != nil {
 		panic("failed to migrate database: " + err.Error())
 	}
+	//gorm can't declare FULLTEXT indexes portably, other databases fall back to LIKE when searching
+	if db.Dialector.Name() == "mysql" && !db.Migrator().HasIndex(&User{}, userSearchIndex) {
+		if err := db.Exec("CREATE FULLTEXT INDEX " + userSearchIndex + " ON users (name, email)").Error; err != nil {
+			panic("failed to create search index: " + err.Error())
+		}
+	}
 
 	return MysqlUserRepository{
 		DB: db,
@@ -51,6 +62,142 @@ func (r MysqlUserRepository) FindByID(id uint) (*User, error) {
 	return &user, nil
 }
 
+// columns users can be sorted by
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+func (r MysqlUserRepository) FindAll(options UserListOptions) ([]User, int64, error) {
+	column, ok := userSortColumns[options.SortField]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort field %q", options.SortField)
+	}
+
+	query := r.DB.Model(&User{})
+	filter := options.Filter
+	if filter.EmailContains != "" {
+		query = query.Where("email LIKE ? ESCAPE '!'", "%"+escapeLike(filter.EmailContains)+"%")
+	}
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	//ties are broken by id so the order, and with it every cursor, is stable
+	direction, comparison := "ASC", ">"
+	if options.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	page := query.Session(&gorm.Session{})
+	if options.After != nil {
+		value := userSortValue(options.After, column)
+		if column == "id" {
+			page = page.Where("id "+comparison+" ?", options.After.ID)
+		} else {
+			page = page.Where("("+column+" "+comparison+" ?) OR ("+column+" = ? AND id "+comparison+" ?)", value, value, options.After.ID)
+		}
+	} else {
+		page = page.Offset(options.Offset)
+	}
+
+	var users []User
+	result := page.Order(column + " " + direction).Order("id " + direction).Limit(options.Limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
+}
+
+// FULLTEXT index over the name and email of users
+const userSearchIndex = "idx_users_search"
+
+func (r MysqlUserRepository) Search(terms, prefixes []string, limit int) ([]User, error) {
+	var users []User
+	if len(terms) == 0 {
+		return users, nil
+	}
+
+	query := r.DB.Model(&User{})
+	var rank clause.Expr
+	if r.DB.Dialector.Name() == "mysql" {
+		//without + any word matches, the boolean mode relevance ranks users matching more of the terms first and
+		//users only matching a prefix last
+		against := func(words []string) string {
+			wildcards := make([]string, len(words))
+			for i, word := range words {
+				wildcards[i] = word + "*"
+			}
+			return strings.Join(wildcards, " ")
+		}
+		widened := against(append(slices.Clone(terms), prefixes...))
+		query = query.Where("MATCH(name, email) AGAINST (? IN BOOLEAN MODE)", widened)
+		rank = clause.Expr{
+			SQL:  "MATCH(name, email) AGAINST (? IN BOOLEAN MODE) DESC, MATCH(name, email) AGAINST (? IN BOOLEAN MODE) DESC",
+			Vars: []interface{}{against(terms), widened},
+		}
+	} else {
+		condition := r.DB.Where("1 = 0")
+		for _, word := range append(slices.Clone(terms), prefixes...) {
+			pattern := "%" + escapeLike(word) + "%"
+			condition = condition.Or("name LIKE ? ESCAPE '!'", pattern).Or("email LIKE ? ESCAPE '!'", pattern)
+		}
+		query = query.Where(condition)
+
+		//users are ranked by how many of the terms they match
+		matches := make([]string, len(terms))
+		for i, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			matches[i] = "CASE WHEN name LIKE ? ESCAPE '!' OR email LIKE ? ESCAPE '!' THEN 1 ELSE 0 END"
+			rank.Vars = append(rank.Vars, pattern, pattern)
+		}
+		rank.SQL = strings.Join(matches, " + ") + " DESC"
+	}
+
+	//an order by expression replaces the columns given to Order, so the id is part of it
+	rank.SQL += ", id"
+	result := query.Clauses(clause.OrderBy{Expression: rank}).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// the value of the sort column for a user
+func userSortValue(user *User, column string) interface{} {
+	switch column {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "created_at":
+		return user.CreatedAt
+	default:
+		return user.ID
+	}
+}
+
+// escapes the wildcards of a LIKE pattern using ! as the escape character, which needs no quoting in any database
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
+
 func (r MysqlUserRepository) ExistsByID(id uint) (bool, error) {
 	var count int64
 	result := r.DB.Model(&User{}).Where("id = ?", id).Count(&count)
@@ -69,6 +216,15 @@ func (r MysqlUserRepository) ExistsByEmail(email string) (bool, error) {
 	return count > 0, nil
 }
 
+func (r MysqlUserRepository) ExistsDeletedByEmail(email string) (bool, error) {
+	var count int64
+	result := r.DB.Unscoped().Model(&User{}).Where("deleted_at IS NOT NULL AND deleted_email = ?", email).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
 func (r MysqlUserRepository) Create(user *User) (*User, error) {
 	result := r.DB.Create(user)
 	if result.Error != nil {
@@ -78,14 +234,314 @@ func (r MysqlUserRepository) Create(user *User) (*User, error) {
 }
 
 func (r MysqlUserRepository) Update(user *User) (*User, error) {
-	result := r.DB.Save(user)
+	version := user.Version
+	user.Version++
+	result := r.DB.Model(user).Where("version = ?", version).Select("*").Omit("id", "created_at").Updates(user)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = e.ErrVersionConflict
+	}
 	if result.Error != nil {
+		user.Version = version
 		return nil, result.Error
 	}
 	return user, nil
 }
 
-func (r MysqlUserRepository) Delete(id uint) error {
-	result := r.DB.Delete(&User{ID: id})
-	return result.Error
+func (r MysqlUserRepository) Delete(id uint, version uint) error {
+	//emails are unique, so a deleted user's email is moved aside to be reusable. It's copied before it's cleared in a
+	//separate statement, the order columns are assigned in within one statement differs between databases
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND version = ?", id, version).Update("deleted_email", gorm.Expr("email"))
+		if result.Error == nil && result.RowsAffected == 0 {
+			return e.ErrVersionConflict
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Model(&User{}).Where("id = ? AND version = ?", id, version).Updates(map[string]interface{}{
+			"deleted_at": time.Now(),
+			"email":      nil,
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+	})
+}
+
+func (r MysqlUserRepository) FindDeletedByEmail(email string) ([]User, error) {
+	var users []User
+	result := r.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_email = ?", email).Order("id").Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+func (r MysqlUserRepository) FindDeletedByID(id uint) (*User, error) {
+	var user User
+	result := r.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&user, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+func (r MysqlUserRepository) Restore(user *User) error {
+	result := r.DB.Unscoped().Model(&User{}).Where("id = ? AND version = ? AND deleted_at IS NOT NULL", user.ID, user.Version).
+		Updates(map[string]interface{}{
+			"deleted_at":    nil,
+			"email":         user.DeletedEmail,
+			"deleted_email": "",
+			"version":       user.Version + 1,
+		})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return e.ErrVersionConflict
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	user.Email, user.DeletedEmail = user.DeletedEmail, ""
+	user.Version++
+	return nil
+}
+
+func (r MysqlUserRepository) FindDeletedBefore(cutoff time.Time, limit int) ([]User, error) {
+	var users []User
+	result := r.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Order("deleted_at").Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+func (r MysqlUserRepository) Purge(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&User{ID: id})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Delete(&Profile{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&PhoneVerification{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Preference{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&DataRequest{}, "user_id = ?", id).Error
+	})
+}
+
+func (r MysqlUserRepository) Erase(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"deleted_at":    gorm.Expr("COALESCE(deleted_at, ?)", time.Now()),
+			"deleted_email": "",
+			"email":         nil,
+			"name":          "",
+			"status_reason": "",
+			"version":       gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&Profile{}, &PhoneVerification{}, &Preference{}} {
+			if err := tx.Delete(model, "user_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+
+		//events published before the erasure carried the user's name and email
+		return tx.Model(&OutboxMessage{}).Where("aggregate_type = ? AND aggregate_id = ?", "user", id).
+			Update("payload", fmt.Sprintf(`{"id":%d}`, id)).Error
+	})
+}
+
+func (r MysqlUserRepository) FindProfile(userID uint) (*Profile, error) {
+	var profile Profile
+	result := r.DB.First(&profile, "user_id = ?", userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &profile, nil
+}
+
+func (r MysqlUserRepository) SaveProfile(profile *Profile) error {
+	return r.DB.Save(profile).Error
+}
+
+func (r MysqlUserRepository) FindPhoneVerification(userID uint) (*PhoneVerification, error) {
+	var verification PhoneVerification
+	result := r.DB.First(&verification, "user_id = ?", userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &verification, nil
+}
+
+func (r MysqlUserRepository) SavePhoneVerification(verification *PhoneVerification) error {
+	return r.DB.Save(verification).Error
+}
+
+func (r MysqlUserRepository) DeletePhoneVerification(userID uint) error {
+	return r.DB.Delete(&PhoneVerification{}, "user_id = ?", userID).Error
+}
+
+func (r MysqlUserRepository) FindPreferences(userID uint, namespace string, keys []string) ([]Preference, error) {
+	query := r.DB.Where("user_id = ?", userID)
+	if namespace != "" {
+		query = query.Where("namespace = ?", namespace)
+	}
+	if len(keys) > 0 {
+		query = query.Where("`key` IN ?", keys)
+	}
+
+	var preferences []Preference
+	if err := query.Order("`key`").Find(&preferences).Error; err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func (r MysqlUserRepository) FindPreference(userID uint, key string) (*Preference, error) {
+	var preference Preference
+	result := r.DB.First(&preference, "user_id = ? AND `key` = ?", userID, key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &preference, nil
+}
+
+func (r MysqlUserRepository) SavePreference(preference *Preference) error {
+	return r.DB.Save(preference).Error
+}
+
+func (r MysqlUserRepository) DeletePreference(userID uint, key string) (bool, error) {
+	result := r.DB.Delete(&Preference{}, "user_id = ? AND `key` = ?", userID, key)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r MysqlUserRepository) CountPreferences(userID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&Preference{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r MysqlUserRepository) CreateDataRequest(request *DataRequest) error {
+	return r.DB.Create(request).Error
+}
+
+func (r MysqlUserRepository) FindDataRequest(userID, id uint) (*DataRequest, error) {
+	var request DataRequest
+	result := r.DB.First(&request, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &request, nil
+}
+
+func (r MysqlUserRepository) FindDataRequests(userID uint) ([]DataRequest, error) {
+	var requests []DataRequest
+	if err := r.DB.Where("user_id = ?", userID).Order("id DESC").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r MysqlUserRepository) FindDataRequestsToProcess(staleBefore time.Time, limit int) ([]DataRequest, error) {
+	var requests []DataRequest
+	err := r.DB.Where("status = ? OR (status = ? AND updated_at < ?)", DataRequestPending, DataRequestProcessing, staleBefore).
+		Order("id").Limit(limit).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r MysqlUserRepository) ClaimDataRequest(request *DataRequest) (bool, error) {
+	//attempts is only incremented here, so it tells whether another instance claimed the request in the meantime
+	now := time.Now()
+	result := r.DB.Model(&DataRequest{}).Where("id = ? AND attempts = ?", request.ID, request.Attempts).Updates(map[string]interface{}{
+		"status":     DataRequestProcessing,
+		"attempts":   request.Attempts + 1,
+		"updated_at": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	request.Status = DataRequestProcessing
+	request.Attempts++
+	request.UpdatedAt = now
+	return true, nil
+}
+
+func (r MysqlUserRepository) SaveDataRequest(request *DataRequest) error {
+	return r.DB.Save(request).Error
+}
+
+func (r MysqlUserRepository) FindExpiredDataExports(cutoff time.Time, limit int) ([]DataRequest, error) {
+	var requests []DataRequest
+	err := r.DB.Where("archive_key <> '' AND archive_expires_at < ?", cutoff).Order("id").Limit(limit).Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r MysqlUserRepository) WithTransaction(fn func(repo UserRepository) error) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(MysqlUserRepository{DB: tx})
+	})
+}
+
+func (r MysqlUserRepository) CreateOutboxMessage(message *OutboxMessage) error {
+	return r.DB.Create(message).Error
+}
+
+func (r MysqlUserRepository) FindDueOutboxMessages(now time.Time, limit int) ([]OutboxMessage, error) {
+	//messages waiting behind one of the same aggregate that isn't due yet are left out, so they can't fill the batch
+	//and keep other aggregates' messages from being published
+	notDue := r.DB.Table("outbox_messages AS waiting").Select("1").
+		Where("waiting.delivered_at IS NULL AND waiting.next_attempt_at > ?", now).
+		Where("waiting.aggregate_type = outbox_messages.aggregate_type AND waiting.aggregate_id = outbox_messages.aggregate_id").
+		Where("waiting.id <= outbox_messages.id")
+
+	var messages []OutboxMessage
+	result := r.DB.Where("delivered_at IS NULL").Where("NOT EXISTS (?)", notDue).Order("id").Limit(limit).Find(&messages)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return messages, nil
+}
+
+func (r MysqlUserRepository) MarkOutboxMessageDelivered(id uint, deliveredAt time.Time) error {
+	return r.DB.Model(&OutboxMessage{}).Where("id = ?", id).Update("delivered_at", deliveredAt).Error
+}
+
+func (r MysqlUserRepository) MarkOutboxMessageFailed(id uint, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return r.DB.Model(&OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
+
+func (r MysqlUserRepository) OutboxBacklog() (int64, *time.Time, error) {
+	var pending int64
+	if err := r.DB.Model(&OutboxMessage{}).Where("delivered_at IS NULL").Count(&pending).Error; err != nil {
+		return 0, nil, err
+	}
+	if pending == 0 {
+		return 0, nil, nil
+	}
+
+	var oldest OutboxMessage
+	if err := r.DB.Where("delivered_at IS NULL").Order("id").First(&oldest).Error; err != nil {
+		return 0, nil, err
+	}
+	return pending, &oldest.CreatedAt, nil
 }
@@ -1,21 +1,111 @@
 package repository
 
 import (
+	"time"
 	. "user-service/models"
 )
 
+// UserFilter narrows down user lists, zero values match everything
+type UserFilter struct {
+	EmailContains string
+	Name          string
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// UserListOptions selects a page of users. When After is set the page starts after that user in the sort
+// order (keyset pagination) and Offset is ignored
+type UserListOptions struct {
+	Filter     UserFilter
+	SortField  string
+	Descending bool
+	Offset     int
+	Limit      int
+	After      *User
+}
+
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	// function used to find a user given an id
 	FindByID(id uint) (*User, error)
+	// function used to list users, returning a page and the number of users matching the filter
+	FindAll(options UserListOptions) ([]User, int64, error)
+	// function used to find users with a word in their name or email starting with one of the terms or, to find
+	// misspellings of them, one of the prefixes. Users matching the terms come first
+	Search(terms, prefixes []string, limit int) ([]User, error)
 	// function used to see if a user exists by an id
 	ExistsByID(id uint) (bool, error)
 	//function used to see if a user exists by an email
 	ExistsByEmail(email string) (bool, error)
+	//function used to see if a deleted user had an email
+	ExistsDeletedByEmail(email string) (bool, error)
+	//function used to find the deleted users who had an email
+	FindDeletedByEmail(email string) ([]User, error)
 	//function used to see create a user
 	Create(user *User) (*User, error)
-	//function used to update a user
+	//function used to update a user if it's still at user.Version, incrementing the version. Returns ErrVersionConflict otherwise
 	Update(user *User) (*User, error)
-	//function used to delete a user
-	Delete(id uint) error
+	//function used to soft delete a user if it's still at the given version. Returns ErrVersionConflict otherwise
+	Delete(id uint, version uint) error
+	//function used to find a soft deleted user given an id
+	FindDeletedByID(id uint) (*User, error)
+	//function used to undo the soft delete of a user if it's still at user.Version, incrementing the version.
+	//Returns ErrVersionConflict otherwise
+	Restore(user *User) error
+	//function used to find users soft deleted before the cutoff, oldest first
+	FindDeletedBefore(cutoff time.Time, limit int) ([]User, error)
+	//function used to permanently remove a soft deleted user along with their profile, preferences and data requests
+	Purge(id uint) error
+	//function used to find a user's profile, ErrRecordNotFound until it was first saved
+	FindProfile(userID uint) (*Profile, error)
+	//function used to create or replace a user's profile
+	SaveProfile(profile *Profile) error
+	//function used to find the pending phone verification of a user
+	FindPhoneVerification(userID uint) (*PhoneVerification, error)
+	//function used to create or replace the pending phone verification of a user
+	SavePhoneVerification(verification *PhoneVerification) error
+	//function used to remove the pending phone verification of a user, if there is one
+	DeletePhoneVerification(userID uint) error
+	//function used to find a user's preferences ordered by key, limited to a namespace and keys unless they're empty
+	FindPreferences(userID uint, namespace string, keys []string) ([]Preference, error)
+	//function used to find one of a user's preferences
+	FindPreference(userID uint, key string) (*Preference, error)
+	//function used to create or replace a preference
+	SavePreference(preference *Preference) error
+	//function used to remove a preference, returning whether there was one
+	DeletePreference(userID uint, key string) (bool, error)
+	//function used to count a user's preferences
+	CountPreferences(userID uint) (int64, error)
+	//function used to anonymize a user, soft deleting them if they aren't yet, and remove their profile, phone
+	//verification and preferences. The payloads of their outbox messages are reduced to their id
+	Erase(id uint) error
+	//function used to store a new data request
+	CreateDataRequest(request *DataRequest) error
+	//function used to find one of a user's data requests
+	FindDataRequest(userID, id uint) (*DataRequest, error)
+	//function used to find a user's data requests, newest first
+	FindDataRequests(userID uint) ([]DataRequest, error)
+	//function used to find pending data requests and ones that started processing before staleBefore, oldest first
+	FindDataRequestsToProcess(staleBefore time.Time, limit int) ([]DataRequest, error)
+	//function used to start processing a data request if no one else did since it was loaded, incrementing its
+	//attempts. Returns whether it was claimed
+	ClaimDataRequest(request *DataRequest) (bool, error)
+	//function used to store the outcome of processing a data request
+	SaveDataRequest(request *DataRequest) error
+	//function used to find data requests whose export archive expired before the cutoff
+	FindExpiredDataExports(cutoff time.Time, limit int) ([]DataRequest, error)
+	//runs fn in a transaction, every change made through the repository given to fn is committed or rolled back together
+	WithTransaction(fn func(repo UserRepository) error) error
+	//function used to store an event to be published by the outbox relay
+	CreateOutboxMessage(message *OutboxMessage) error
+	//function used to find undelivered outbox messages that are due in the order they were written, leaving out
+	//messages written after one of the same aggregate that isn't due yet
+	FindDueOutboxMessages(now time.Time, limit int) ([]OutboxMessage, error)
+	//function used to mark an outbox message as published
+	MarkOutboxMessageDelivered(id uint, deliveredAt time.Time) error
+	//function used to record a failed attempt to publish an outbox message
+	MarkOutboxMessageFailed(id uint, attempts int, nextAttemptAt time.Time, lastError string) error
+	//function used to get the number of undelivered outbox messages and when the oldest was written
+	OutboxBacklog() (pending int64, oldest *time.Time, err error)
 }
@@ -0,0 +1,247 @@
+package userservice
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"user-service/blob"
+	"user-service/config"
+	"user-service/dtos"
+	e "user-service/errors"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// AvatarOriginal is the size of the full avatar, scaled down to fit avatarMaxDimension
+const AvatarOriginal = 0
+
+// sizes of the square thumbnails made of every avatar, in pixels
+var AvatarSizes = []int{64, 128, 256}
+
+// the full avatar is scaled down to fit this many pixels on each side
+const avatarMaxDimension = 1024
+
+// larger images are rejected before they're decoded, so a small file can't expand into a huge bitmap
+const avatarMaxSourceDimension = 8192
+
+// formats avatars can be uploaded in, by the media type their content is sniffed as
+var avatarDecoders = map[string]func(io.Reader) (image.Image, error){
+	"image/jpeg": jpeg.Decode,
+	"image/png":  png.Decode,
+	"image/gif":  gif.Decode,
+	"image/webp": webp.Decode,
+}
+
+var avatarConfigDecoders = map[string]func(io.Reader) (image.Config, error){
+	"image/jpeg": jpeg.DecodeConfig,
+	"image/png":  png.DecodeConfig,
+	"image/gif":  gif.DecodeConfig,
+	"image/webp": webp.DecodeConfig,
+}
+
+// UploadAvatar validates an uploaded image and stores it re-encoded, without its metadata, along with its thumbnails.
+// The previous avatar is removed
+func (s *UserService) UploadAvatar(id uint, file io.Reader, declaredType string) (*dtos.UserProfile, *e.Error) {
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBytes := config.LoadConfig().AvatarMaxBytes
+	data, readErr := io.ReadAll(io.LimitReader(file, int64(maxBytes)+1))
+	if readErr != nil {
+		return nil, e.NewError(http.StatusBadRequest, "Failed to read avatar", readErr)
+	}
+	if len(data) > maxBytes {
+		return nil, e.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Avatar can't be larger than %d bytes", maxBytes), e.ErrInvalidUserData)
+	}
+
+	img, err := decodeAvatar(data, declaredType)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, encoded, encodeErr := encodeAvatars(img)
+	if encodeErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to encode avatar", encodeErr)
+	}
+
+	//every upload gets new keys, so the old avatar is served until the profile points at the new one
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to store avatar", err)
+	}
+	key := fmt.Sprintf("avatars/%d/%s", id, hex.EncodeToString(token))
+	for size, data := range encoded {
+		if err := s.Blobs.Put(avatarBlobKey(key, size), data); err != nil {
+			s.deleteAvatar(key)
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to store avatar", err)
+		}
+	}
+
+	previousKey := profile.AvatarKey
+	profile.AvatarKey = key
+	profile.AvatarType = contentType
+	if err := s.userRepo.SaveProfile(profile); err != nil {
+		s.deleteAvatar(key)
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to save profile", err)
+	}
+	if previousKey != "" {
+		s.deleteAvatar(previousKey)
+	}
+
+	return profile.ToDTO(), nil
+}
+
+// GetAvatar returns a user's avatar in one of AvatarSizes, or AvatarOriginal
+func (s *UserService) GetAvatar(id uint, size int) (*dtos.Avatar, *e.Error) {
+	if size != AvatarOriginal && !slices.Contains(AvatarSizes, size) {
+		return nil, e.NewValidationError("Invalid avatar size", map[string][]string{"size": {fmt.Sprintf("must be one of %v", AvatarSizes)}})
+	}
+
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	if profile.AvatarKey == "" {
+		return nil, e.NewError(http.StatusNotFound, "User has no avatar", e.ErrNotFound)
+	}
+
+	data, getErr := s.Blobs.Get(avatarBlobKey(profile.AvatarKey, size))
+	if getErr != nil {
+		if errors.Is(getErr, blob.ErrNotFound) {
+			return nil, e.NewError(http.StatusNotFound, "User has no avatar", getErr)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get avatar", getErr)
+	}
+
+	return &dtos.Avatar{
+		Data:        data,
+		ContentType: profile.AvatarType,
+		Version:     path.Base(profile.AvatarKey) + "-" + avatarSizeName(size),
+	}, nil
+}
+
+// checks an upload is an image in a supported format that isn't too large to decode, and decodes it
+func decodeAvatar(data []byte, declaredType string) (image.Image, *e.Error) {
+	contentType := http.DetectContentType(data)
+	decode, supported := avatarDecoders[contentType]
+	if !supported {
+		return nil, e.NewError(http.StatusUnsupportedMediaType, "Avatar must be a JPEG, PNG, GIF or WebP image", fmt.Errorf("%w: %s", e.ErrInvalidUserData, contentType))
+	}
+	//clients that don't know the type send octet-stream, anything else has to match the content
+	if declared, _, err := mime.ParseMediaType(declaredType); err == nil && declared != "application/octet-stream" && declared != contentType {
+		return nil, e.NewError(http.StatusUnsupportedMediaType, "Avatar content doesn't match its type "+declared, fmt.Errorf("%w: %s", e.ErrInvalidUserData, contentType))
+	}
+
+	imageConfig, err := avatarConfigDecoders[contentType](bytes.NewReader(data))
+	if err != nil {
+		return nil, e.NewError(http.StatusBadRequest, "Avatar isn't a valid image", err)
+	}
+	if imageConfig.Width > avatarMaxSourceDimension || imageConfig.Height > avatarMaxSourceDimension {
+		return nil, e.NewError(http.StatusBadRequest,
+			fmt.Sprintf("Avatar can't be larger than %dx%d pixels", avatarMaxSourceDimension, avatarMaxSourceDimension), e.ErrInvalidUserData)
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, e.NewError(http.StatusBadRequest, "Avatar isn't a valid image", err)
+	}
+	if img.Bounds().Empty() {
+		return nil, e.NewError(http.StatusBadRequest, "Avatar isn't a valid image", e.ErrInvalidUserData)
+	}
+	return img, nil
+}
+
+// encodes the full avatar and its thumbnails by size, images with transparency are kept as png and others become jpeg
+func encodeAvatars(img image.Image) (string, map[int][]byte, error) {
+	contentType := "image/png"
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		contentType = "image/jpeg"
+	}
+
+	bounds := img.Bounds()
+	scaled := map[int]image.Image{AvatarOriginal: fitAvatar(img, bounds)}
+	//thumbnails are cropped to the center square
+	side := min(bounds.Dx(), bounds.Dy())
+	square := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+	for _, size := range AvatarSizes {
+		thumbnail := image.NewRGBA(image.Rect(0, 0, size, size))
+		xdraw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, square, draw.Src, nil)
+		scaled[size] = thumbnail
+	}
+
+	encoded := map[int][]byte{}
+	for size, img := range scaled {
+		var buffer bytes.Buffer
+		var err error
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buffer, img)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		encoded[size] = buffer.Bytes()
+	}
+	return contentType, encoded, nil
+}
+
+// redraws the image so nothing but its pixels is kept, scaled down to fit avatarMaxDimension
+func fitAvatar(img image.Image, bounds image.Rectangle) image.Image {
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > avatarMaxDimension {
+		width = max(1, width*avatarMaxDimension/longest)
+		height = max(1, height*avatarMaxDimension/longest)
+	}
+
+	fitted := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(fitted, fitted.Bounds(), img, bounds.Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(fitted, fitted.Bounds(), img, bounds, draw.Src, nil)
+	}
+	return fitted
+}
+
+// removes every size of an avatar, failures are logged since the avatar isn't referenced anymore
+func (s *UserService) deleteAvatar(key string) {
+	if err := deleteAvatarBlobs(s.Blobs, key); err != nil {
+		log.Printf("failed to delete avatar %s: %v", key, err)
+	}
+}
+
+func deleteAvatarBlobs(store blob.BlobStore, key string) error {
+	var errs []error
+	for _, size := range append([]int{AvatarOriginal}, AvatarSizes...) {
+		errs = append(errs, store.Delete(avatarBlobKey(key, size)))
+	}
+	return errors.Join(errs...)
+}
+
+func avatarBlobKey(key string, size int) string {
+	return key + "/" + avatarSizeName(size)
+}
+
+func avatarSizeName(size int) string {
+	if size == AvatarOriginal {
+		return "original"
+	}
+	return strconv.Itoa(size)
+}
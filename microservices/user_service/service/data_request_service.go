@@ -0,0 +1,399 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"user-service/blob"
+	"user-service/config"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/events"
+	"user-service/models"
+	"user-service/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var dataRequestsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "user_service_data_requests_processed_total",
+	Help: "Number of data export and erasure requests processed, by type and resulting status.",
+}, []string{"type", "status"})
+
+// how many data requests are processed per run
+const dataRequestBatchSize = 20
+
+// requests still processing after this long are assumed to be abandoned by a crashed instance and picked up again
+const dataRequestTimeout = 15 * time.Minute
+
+// RequestDataExport asks for an archive of everything stored about a user, it's gathered in the background
+func (s *UserService) RequestDataExport(id uint) (*dtos.DataRequest, *e.Error) {
+	if _, err := s.findUser(id); err != nil {
+		return nil, err
+	}
+	return s.createDataRequest(id, models.DataRequestExport)
+}
+
+// RequestErasure asks for a user's personal data to be erased in every service, it's done in the background and
+// can't be undone. Deleted users can be erased before they're purged
+func (s *UserService) RequestErasure(id uint) (*dtos.DataRequest, *e.Error) {
+	if _, err := s.findUser(id); err != nil {
+		if err.Code != http.StatusNotFound {
+			return nil, err
+		}
+		user, findErr := s.userRepo.FindDeletedByID(id)
+		if findErr != nil {
+			if errors.Is(findErr, e.ErrRecordNotFound) {
+				return nil, err
+			}
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", findErr)
+		}
+		if user.Erased() {
+			return nil, e.NewError(http.StatusConflict, "User was erased already", e.ErrInvalidUserData)
+		}
+	}
+	return s.createDataRequest(id, models.DataRequestErasure)
+}
+
+func (s *UserService) createDataRequest(id uint, requestType string) (*dtos.DataRequest, *e.Error) {
+	requests, err := s.userRepo.FindDataRequests(id)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get data requests", err)
+	}
+	for i := range requests {
+		if requests[i].Type == requestType && requests[i].Unfinished() {
+			return nil, e.NewError(http.StatusConflict, fmt.Sprintf("An %s request is in progress already", requestType),
+				fmt.Errorf("%w: request %d is %s", e.ErrInvalidUserData, requests[i].ID, requests[i].Status))
+		}
+	}
+
+	request := models.NewDataRequest(id, requestType)
+	if err := s.userRepo.CreateDataRequest(request); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to create data request", err)
+	}
+	return request.ToDTO(), nil
+}
+
+// GetDataRequests lists a user's export and erasure requests newest first, they can be checked after the user was
+// erased
+func (s *UserService) GetDataRequests(id uint) (*dtos.DataRequests, *e.Error) {
+	requests, err := s.userRepo.FindDataRequests(id)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get data requests", err)
+	}
+
+	list := &dtos.DataRequests{Requests: make([]*dtos.DataRequest, 0, len(requests))}
+	for i := range requests {
+		list.Requests = append(list.Requests, requests[i].ToDTO())
+	}
+	return list, nil
+}
+
+// GetDataRequest returns one of a user's export or erasure requests
+func (s *UserService) GetDataRequest(id, requestID uint) (*dtos.DataRequest, *e.Error) {
+	request, err := s.findDataRequest(id, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return request.ToDTO(), nil
+}
+
+// GetDataExportArchive returns the json archive of a completed export until it expires
+func (s *UserService) GetDataExportArchive(id, requestID uint) ([]byte, *e.Error) {
+	request, err := s.findDataRequest(id, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Type != models.DataRequestExport {
+		return nil, e.NewError(http.StatusNotFound, "Only export requests have an archive", e.ErrNotFound)
+	}
+	if request.Status != models.DataRequestCompleted {
+		return nil, e.NewError(http.StatusConflict, "Export is "+request.Status, e.ErrInvalidUserData)
+	}
+	if request.ArchiveKey == "" {
+		return nil, e.NewError(http.StatusGone, "Export archive expired, request a new export", e.ErrNotFound)
+	}
+
+	archive, getErr := s.Blobs.Get(request.ArchiveKey)
+	if getErr != nil {
+		if errors.Is(getErr, blob.ErrNotFound) {
+			return nil, e.NewError(http.StatusGone, "Export archive expired, request a new export", getErr)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get export archive", getErr)
+	}
+	return archive, nil
+}
+
+func (s *UserService) findDataRequest(id, requestID uint) (*models.DataRequest, *e.Error) {
+	request, err := s.userRepo.FindDataRequest(id, requestID)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusNotFound, "Data request doesn't exist", e.ErrNotFound)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get data request", err)
+	}
+	return request, nil
+}
+
+// DataRequestProcessor carries out export and erasure requests in the background, retrying failed ones
+type DataRequestProcessor struct {
+	service     *UserService
+	repo        repository.UserRepository
+	interval    time.Duration
+	maxAttempts int
+	retention   time.Duration
+}
+
+// creates a processor for the service's data requests
+func NewDataRequestProcessor(s *UserService) *DataRequestProcessor {
+	conf := config.LoadConfig()
+	return &DataRequestProcessor{
+		service:     s,
+		repo:        s.userRepo,
+		interval:    conf.DataRequestPollInterval,
+		maxAttempts: conf.DataRequestMaxAttempts,
+		retention:   conf.DataExportRetention,
+	}
+}
+
+// processes data requests until ctx is cancelled
+func (p *DataRequestProcessor) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.RunOnce(); err != nil {
+			log.Printf("data request processing failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// removes expired export archives and processes a batch of requests, returning how many were processed
+func (p *DataRequestProcessor) RunOnce() (int, error) {
+	if err := p.expireArchives(); err != nil {
+		return 0, err
+	}
+
+	requests, err := p.repo.FindDataRequestsToProcess(time.Now().Add(-dataRequestTimeout), dataRequestBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for i := range requests {
+		request := &requests[i]
+		claimed, err := p.repo.ClaimDataRequest(request)
+		if err != nil {
+			return processed, err
+		}
+		if !claimed {
+			continue
+		}
+
+		processErr := p.process(request)
+		now := time.Now()
+		switch {
+		case processErr == nil:
+			request.Status = models.DataRequestCompleted
+			request.CompletedAt = &now
+			request.LastError = ""
+		case request.Attempts >= p.maxAttempts:
+			request.Status = models.DataRequestFailed
+			request.CompletedAt = &now
+			request.LastError = processErr.Error()
+		default:
+			request.Status = models.DataRequestPending
+			request.LastError = processErr.Error()
+		}
+		if processErr != nil {
+			log.Printf("%s request %d of user %d failed: %v", request.Type, request.ID, request.UserID, processErr)
+		}
+
+		if err := p.repo.SaveDataRequest(request); err != nil {
+			return processed, err
+		}
+		dataRequestsProcessed.WithLabelValues(request.Type, request.Status).Inc()
+		processed++
+	}
+	return processed, nil
+}
+
+func (p *DataRequestProcessor) process(request *models.DataRequest) error {
+	switch request.Type {
+	case models.DataRequestExport:
+		return p.export(request)
+	case models.DataRequestErasure:
+		return p.erase(request)
+	default:
+		return fmt.Errorf("unknown data request type %q", request.Type)
+	}
+}
+
+// gathers the user's data from this service and the auth service into an archive in the blob store
+func (p *DataRequestProcessor) export(request *models.DataRequest) error {
+	user, err := p.repo.FindByID(request.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	profile, err := p.repo.FindProfile(user.ID)
+	if errors.Is(err, e.ErrRecordNotFound) {
+		profile, err = models.NewProfile(user.ID), nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	preferences, err := p.repo.FindPreferences(user.ID, "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to get preferences: %w", err)
+	}
+	requests, err := p.repo.FindDataRequests(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get data requests: %w", err)
+	}
+
+	authData, err := p.service.PersonalData.ExportUserData(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to export auth service data: %w", err)
+	}
+
+	export := dtos.DataExport{
+		UserID:       user.ID,
+		GeneratedAt:  time.Now().UTC(),
+		User:         user.ToUserDTO(),
+		Profile:      profile.ToDTO(),
+		Preferences:  map[string]json.RawMessage{},
+		DataRequests: make([]*dtos.DataRequest, 0, len(requests)),
+		Auth:         authData,
+	}
+	for _, preference := range preferences {
+		export.Preferences[preference.Key] = json.RawMessage(preference.Value)
+	}
+	for i := range requests {
+		export.DataRequests = append(export.DataRequests, requests[i].ToDTO())
+	}
+
+	archive, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//the key can't be guessed from the request, the archive is only reachable through the request
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("exports/%d/%d-%s.json", user.ID, request.ID, hex.EncodeToString(token))
+	if err := p.service.Blobs.Put(key, archive); err != nil {
+		return fmt.Errorf("failed to store export archive: %w", err)
+	}
+
+	expiresAt := time.Now().Add(p.retention)
+	request.ArchiveKey = key
+	request.ArchiveExpiresAt = &expiresAt
+	return nil
+}
+
+// erases the user in the auth service first, so their sessions end even if the rest fails and is retried, then
+// anonymizes them here and tells the other services
+func (p *DataRequestProcessor) erase(request *models.DataRequest) error {
+	id := request.UserID
+	if err := p.service.PersonalData.EraseUserData(id); err != nil {
+		return fmt.Errorf("failed to erase auth service data: %w", err)
+	}
+	if err := deleteUserBlobs(p.repo, p.service.Blobs, id); err != nil {
+		return fmt.Errorf("failed to delete files: %w", err)
+	}
+
+	//exports that didn't finish yet would gather data that's about to be gone
+	requests, err := p.repo.FindDataRequests(id)
+	if err != nil {
+		return err
+	}
+	for i := range requests {
+		other := &requests[i]
+		if other.ID == request.ID || other.Type != models.DataRequestExport || !other.Unfinished() {
+			continue
+		}
+		now := time.Now()
+		other.Status = models.DataRequestFailed
+		other.LastError = "user was erased"
+		other.CompletedAt = &now
+		if err := p.repo.SaveDataRequest(other); err != nil {
+			return err
+		}
+	}
+
+	return p.repo.WithTransaction(func(repo repository.UserRepository) error {
+		if err := repo.Erase(id); err != nil {
+			return err
+		}
+		if err := enqueue(repo, events.UserErased, &models.User{ID: id}); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// removes expired export archives, keeping the requests
+func (p *DataRequestProcessor) expireArchives() error {
+	requests, err := p.repo.FindExpiredDataExports(time.Now(), dataRequestBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range requests {
+		if err := p.service.Blobs.Delete(requests[i].ArchiveKey); err != nil {
+			return err
+		}
+		requests[i].ArchiveKey = ""
+		if err := p.repo.SaveDataRequest(&requests[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes a user's avatar and export archives, clearing the archives from their requests
+func deleteUserBlobs(repo repository.UserRepository, store blob.BlobStore, id uint) error {
+	profile, err := repo.FindProfile(id)
+	if err != nil && !errors.Is(err, e.ErrRecordNotFound) {
+		return err
+	}
+	if profile != nil && profile.AvatarKey != "" {
+		if err := deleteAvatarBlobs(store, profile.AvatarKey); err != nil {
+			return err
+		}
+	}
+
+	requests, err := repo.FindDataRequests(id)
+	if err != nil {
+		return err
+	}
+	for i := range requests {
+		if requests[i].ArchiveKey == "" {
+			continue
+		}
+		if err := store.Delete(requests[i].ArchiveKey); err != nil {
+			return err
+		}
+		requests[i].ArchiveKey = ""
+		if err := repo.SaveDataRequest(&requests[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
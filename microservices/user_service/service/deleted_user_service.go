@@ -0,0 +1,189 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"user-service/authclient"
+	"user-service/blob"
+	"user-service/config"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/events"
+	"user-service/models"
+	"user-service/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var usersPurged = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "user_service_users_purged_total",
+	Help: "Number of deleted users permanently removed.",
+})
+
+// how many deleted users are purged per query
+const purgeBatchSize = 100
+
+// RestoreUser undoes the deletion of a user who wasn't purged yet, enabling the credential that was disabled when they
+// were deleted
+func (s *UserService) RestoreUser(id uint) (*dtos.User, *e.Error) {
+	user, err := s.userRepo.FindDeletedByID(id)
+	if err != nil {
+		if !errors.Is(err, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
+		}
+		if exists, err := s.userRepo.ExistsByID(id); err == nil && exists {
+			return nil, e.NewError(http.StatusConflict, "User isn't deleted", e.ErrInvalidUserData)
+		}
+		return nil, e.NewError(http.StatusNotFound, "User doesn't exist or was purged", e.ErrRecordNotFound)
+	}
+
+	if user.Erased() {
+		return nil, e.NewError(http.StatusConflict, "User was erased and can't be restored", e.ErrInvalidUserData)
+	}
+
+	//only possible when deleted users' emails are released
+	taken, err := s.userRepo.ExistsByEmail(user.DeletedEmail)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+	}
+	if taken {
+		return nil, e.NewError(http.StatusConflict, "The user's email was taken by another user", e.ErrUserExists)
+	}
+
+	txErr := s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		if err := repo.Restore(user); err != nil {
+			if errors.Is(err, e.ErrVersionConflict) {
+				return versionConflict(err)
+			}
+			return e.NewError(http.StatusInternalServerError, "Failed to restore user", err)
+		}
+		return enqueue(repo, events.UserRestored, user)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	//suspended users have to stay blocked, the user is deleted again when the auth service can't be told
+	err = s.Credentials.SetCredentialStatus(user.ID, user.Status, user.StatusReason)
+	if credentialMissing(err) {
+		//the credential is gone when the user's email was released to someone else in the meantime, it's recreated
+		//without a password
+		if err = s.Credentials.SetCredential(user.ID, user.Email, user.Name, ""); err == nil && user.Status != models.StatusActive {
+			err = s.Credentials.SetCredentialStatus(user.ID, user.Status, user.StatusReason)
+		}
+	}
+	if err != nil {
+		s.undo("restore", user.ID, func(repo repository.UserRepository) *e.Error {
+			if err := repo.Delete(user.ID, user.Version); err != nil {
+				return e.NewError(http.StatusInternalServerError, "Failed to delete user", err)
+			}
+			return enqueue(repo, events.UserDeleted, &models.User{ID: user.ID})
+		})
+		return nil, credentialError(err)
+	}
+
+	return user.ToUserDTO(), nil
+}
+
+// removes the credentials of deleted users whose email is about to be taken by another user, when deleted users'
+// emails are released. The auth service would otherwise refuse to give the email to the new user
+func (s *UserService) releaseDeletedEmail(email string) *e.Error {
+	if !s.releaseDeletedEmails {
+		return nil
+	}
+
+	users, err := s.userRepo.FindDeletedByEmail(email)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+	}
+	for _, user := range users {
+		if err := s.Credentials.DeleteCredential(user.ID); err != nil && !credentialMissing(err) {
+			return credentialError(err)
+		}
+	}
+	return nil
+}
+
+// UserPurger permanently removes users who were deleted longer ago than the retention period
+type UserPurger struct {
+	repo        repository.UserRepository
+	credentials authclient.CredentialStore
+	blobs       blob.BlobStore
+	interval    time.Duration
+	retention   time.Duration
+}
+
+// creates a purger for the service's users
+func NewUserPurger(s *UserService) *UserPurger {
+	conf := config.LoadConfig()
+	return &UserPurger{
+		repo:        s.userRepo,
+		credentials: s.Credentials,
+		blobs:       s.Blobs,
+		interval:    conf.PurgeInterval,
+		retention:   conf.DeletedUserRetention,
+	}
+}
+
+// purges users until ctx is cancelled
+func (p *UserPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.RunOnce(); err != nil {
+			log.Printf("user purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purges every user deleted before the retention period, returning how many were purged
+func (p *UserPurger) RunOnce() (int, error) {
+	cutoff := time.Now().Add(-p.retention)
+	purged := 0
+
+	for {
+		users, err := p.repo.FindDeletedBefore(cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for i := range users {
+			//the credential and files are removed before the rows referencing them, so they're never left behind
+			if err := p.credentials.DeleteCredential(users[i].ID); err != nil && !credentialMissing(err) {
+				return purged, err
+			}
+			if err := deleteUserBlobs(p.repo, p.blobs, users[i].ID); err != nil {
+				return purged, err
+			}
+			err := p.repo.WithTransaction(func(repo repository.UserRepository) error {
+				if err := repo.Purge(users[i].ID); err != nil {
+					return err
+				}
+				if err := enqueue(repo, events.UserPurged, &models.User{ID: users[i].ID}); err != nil {
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				return purged, err
+			}
+			usersPurged.Inc()
+			purged++
+		}
+
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package userservice
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"user-service/config"
+	"user-service/events"
+	"user-service/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "user_service_outbox_pending_messages",
+		Help: "Number of outbox messages waiting to be published.",
+	})
+	outboxLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "user_service_outbox_lag_seconds",
+		Help: "Age of the oldest outbox message waiting to be published.",
+	})
+	outboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "user_service_outbox_published_total",
+		Help: "Number of outbox messages published.",
+	})
+	outboxFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "user_service_outbox_publish_failures_total",
+		Help: "Number of failed attempts to publish an outbox message.",
+	})
+)
+
+// delay before the first retry of a failed message, doubled with every attempt
+const outboxBaseBackoff = time.Second
+
+// OutboxRelay publishes the events written to the outbox, retrying failures and keeping the order of each user's events
+type OutboxRelay struct {
+	repo         repository.UserRepository
+	publisher    events.Publisher
+	pollInterval time.Duration
+	batchSize    int
+	maxBackoff   time.Duration
+}
+
+// creates a relay publishing the service's outbox to its event publisher
+func NewOutboxRelay(s *UserService) *OutboxRelay {
+	conf := config.LoadConfig()
+	return &OutboxRelay{
+		repo:         s.userRepo,
+		publisher:    s.Events,
+		pollInterval: conf.OutboxPollInterval,
+		batchSize:    conf.OutboxBatchSize,
+		maxBackoff:   conf.OutboxMaxBackoff,
+	}
+}
+
+// publishes outbox messages until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RunOnce(); err != nil {
+			log.Printf("outbox relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishes one batch of undelivered messages that are due, returning how many were published. Messages are
+// handled in the order they were written, and once a message of a user can't be published the user's later
+// messages are held back so consumers never see them out of order
+func (r *OutboxRelay) RunOnce() (int, error) {
+	now := time.Now()
+	messages, err := r.repo.FindDueOutboxMessages(now, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	blocked := map[string]bool{}
+	published := 0
+
+	for _, message := range messages {
+		aggregate := fmt.Sprintf("%s/%d", message.AggregateType, message.AggregateID)
+		if blocked[aggregate] {
+			continue
+		}
+
+		if err := r.publisher.Publish(message.ToEvent()); err != nil {
+			outboxFailures.Inc()
+			blocked[aggregate] = true
+
+			attempts := message.Attempts + 1
+			if markErr := r.repo.MarkOutboxMessageFailed(message.ID, attempts, now.Add(r.backoff(attempts)), err.Error()); markErr != nil {
+				return published, markErr
+			}
+			continue
+		}
+
+		if err := r.repo.MarkOutboxMessageDelivered(message.ID, time.Now()); err != nil {
+			return published, err
+		}
+		outboxPublished.Inc()
+		published++
+	}
+
+	return published, r.updateBacklogMetrics()
+}
+
+// exponential delay before retrying a message that failed the given number of times
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.maxBackoff)
+}
+
+func (r *OutboxRelay) updateBacklogMetrics() error {
+	pending, oldest, err := r.repo.OutboxBacklog()
+	if err != nil {
+		return err
+	}
+
+	outboxPending.Set(float64(pending))
+	if oldest == nil {
+		outboxLag.Set(0)
+	} else {
+		outboxLag.Set(time.Since(*oldest).Seconds())
+	}
+	return nil
+}
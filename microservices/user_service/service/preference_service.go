@@ -0,0 +1,250 @@
+package userservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"user-service/config"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// keys are the namespace of the client app that owns them, a dot and the name of the setting
+var preferenceKeyPattern = regexp.MustCompile(`^([a-z0-9][a-z0-9_-]{0,63})\.[A-Za-z0-9_.-]{1,128}$`)
+
+// the most keys that can be asked for at once
+const maxPreferenceKeys = 100
+
+// json schemas preference values are checked against, by key. Keys without a schema take any json value
+type preferenceSchemas struct {
+	mu      sync.RWMutex
+	schemas map[string]*jsonschema.Schema
+}
+
+func (p *preferenceSchemas) get(key string) *jsonschema.Schema {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.schemas[key]
+}
+
+// RegisterPreferenceSchema makes values of the preference with the key have to be valid against the json schema
+func (s *UserService) RegisterPreferenceSchema(key string, schema []byte) error {
+	if !preferenceKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid preference key %q", key)
+	}
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return fmt.Errorf("schema for %s isn't valid json: %w", key, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	url := "preferences/" + key + ".json"
+	if err := compiler.AddResource(url, document); err != nil {
+		return fmt.Errorf("invalid schema for %s: %w", key, err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("invalid schema for %s: %w", key, err)
+	}
+
+	s.preferenceSchemas.mu.Lock()
+	defer s.preferenceSchemas.mu.Unlock()
+	if s.preferenceSchemas.schemas == nil {
+		s.preferenceSchemas.schemas = map[string]*jsonschema.Schema{}
+	}
+	s.preferenceSchemas.schemas[key] = compiled
+	return nil
+}
+
+// registers every <key>.json schema in the directory
+func (s *UserService) loadPreferenceSchemas(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := s.RegisterPreferenceSchema(strings.TrimSuffix(filepath.Base(file), ".json"), schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPreferences returns several of a user's preferences at once, limited to a namespace or keys when they're given
+func (s *UserService) GetPreferences(id uint, query dtos.PreferenceQuery) (*dtos.Preferences, *e.Error) {
+	fields := map[string][]string{}
+	if query.Namespace != "" && !preferenceKeyPattern.MatchString(query.Namespace+".x") {
+		fields["namespace"] = append(fields["namespace"], "is invalid")
+	}
+	var keys []string
+	if query.Keys != "" {
+		keys = strings.Split(query.Keys, ",")
+		if len(keys) > maxPreferenceKeys {
+			fields["keys"] = append(fields["keys"], fmt.Sprintf("can't have more than %d keys", maxPreferenceKeys))
+		}
+		for _, key := range keys {
+			if !preferenceKeyPattern.MatchString(key) {
+				fields["keys"] = append(fields["keys"], fmt.Sprintf("%q is invalid", key))
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return nil, e.NewValidationError("Invalid preference query", fields)
+	}
+
+	if _, err := s.findUser(id); err != nil {
+		return nil, err
+	}
+	preferences, err := s.userRepo.FindPreferences(id, query.Namespace, keys)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get preferences", err)
+	}
+
+	values := map[string]json.RawMessage{}
+	for _, preference := range preferences {
+		values[preference.Key] = json.RawMessage(preference.Value)
+	}
+	return &dtos.Preferences{Preferences: values}, nil
+}
+
+// GetPreference returns one of a user's preferences
+func (s *UserService) GetPreference(id uint, key string) (*dtos.Preference, *e.Error) {
+	preference, err := s.findPreference(id, key)
+	if err != nil {
+		return nil, err
+	}
+	if preference == nil {
+		return nil, e.NewError(http.StatusNotFound, "Preference doesn't exist", e.ErrNotFound)
+	}
+	return preference.ToDTO(), nil
+}
+
+// SetPreference creates or replaces a preference with a json value, which has to match the key's schema if one is
+// registered. Returns whether the preference was created
+func (s *UserService) SetPreference(id uint, key string, value []byte) (*dtos.Preference, bool, *e.Error) {
+	conf := config.LoadConfig()
+	if len(value) > conf.PreferenceMaxBytes {
+		return nil, false, e.NewError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Preference values can't be larger than %d bytes", conf.PreferenceMaxBytes), e.ErrInvalidUserData)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, value); err != nil {
+		return nil, false, e.NewValidationError("Invalid preference", map[string][]string{"value": {"must be json"}})
+	}
+
+	if schema := s.preferenceSchemas.get(key); schema != nil {
+		document, err := jsonschema.UnmarshalJSON(bytes.NewReader(compacted.Bytes()))
+		if err != nil {
+			return nil, false, e.NewValidationError("Invalid preference", map[string][]string{"value": {"must be json"}})
+		}
+		if err := schema.Validate(document); err != nil {
+			return nil, false, e.NewValidationError("Preference doesn't match its schema", map[string][]string{"value": schemaViolations(err)})
+		}
+	}
+
+	preference, err := s.findPreference(id, key)
+	if err != nil {
+		return nil, false, err
+	}
+	created := preference == nil
+	if created {
+		count, countErr := s.userRepo.CountPreferences(id)
+		if countErr != nil {
+			return nil, false, e.NewError(http.StatusInternalServerError, "Failed to count preferences", countErr)
+		}
+		if count >= int64(conf.PreferenceMaxCount) {
+			return nil, false, e.NewError(http.StatusConflict,
+				fmt.Sprintf("Users can't have more than %d preferences", conf.PreferenceMaxCount), e.ErrInvalidUserData)
+		}
+		preference = &models.Preference{UserID: id, Key: key, Namespace: strings.SplitN(key, ".", 2)[0]}
+	}
+
+	preference.Value = compacted.String()
+	if err := s.userRepo.SavePreference(preference); err != nil {
+		return nil, false, e.NewError(http.StatusInternalServerError, "Failed to save preference", err)
+	}
+	return preference.ToDTO(), created, nil
+}
+
+// DeletePreference removes one of a user's preferences
+func (s *UserService) DeletePreference(id uint, key string) *e.Error {
+	if !preferenceKeyPattern.MatchString(key) {
+		return invalidPreferenceKey()
+	}
+	if _, err := s.findUser(id); err != nil {
+		return err
+	}
+
+	deleted, err := s.userRepo.DeletePreference(id, key)
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to delete preference", err)
+	}
+	if !deleted {
+		return e.NewError(http.StatusNotFound, "Preference doesn't exist", e.ErrNotFound)
+	}
+	return nil
+}
+
+// loads a preference of an existing user, nil if it isn't set
+func (s *UserService) findPreference(id uint, key string) (*models.Preference, *e.Error) {
+	if !preferenceKeyPattern.MatchString(key) {
+		return nil, invalidPreferenceKey()
+	}
+	if _, err := s.findUser(id); err != nil {
+		return nil, err
+	}
+
+	preference, err := s.userRepo.FindPreference(id, key)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get preference", err)
+	}
+	return preference, nil
+}
+
+func invalidPreferenceKey() *e.Error {
+	return e.NewValidationError("Invalid preference key", map[string][]string{
+		"key": {"must be a namespace of lowercase letters, digits, - or _, a dot and a name, such as web.theme"},
+	})
+}
+
+// the reasons a value doesn't match a schema, with where in the value they are
+func schemaViolations(err error) []string {
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []string{err.Error()}
+	}
+
+	var violations []string
+	var collect func(unit jsonschema.OutputUnit)
+	collect = func(unit jsonschema.OutputUnit) {
+		if unit.Error != nil {
+			location := unit.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			violations = append(violations, location+": "+unit.Error.String())
+		}
+		for _, cause := range unit.Errors {
+			collect(cause)
+		}
+	}
+	collect(*validationErr.BasicOutput())
+	return violations
+}
@@ -0,0 +1,169 @@
+package userservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+	"user-service/config"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/models"
+)
+
+// how long a user has to wait before another code is sent to their phone
+const phoneCodeResendInterval = time.Minute
+
+// GetUserProfile returns a user's profile, users who never saved one have an empty profile
+func (s *UserService) GetUserProfile(id uint) (*dtos.UserProfile, *e.Error) {
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	return profile.ToDTO(), nil
+}
+
+// UpdateUserProfile replaces a user's profile, changing the phone number means it has to be verified again
+func (s *UserService) UpdateUserProfile(id uint, update dtos.UserProfileUpdate) (*dtos.UserProfile, *e.Error) {
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Phone != profile.Phone {
+		profile.PhoneVerifiedAt = nil
+	}
+	profile.DisplayName = update.DisplayName
+	profile.AvatarURL = update.AvatarURL
+	profile.Phone = update.Phone
+	profile.Locale = update.Locale
+	profile.Timezone = update.Timezone
+
+	if err := s.userRepo.SaveProfile(profile); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to save profile", err)
+	}
+	return profile.ToDTO(), nil
+}
+
+// SendPhoneVerification texts a code to the phone number in a user's profile, replacing any code sent before
+func (s *UserService) SendPhoneVerification(id uint) *e.Error {
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return err
+	}
+	if profile.Phone == "" {
+		return e.NewError(http.StatusConflict, "Profile has no phone number", e.ErrInvalidUserData)
+	}
+	if profile.PhoneVerifiedAt != nil {
+		return e.NewError(http.StatusConflict, "Phone number is already verified", e.ErrInvalidUserData)
+	}
+
+	previous, findErr := s.userRepo.FindPhoneVerification(id)
+	if findErr != nil && !errors.Is(findErr, e.ErrRecordNotFound) {
+		return e.NewError(http.StatusInternalServerError, "Failed to get phone verification", findErr)
+	}
+	if previous != nil && previous.Phone == profile.Phone && time.Since(previous.SentAt) < phoneCodeResendInterval {
+		return e.NewError(http.StatusTooManyRequests, "A code was sent recently, wait before requesting another", fmt.Errorf("code sent at %s", previous.SentAt))
+	}
+
+	code, genErr := phoneCode()
+	if genErr != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to generate code", genErr)
+	}
+
+	now := time.Now()
+	verification := &models.PhoneVerification{
+		UserID:    id,
+		Phone:     profile.Phone,
+		CodeHash:  hashPhoneCode(profile.Phone, code),
+		SentAt:    now,
+		ExpiresAt: now.Add(config.LoadConfig().PhoneCodeTTL),
+	}
+	if err := s.userRepo.SavePhoneVerification(verification); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to store phone verification", err)
+	}
+
+	if err := s.SMS.Send(profile.Phone, fmt.Sprintf("Your verification code is %s", code)); err != nil {
+		return e.NewError(http.StatusBadGateway, "Failed to send verification code", err)
+	}
+	return nil
+}
+
+// ConfirmPhoneVerification marks a user's phone number as verified when the code matches the one sent to it
+func (s *UserService) ConfirmPhoneVerification(id uint, confirm dtos.PhoneVerificationConfirm) (*dtos.UserProfile, *e.Error) {
+	profile, err := s.findProfile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	verification, findErr := s.userRepo.FindPhoneVerification(id)
+	if findErr != nil {
+		if errors.Is(findErr, e.ErrRecordNotFound) {
+			return nil, e.NewError(http.StatusConflict, "No verification code was sent", findErr)
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get phone verification", findErr)
+	}
+	if verification.Phone != profile.Phone {
+		return nil, e.NewError(http.StatusConflict, "Phone number changed since the code was sent, request a new code", e.ErrInvalidUserData)
+	}
+	if time.Now().After(verification.ExpiresAt) {
+		return nil, e.NewError(http.StatusGone, "Verification code expired, request a new code", e.ErrInvalidUserData)
+	}
+	if verification.Attempts >= config.LoadConfig().PhoneCodeMaxAttempts {
+		return nil, e.NewError(http.StatusTooManyRequests, "Too many wrong codes, request a new code", e.ErrInvalidUserData)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashPhoneCode(profile.Phone, confirm.Code)), []byte(verification.CodeHash)) != 1 {
+		verification.Attempts++
+		if err := s.userRepo.SavePhoneVerification(verification); err != nil {
+			return nil, e.NewError(http.StatusInternalServerError, "Failed to store phone verification", err)
+		}
+		return nil, e.NewValidationError("Invalid verification code", map[string][]string{"code": {"doesn't match the code sent"}})
+	}
+
+	now := time.Now()
+	profile.PhoneVerifiedAt = &now
+	if err := s.userRepo.SaveProfile(profile); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to save profile", err)
+	}
+	if err := s.userRepo.DeletePhoneVerification(id); err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to remove phone verification", err)
+	}
+	return profile.ToDTO(), nil
+}
+
+// loads the profile of an existing user, or an empty one if they never saved it
+func (s *UserService) findProfile(id uint) (*models.Profile, *e.Error) {
+	if _, err := s.findUser(id); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.userRepo.FindProfile(id)
+	if err != nil {
+		if errors.Is(err, e.ErrRecordNotFound) {
+			return models.NewProfile(id), nil
+		}
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to get profile", err)
+	}
+	return profile, nil
+}
+
+// a random six digit code
+func phoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// codes are stored hashed with the number they were sent to
+func hashPhoneCode(phone, code string) string {
+	hash := sha256.Sum256([]byte(phone + ":" + code))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,126 @@
+package userservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/models"
+	"user-service/repository"
+)
+
+// fields users can be sorted by
+var userSortFields = []string{"id", "name", "email", "created_at"}
+
+// position in a sorted user list, handed to clients as an opaque token
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+// ListUsers returns a filtered and sorted page of users
+func (s *UserService) ListUsers(query dtos.UserQuery) (*dtos.UserPage, *e.Error) {
+	sortField, descending := strings.CutPrefix(query.Sort, "-")
+	if !slices.Contains(userSortFields, sortField) {
+		return nil, e.NewValidationError("Invalid query", map[string][]string{
+			"sort": {"must be one of " + strings.Join(userSortFields, ", ") + ", optionally prefixed with -"},
+		})
+	}
+
+	options := repository.UserListOptions{
+		Filter: repository.UserFilter{
+			EmailContains: query.Email,
+			Name:          query.Name,
+			Status:        query.Status,
+			CreatedAfter:  query.CreatedAfter,
+			CreatedBefore: query.CreatedBefore,
+		},
+		SortField:  sortField,
+		Descending: descending,
+		Offset:     (query.Page - 1) * query.PageSize,
+		//one extra user tells whether there's a next page
+		Limit: query.PageSize + 1,
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeUserCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return nil, e.NewValidationError("Invalid query", map[string][]string{"cursor": {err.Error()}})
+		}
+		options.After = after
+	}
+
+	users, total, err := s.userRepo.FindAll(options)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to list users", err)
+	}
+
+	page := &dtos.UserPage{
+		Users:    make([]*dtos.User, 0, len(users)),
+		Total:    total,
+		PageSize: query.PageSize,
+	}
+	//page numbers have no meaning once a cursor is used
+	if query.Cursor == "" {
+		page.Page = query.Page
+	}
+
+	if len(users) > query.PageSize {
+		users = users[:query.PageSize]
+		page.NextCursor = encodeUserCursor(&users[len(users)-1], query.Sort)
+	}
+	for i := range users {
+		page.Users = append(page.Users, users[i].ToUserDTO())
+	}
+	return page, nil
+}
+
+func encodeUserCursor(user *models.User, sort string) string {
+	cursor := userCursor{Sort: sort, ID: user.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case "name":
+		cursor.Value = user.Name
+	case "email":
+		cursor.Value = user.Email
+	case "created_at":
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodes a cursor into the user the page starts after, cursors only work with the sort they were made for
+func decodeUserCursor(token, sort string) (*models.User, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("is malformed")
+	}
+
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("is malformed")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("was created for another sort order")
+	}
+
+	user := &models.User{ID: cursor.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case "name":
+		user.Name = cursor.Value
+	case "email":
+		user.Email = cursor.Value
+	case "created_at":
+		if user.CreatedAt, err = time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return nil, fmt.Errorf("is malformed")
+		}
+	}
+	return user, nil
+}
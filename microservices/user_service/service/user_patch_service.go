@@ -0,0 +1,142 @@
+package userservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"user-service/dtos"
+	e "user-service/errors"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// media types of the supported patch formats
+const (
+	// RFC 7396, the patch is a partial user whose fields replace the user's, null removes a field
+	MergePatch = "application/merge-patch+json"
+	// RFC 6902, the patch is a list of operations applied in order
+	JSONPatch = "application/json-patch+json"
+)
+
+// checks patched users against the same binding tags requests are validated with
+var userValidator = newUserValidator()
+
+func newUserValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	//errors are reported with the json names clients use
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("json"), ",")[0]
+	})
+	return v
+}
+
+// PatchUser applies a merge patch or JSON patch to a user if they're still at the given version, the patched user is
+// validated like a full update
+func (s *UserService) PatchUser(id uint, version uint, patchType string, patch []byte) (*dtos.User, *e.Error) {
+	if id <= 0 {
+		return nil, e.NewError(http.StatusBadRequest, "Invalid Id", e.ErrInvalidUserData)
+	}
+
+	existingUser, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	//checked before patching so test operations can't fail because the user changed
+	if err := checkVersion(existingUser, version); err != nil {
+		return nil, err
+	}
+
+	current := existingUser.ToUserDTO()
+	document, marshalErr := json.Marshal(current)
+	if marshalErr != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to patch user", marshalErr)
+	}
+
+	patched, err := applyPatch(patchType, document, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var u dtos.User
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if decodeErr := decoder.Decode(&u); decodeErr != nil {
+		return nil, e.NewError(http.StatusBadRequest, "Patched user is invalid", decodeErr)
+	}
+	if err := validatePatchedUser(current, &u); err != nil {
+		return nil, err
+	}
+
+	return s.saveUser(existingUser, version, u.Name, u.Email)
+}
+
+func applyPatch(patchType string, document, patch []byte) ([]byte, *e.Error) {
+	switch patchType {
+	case MergePatch:
+		patched, err := jsonpatch.MergePatch(document, patch)
+		if err != nil {
+			return nil, e.NewError(http.StatusBadRequest, "Invalid merge patch", err)
+		}
+		return patched, nil
+	case JSONPatch:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, e.NewError(http.StatusBadRequest, "Invalid JSON patch", err)
+		}
+		patched, err := operations.Apply(document)
+		if err != nil {
+			//a failed test operation means the user isn't in the state the client expected
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return nil, e.NewError(http.StatusConflict, "JSON patch test failed", err)
+			}
+			return nil, e.NewError(http.StatusBadRequest, "Failed to apply JSON patch", err)
+		}
+		return patched, nil
+	default:
+		return nil, e.NewError(http.StatusUnsupportedMediaType, "Unsupported patch format, use "+MergePatch+" or "+JSONPatch, e.ErrInvalidUserData)
+	}
+}
+
+// makes sure a patch only changed writable fields and left a valid user
+func validatePatchedUser(current, patched *dtos.User) *e.Error {
+	fields := map[string][]string{}
+	if patched.Id != current.Id {
+		fields["id"] = append(fields["id"], "is read only")
+	}
+	if patched.Status != current.Status {
+		fields["status"] = append(fields["status"], "is read only")
+	}
+	if patched.StatusReason != current.StatusReason {
+		fields["status_reason"] = append(fields["status_reason"], "is read only")
+	}
+	if !patched.CreatedAt.Equal(current.CreatedAt) {
+		fields["created_at"] = append(fields["created_at"], "is read only")
+	}
+
+	if err := userValidator.Struct(patched); err != nil {
+		var violations validator.ValidationErrors
+		if !errors.As(err, &violations) {
+			return e.NewError(http.StatusInternalServerError, "Failed to validate user", err)
+		}
+		for _, violation := range violations {
+			message := "is invalid"
+			switch violation.Tag() {
+			case "required":
+				message = "is required"
+			case "email":
+				message = "must be a valid email"
+			}
+			fields[violation.Field()] = append(fields[violation.Field()], message)
+		}
+	}
+
+	if len(fields) > 0 {
+		return e.NewValidationError("Patched user is invalid", fields)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package userservice
+
+import (
+	"cmp"
+	"html"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/models"
+)
+
+// how many users are loaded from the database to be ranked
+const searchCandidates = 200
+
+// leading characters of a term that have to be typed correctly, typos are only tolerated after them
+const searchPrefixLength = 3
+
+// how well a term matches a word
+const (
+	matchFuzzy  = 1.0
+	matchPrefix = 2.0
+	matchExact  = 3.0
+)
+
+// fields searched and how much a match in each counts
+var searchFields = []struct {
+	name   string
+	weight float64
+}{
+	{"name", 1},
+	{"email", 0.8},
+}
+
+// a word of a field, start is its rune offset into the field
+type searchWord struct {
+	text  []rune
+	start int
+}
+
+// SearchUsers finds the users whose names or emails have a word starting with every term of the query, tolerating
+// a few typos in longer terms. Results are ranked best match first
+func (s *UserService) SearchUsers(query dtos.UserSearch) (*dtos.UserSearchResults, *e.Error) {
+	var terms [][]rune
+	for _, word := range searchWords(query.Q) {
+		if !slices.ContainsFunc(terms, func(term []rune) bool { return slices.Equal(term, word.text) }) {
+			terms = append(terms, word.text)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, e.NewValidationError("Invalid query", map[string][]string{"q": {"must contain a letter or digit"}})
+	}
+
+	//the database narrows the users down by the terms, widened by the prefixes typos are tolerated after so misspelled
+	//words are found too. Matching and ranking them is done here so it works the same everywhere
+	var fullTerms, prefixes []string
+	for _, term := range terms {
+		fullTerms = append(fullTerms, string(term))
+		if allowedTypos(len(term)) == 0 {
+			continue
+		}
+		if prefix := string(term[:searchPrefixLength]); !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	users, err := s.userRepo.Search(fullTerms, prefixes, searchCandidates)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "Failed to search users", err)
+	}
+
+	results := []*dtos.UserSearchResult{}
+	for i := range users {
+		if result := matchUser(&users[i], terms); result != nil {
+			results = append(results, result)
+		}
+	}
+	slices.SortStableFunc(results, func(a, b *dtos.UserSearchResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return &dtos.UserSearchResults{Results: results}, nil
+}
+
+// scores a user against the terms, returning nil when a term matches none of their words
+func matchUser(user *models.User, terms [][]rune) *dtos.UserSearchResult {
+	values := map[string]string{"name": user.Name, "email": user.Email}
+	spans := map[string][][2]int{}
+
+	var score float64
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range searchFields {
+			for _, word := range searchWords(values[field.name]) {
+				quality, length := matchWord(term, word.text)
+				if quality == 0 {
+					continue
+				}
+				spans[field.name] = append(spans[field.name], [2]int{word.start, word.start + length})
+				best = max(best, quality*field.weight)
+			}
+		}
+		if best == 0 {
+			return nil
+		}
+		score += best
+	}
+
+	highlights := map[string]string{}
+	for field, fieldSpans := range spans {
+		highlights[field] = highlight([]rune(values[field]), fieldSpans)
+	}
+	return &dtos.UserSearchResult{
+		User:       user.ToUserDTO(),
+		Score:      math.Round(score*100) / 100,
+		Highlights: highlights,
+	}
+}
+
+// how well a term matches the start of a word and how many runes of the word matched, a quality of 0 is no match
+func matchWord(term, word []rune) (float64, int) {
+	if slices.Equal(term, word) {
+		return matchExact, len(word)
+	}
+	if len(word) > len(term) && slices.Equal(term, word[:len(term)]) {
+		return matchPrefix, len(term)
+	}
+
+	typos := allowedTypos(len(term))
+	if typos == 0 || len(word) < searchPrefixLength || !slices.Equal(term[:searchPrefixLength], word[:searchPrefixLength]) {
+		return 0, 0
+	}
+
+	//the typo may have added or dropped characters, so prefixes of the word around the term's length are compared
+	bestLength, bestDistance := 0, typos+1
+	for length := max(1, len(term)-typos); length <= min(len(word), len(term)+typos); length++ {
+		if distance := editDistance(term, word[:length]); distance < bestDistance {
+			bestLength, bestDistance = length, distance
+		}
+	}
+	if bestLength == 0 {
+		return 0, 0
+	}
+	return matchFuzzy, bestLength
+}
+
+// the number of typos tolerated in a term, short terms have to be typed exactly
+func allowedTypos(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// the number of insertions, deletions, substitutions and swaps of adjacent runes needed to turn a into b
+func editDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// splits a value into lowercase words of letters and digits, the same way MySQL's full text parser does
+func searchWords(value string) []searchWord {
+	var words []searchWord
+	runes := []rune(value)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(runes) && isWordRune(runes[i]) {
+			i++
+		}
+		text := make([]rune, i-start)
+		for j, r := range runes[start:i] {
+			text[j] = unicode.ToLower(r)
+		}
+		words = append(words, searchWord{text: text, start: start})
+	}
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// html escapes a value, wrapping the spans in <em> tags
+func highlight(value []rune, spans [][2]int) string {
+	slices.SortFunc(spans, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+
+	var builder strings.Builder
+	position := 0
+	for i := 0; i < len(spans); i++ {
+		start, end := spans[i][0], spans[i][1]
+		//overlapping spans are merged into one
+		for i+1 < len(spans) && spans[i+1][0] <= end {
+			i++
+			end = max(end, spans[i][1])
+		}
+		start = max(start, position)
+
+		builder.WriteString(html.EscapeString(string(value[position:start])))
+		builder.WriteString("<em>")
+		builder.WriteString(html.EscapeString(string(value[start:end])))
+		builder.WriteString("</em>")
+		position = end
+	}
+	builder.WriteString(html.EscapeString(string(value[position:])))
+	return builder.String()
+}
@@ -2,33 +2,77 @@ package userservice
 
 import (
 	"errors"
-	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"user-service/authclient"
+	"user-service/blob"
+	"user-service/config"
 	"user-service/dtos"
 	e "user-service/errors"
+	"user-service/events"
 	"user-service/models"
 	"user-service/repository" // Assuming you'll have a repository layer
-
-	"golang.org/x/crypto/bcrypt"
+	"user-service/sms"
 )
 
 // UserService handles business logic for user operations
 type UserService struct {
 	userRepo repository.UserRepository
+	//passwords are validated and stored by the auth service
+	Credentials authclient.CredentialStore
+	//notified after users are created, updated or deleted
+	Events events.Publisher
+	//sends phone verification codes
+	SMS sms.Sender
+	//exports and erases the auth service's data about users
+	PersonalData authclient.PersonalDataStore
+	//stores uploaded avatars and export archives
+	Blobs blob.BlobStore
+	//schemas preference values are validated against
+	preferenceSchemas preferenceSchemas
+	//whether new users can take the email of a deleted user who wasn't purged yet
+	releaseDeletedEmails bool
 }
 
-// max length of a password, limited by bcrypt
-var MAX_PASSWORD_LENGTH int = 70
-
 // NewUserService creates a new instance of UserService
 func NewUserService(userRepo repository.UserRepository) *UserService {
 	if userRepo == nil {
 		//use default repo
 		userRepo = repository.NewMysqlUserRepository(nil)
 	}
-	return &UserService{
-		userRepo: userRepo,
+	conf := config.LoadConfig()
+	broker, err := events.NewBroker(conf)
+	if err != nil {
+		panic("failed to connect to event broker: " + err.Error())
+	}
+	sender, err := sms.NewSender(conf)
+	if err != nil {
+		panic("failed to create sms sender: " + err.Error())
+	}
+	blobs, err := blob.NewStore(conf)
+	if err != nil {
+		panic("failed to create blob store: " + err.Error())
+	}
+	if conf.Production && !strings.HasPrefix(strings.ToLower(conf.AuthServiceURL), "https://") {
+		panic("AUTH_SERVICE_URL must use https in production, passwords are sent to the auth service")
+	}
+	authService := authclient.NewHTTPCredentialStore(conf.AuthServiceURL, conf.AuthClientID, conf.AuthClientSecret)
+	s := &UserService{
+		userRepo:             userRepo,
+		Credentials:          authService,
+		PersonalData:         authService,
+		Events:               events.NewBus(broker),
+		SMS:                  sender,
+		Blobs:                blobs,
+		releaseDeletedEmails: conf.ReleaseDeletedEmails,
 	}
+	if conf.PreferenceSchemasDir != "" {
+		if err := s.loadPreferenceSchemas(conf.PreferenceSchemasDir); err != nil {
+			panic("failed to load preference schemas: " + err.Error())
+		}
+	}
+	return s
 }
 
 // GetUserByID retrieves a user by their ID
@@ -45,97 +89,320 @@ func (s *UserService) GetUserByID(id uint) (*dtos.User, *e.Error) {
 	return user.ToUserDTO(), nil
 }
 
-// CreateUser creates a new user
+// CreateUser creates a new user, storing their password with the auth service which checks it against the
+// password policy
 func (s *UserService) CreateUser(u dtos.UserCreate) (*dtos.User, *e.Error) {
+	if err := s.releaseDeletedEmail(u.Email); err != nil {
+		return nil, err
+	}
 
-	//check that a user with the given email doesn't already exist
-	exists, err := s.userRepo.ExistsByEmail(u.Email)
+	var createdUser *models.User
+	err := s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		var err *e.Error
+		if createdUser, err = s.createProfile(repo, u.Name, u.Email); err != nil {
+			return err
+		}
+		return enqueue(repo, events.UserCreated, createdUser)
+	})
 	if err != nil {
-		return nil, e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+		return nil, err
 	}
 
-	if exists {
-		return nil, e.NewError(http.StatusBadRequest, "Email already exists", e.ErrUserExists)
+	//the auth service is called once the profile is committed so no transaction is held open during the request,
+	//a profile whose credential is rejected is removed again
+	if credErr := s.Credentials.SetCredential(createdUser.ID, u.Email, u.Name, u.Password); credErr != nil {
+		if err := s.RemoveProfile(createdUser.ID); err != nil {
+			log.Printf("failed to remove user %d whose credential was rejected: %v", createdUser.ID, err.Details)
+		}
+		return nil, credentialError(credErr)
 	}
 
-	//bcrypt puts a cap on how long a password can be
-	if len(u.Password) > MAX_PASSWORD_LENGTH {
-		return nil, e.NewError(http.StatusBadRequest, "password too long", fmt.Errorf("password must be less than %d characters", MAX_PASSWORD_LENGTH))
+	return createdUser.ToUserDTO(), nil
+}
+
+// CreateProfile creates a user without a password, used by the auth service for users signing up through an external provider
+func (s *UserService) CreateProfile(p dtos.ProfileCreate) (*dtos.User, *e.Error) {
+	if err := s.releaseDeletedEmail(p.Email); err != nil {
+		return nil, err
 	}
 
-	//generate a salted hashed password with bcrypt
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	var user *models.User
+	err := s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		var err *e.Error
+		if user, err = s.createProfile(repo, p.Name, p.Email); err != nil {
+			return err
+		}
+		return enqueue(repo, events.UserCreated, user)
+	})
+	if err != nil {
+		//lets the auth service tell a taken email apart from a bad request
+		if errors.Is(err.Details, e.ErrUserExists) {
+			err.Code = http.StatusConflict
+		}
+		return nil, err
+	}
+
+	return user.ToUserDTO(), nil
+}
 
+// RemoveProfile permanently removes a user created through the internal api when the calling service couldn't
+// finish signing them up
+func (s *UserService) RemoveProfile(id uint) *e.Error {
+	user, err := s.findUser(id)
 	if err != nil {
-		return nil, e.NewError(http.StatusInternalServerError, "failed to create password", err)
+		return err
+	}
+
+	return s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		if err := repo.Delete(id, user.Version); err != nil {
+			if errors.Is(err, e.ErrVersionConflict) {
+				return versionConflict(err)
+			}
+			return e.NewError(http.StatusInternalServerError, "Failed to delete user", err)
+		}
+		if err := repo.Purge(id); err != nil {
+			return e.NewError(http.StatusInternalServerError, "Failed to remove user", err)
+		}
+
+		if err := enqueue(repo, events.UserDeleted, &models.User{ID: id}); err != nil {
+			return err
+		}
+		return enqueue(repo, events.UserPurged, &models.User{ID: id})
+	})
+}
+
+// stores a new profile after making sure the email isn't taken
+func (s *UserService) createProfile(repo repository.UserRepository, name, email string) (*models.User, *e.Error) {
+	//check that a user with the given email doesn't already exist
+	exists, err := s.emailTaken(repo, email)
+	if err != nil {
+		return nil, e.NewError(http.StatusInternalServerError, "error when looking up email", err)
+	}
+
+	if exists {
+		return nil, e.NewError(http.StatusBadRequest, "Email already exists", e.ErrUserExists)
 	}
 
 	//create new user within db
-	user := models.NewUser(u.Name, u.Email, string(hashPassword))
-	createdUser, err := s.userRepo.Create(user)
+	createdUser, err := repo.Create(models.NewUser(name, email))
 	if err != nil {
-		return nil, e.NewError(http.StatusInternalServerError, "failed to create password", err)
+		return nil, e.NewError(http.StatusInternalServerError, "failed to create user", err)
 	}
+	return createdUser, nil
+}
 
-	return createdUser.ToUserDTO(), nil
+// AnyVersion can be given instead of the version a change was made from to apply it whatever the user's version is
+const AnyVersion uint = 0
+
+// reports whether an email is used by a user, or by a deleted user when their emails aren't released
+func (s *UserService) emailTaken(repo repository.UserRepository, email string) (bool, error) {
+	exists, err := repo.ExistsByEmail(email)
+	if err != nil || exists || s.releaseDeletedEmails {
+		return exists, err
+	}
+	return repo.ExistsDeletedByEmail(email)
 }
 
-// UpdateUser updates an existing user
-func (s *UserService) UpdateUser(u dtos.User) (*dtos.User, *e.Error) {
+// UpdateUser updates an existing user if they're still at the given version
+func (s *UserService) UpdateUser(u dtos.User, version uint) (*dtos.User, *e.Error) {
 	if u.Id <= 0 {
 		return nil, e.NewError(http.StatusBadRequest, "Invalid Id", e.ErrInvalidUserData)
 	}
 
-	//check if user exists
-	existingUser, err := s.userRepo.FindByID(u.Id)
+	existingUser, err := s.findUser(u.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.saveUser(existingUser, version, u.Name, u.Email)
+}
+
+// loads a user that's about to be changed
+func (s *UserService) findUser(id uint) (*models.User, *e.Error) {
+	user, err := s.userRepo.FindByID(id)
 	if err != nil {
 		if errors.Is(err, e.ErrRecordNotFound) {
 			return nil, e.NewError(http.StatusNotFound, "User doesn't exist", e.ErrRecordNotFound)
 		}
 		return nil, e.NewError(http.StatusInternalServerError, "Failed to get user", err)
 	}
+	return user, nil
+}
+
+// rejects changes made from another version of the user than the current one
+func checkVersion(user *models.User, version uint) *e.Error {
+	if version != AnyVersion && version != user.Version {
+		return versionConflict(e.ErrVersionConflict)
+	}
+	return nil
+}
+
+func versionConflict(err error) *e.Error {
+	return e.NewError(http.StatusPreconditionFailed, "User was changed since it was fetched, fetch it again and retry", err)
+}
+
+// changes a user's name and email, making sure the new email isn't taken
+func (s *UserService) saveUser(existingUser *models.User, version uint, name, email string) (*dtos.User, *e.Error) {
+	if err := checkVersion(existingUser, version); err != nil {
+		return nil, err
+	}
 
 	//check if email is being changed and if it's already taken
-	if u.Email != existingUser.Email {
-		exists, err := s.userRepo.ExistsByEmail(u.Email)
+	emailChanged := email != existingUser.Email
+	if emailChanged {
+		exists, err := s.emailTaken(s.userRepo, email)
 		if err != nil {
 			return nil, e.NewError(http.StatusInternalServerError, "failed to check user existence", err)
 		}
 		if exists {
 			return nil, e.NewError(http.StatusBadRequest, "User with email already exists", e.ErrUserExists)
 		}
+		if err := s.releaseDeletedEmail(email); err != nil {
+			return nil, err
+		}
 	}
 
-	existingUser.Name = u.Name
-	existingUser.Email = u.Email
+	previousName, previousEmail := existingUser.Name, existingUser.Email
+	existingUser.Name = name
+	existingUser.Email = email
 
-	//update info in db
-	updatedUser, err := s.userRepo.Update(existingUser)
-	if err != nil {
-		return nil, e.NewError(http.StatusInternalServerError, "failed to update user", err)
+	var updatedUser *models.User
+	txErr := s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		//update info in db
+		var err error
+		if updatedUser, err = repo.Update(existingUser); err != nil {
+			//someone else changed the user after it was loaded
+			if errors.Is(err, e.ErrVersionConflict) {
+				return versionConflict(err)
+			}
+			return e.NewError(http.StatusInternalServerError, "failed to update user", err)
+		}
+		return enqueue(repo, events.UserUpdated, updatedUser)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	//users log in with their email, the change is undone when the auth service refuses it
+	if emailChanged {
+		if credErr := s.Credentials.SetCredential(updatedUser.ID, updatedUser.Email, updatedUser.Name, ""); credErr != nil {
+			s.undo("email change", updatedUser.ID, func(repo repository.UserRepository) *e.Error {
+				updatedUser.Name, updatedUser.Email = previousName, previousEmail
+				if _, err := repo.Update(updatedUser); err != nil {
+					return e.NewError(http.StatusInternalServerError, "failed to update user", err)
+				}
+				return enqueue(repo, events.UserUpdated, updatedUser)
+			})
+			return nil, credentialError(credErr)
+		}
 	}
 
 	return updatedUser.ToUserDTO(), nil
 }
 
-// DeleteUser removes a user by their ID
-func (s *UserService) DeleteUser(id uint) *e.Error {
+// DeleteUser removes a user by their ID if they're still at the given version. Users are soft deleted, they can be
+// restored until they're purged
+func (s *UserService) DeleteUser(id uint, version uint) *e.Error {
 	if id <= 0 {
 		return e.NewError(http.StatusBadRequest, "invalid Id", e.ErrInvalidUserData)
 	}
 
-	// Check if user exists
-	exists, err := s.userRepo.ExistsByID(id)
+	user, err := s.findUser(id)
 	if err != nil {
-		return e.NewError(http.StatusInternalServerError, "Failed to check for user", err)
+		return err
 	}
-	if !exists {
-		return e.NewError(http.StatusNotFound, "User doesn't exist", e.ErrRecordNotFound)
+	if err := checkVersion(user, version); err != nil {
+		return err
 	}
 
-	if err := s.userRepo.Delete(id); err != nil {
-		return e.NewError(http.StatusInternalServerError, "Failed to delete user", err)
+	txErr := s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		if err := repo.Delete(id, user.Version); err != nil {
+			if errors.Is(err, e.ErrVersionConflict) {
+				return versionConflict(err)
+			}
+			return e.NewError(http.StatusInternalServerError, "Failed to delete user", err)
+		}
+		return enqueue(repo, events.UserDeleted, &models.User{ID: id})
+	})
+	if txErr != nil {
+		return txErr
 	}
 
+	//the credential is only disabled, so restoring the user brings back their password and passkeys. It's removed when
+	//the user is purged. The deletion is undone when the auth service can't be told, so a deleted user can't log in
+	if err := s.Credentials.SetCredentialStatus(id, models.StatusDeactivated, "user deleted"); err != nil && !credentialMissing(err) {
+		s.undo("deletion", id, func(repo repository.UserRepository) *e.Error {
+			deleted, err := repo.FindDeletedByID(id)
+			if err == nil {
+				err = repo.Restore(deleted)
+			}
+			if err != nil {
+				return e.NewError(http.StatusInternalServerError, "Failed to restore user", err)
+			}
+			return enqueue(repo, events.UserRestored, deleted)
+		})
+		return credentialError(err)
+	}
 	return nil
 }
+
+// undoes a committed change the auth service couldn't be told about, by running fn in a transaction
+func (s *UserService) undo(change string, id uint, fn func(repo repository.UserRepository) *e.Error) {
+	if err := s.inTransaction(fn); err != nil {
+		log.Printf("failed to undo %s of user %d: %v", change, id, err.Details)
+	}
+}
+
+// runs fn in a transaction, rolling it back when fn returns an error
+func (s *UserService) inTransaction(fn func(repo repository.UserRepository) *e.Error) *e.Error {
+	var fnErr *e.Error
+	err := s.userRepo.WithTransaction(func(repo repository.UserRepository) error {
+		if fnErr = fn(repo); fnErr != nil {
+			return fnErr
+		}
+		return nil
+	})
+
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to save changes", err)
+	}
+	return nil
+}
+
+// writes an event about a user to the outbox, to be published by the relay once the transaction commits
+func enqueue(repo repository.UserRepository, eventType string, user *models.User) *e.Error {
+	event, err := events.NewEvent(eventType, user.ID, events.UserData{ID: user.ID, Name: user.Name, Email: user.Email, Status: user.Status})
+	if err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to create event", err)
+	}
+
+	if err := repo.CreateOutboxMessage(models.NewOutboxMessage(event, "user")); err != nil {
+		return e.NewError(http.StatusInternalServerError, "Failed to store event", err)
+	}
+	return nil
+}
+
+// converts an error from the auth service, passing on the problems it found with the request
+func credentialError(err error) *e.Error {
+	var apiErr *authclient.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case len(apiErr.Fields) > 0:
+			return e.NewValidationError(apiErr.Message, apiErr.Fields)
+		case apiErr.Status == http.StatusConflict:
+			return e.NewError(http.StatusBadRequest, "Email already exists", e.ErrUserExists)
+		case apiErr.Status == http.StatusBadRequest:
+			return e.NewError(http.StatusBadRequest, apiErr.Message, e.ErrInvalidUserData)
+		}
+	}
+	return e.NewError(http.StatusBadGateway, "Failed to update credentials", err)
+}
+
+// reports whether the auth service answered that it has no credential for the user
+func credentialMissing(err error) bool {
+	var apiErr *authclient.Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
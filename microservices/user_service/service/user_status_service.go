@@ -0,0 +1,112 @@
+package userservice
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/events"
+	"user-service/models"
+	"user-service/repository"
+)
+
+// a change of a user's status, allowed from the listed statuses
+type statusTransition struct {
+	name           string
+	from           []string
+	to             string
+	reasonRequired bool
+}
+
+var (
+	suspend = statusTransition{
+		name:           "suspend",
+		from:           []string{models.StatusActive},
+		to:             models.StatusSuspended,
+		reasonRequired: true,
+	}
+	deactivate = statusTransition{
+		name: "deactivate",
+		from: []string{models.StatusActive, models.StatusSuspended},
+		to:   models.StatusDeactivated,
+	}
+	reactivate = statusTransition{
+		name: "reactivate",
+		from: []string{models.StatusSuspended, models.StatusDeactivated},
+		to:   models.StatusActive,
+	}
+)
+
+// SuspendUser blocks an active user from logging in until they're reactivated, a reason is required
+func (s *UserService) SuspendUser(id uint, change dtos.StatusChange) (*dtos.User, *e.Error) {
+	return s.changeStatus(id, suspend, change.Reason)
+}
+
+// DeactivateUser closes a user's account without deleting it
+func (s *UserService) DeactivateUser(id uint, change dtos.StatusChange) (*dtos.User, *e.Error) {
+	return s.changeStatus(id, deactivate, change.Reason)
+}
+
+// ReactivateUser lets a suspended or deactivated user log in again
+func (s *UserService) ReactivateUser(id uint, change dtos.StatusChange) (*dtos.User, *e.Error) {
+	return s.changeStatus(id, reactivate, change.Reason)
+}
+
+func (s *UserService) changeStatus(id uint, transition statusTransition, reason string) (*dtos.User, *e.Error) {
+	if id <= 0 {
+		return nil, e.NewError(http.StatusBadRequest, "Invalid Id", e.ErrInvalidUserData)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if transition.reasonRequired && reason == "" {
+		return nil, e.NewValidationError("Invalid status change", map[string][]string{"reason": {"is required to " + transition.name + " a user"}})
+	}
+
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(transition.from, user.Status) {
+		return nil, e.NewError(http.StatusConflict, fmt.Sprintf("Can't %s a user who is %s", transition.name, user.Status),
+			fmt.Errorf("%w: user %d is %s", e.ErrInvalidUserData, id, user.Status))
+	}
+
+	previous := *user
+	now := time.Now()
+	user.Status = transition.to
+	user.StatusReason = reason
+	user.StatusChangedAt = &now
+
+	if err := s.saveStatus(user); err != nil {
+		return nil, err
+	}
+
+	//the change is undone when the auth service can't be told, so it keeps issuing tokens the way the status says
+	if err := s.Credentials.SetCredentialStatus(user.ID, user.Status, reason); err != nil {
+		user.Status, user.StatusReason, user.StatusChangedAt = previous.Status, previous.StatusReason, previous.StatusChangedAt
+		if undoErr := s.saveStatus(user); undoErr != nil {
+			log.Printf("failed to undo status change of user %d: %v", user.ID, undoErr.Details)
+		}
+		return nil, credentialError(err)
+	}
+
+	return user.ToUserDTO(), nil
+}
+
+// stores a user's status along with an event about it
+func (s *UserService) saveStatus(user *models.User) *e.Error {
+	return s.inTransaction(func(repo repository.UserRepository) *e.Error {
+		if _, err := repo.Update(user); err != nil {
+			if errors.Is(err, e.ErrVersionConflict) {
+				return versionConflict(err)
+			}
+			return e.NewError(http.StatusInternalServerError, "Failed to update user status", err)
+		}
+		return enqueue(repo, events.UserStatusChanged, user)
+	})
+}
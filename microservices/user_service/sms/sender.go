@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"user-service/config"
+)
+
+// Sender delivers text messages to phone numbers in E.164 format
+type Sender interface {
+	Send(to, message string) error
+}
+
+// picks the sender configured by SMS_SENDER, only log is built in so far
+func NewSender(conf *config.Config) (Sender, error) {
+	switch conf.SMSSender {
+	case "log", "":
+		return &LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sms sender %q", conf.SMSSender)
+	}
+}
+
+// LogSender writes messages to the log instead of sending them, meant for tests and local development
+type LogSender struct {
+	mu sync.Mutex
+	//every message sent, oldest first
+	Sent []Message
+}
+
+type Message struct {
+	To   string
+	Body string
+}
+
+func (s *LogSender) Send(to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("sms to %s: %s", to, message)
+	s.Sent = append(s.Sent, Message{To: to, Body: message})
+	return nil
+}
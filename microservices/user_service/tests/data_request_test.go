@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"user-service/dtos"
+	"user-service/events"
+	"user-service/models"
+	userservice "user-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sends a request about a user's data as the user with the given id
+func requestData(t *testing.T, router *gin.Engine, method, path string, id uint) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id, "user"))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// posts an export or erasure request and returns it
+func createDataRequest(t *testing.T, router *gin.Engine, id uint, kind string) dtos.DataRequest {
+	w := requestData(t, router, "POST", fmt.Sprintf("/users/%d/%s", id, kind), id)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	var request dtos.DataRequest
+	json.Unmarshal(w.Body.Bytes(), &request)
+	if location := fmt.Sprintf("/users/%d/data-requests/%d", id, request.ID); w.Header().Get("Location") != location {
+		t.Errorf("Expected location %s, got '%s'", location, w.Header().Get("Location"))
+	}
+	return request
+}
+
+func getDataRequest(t *testing.T, router *gin.Engine, id, requestID uint) dtos.DataRequest {
+	w := requestData(t, router, "GET", fmt.Sprintf("/users/%d/data-requests/%d", id, requestID), id)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var request dtos.DataRequest
+	json.Unmarshal(w.Body.Bytes(), &request)
+	return request
+}
+
+func TestDataExportArchive(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	if w := preferenceRequest(t, router, "PUT", id, "/ui.theme", `"dark"`); w.Code != http.StatusCreated {
+		t.Fatalf("Couldn't set preference: %s", w.Body.String())
+	}
+
+	request := createDataRequest(t, router, id, "export")
+	if request.Type != models.DataRequestExport || request.Status != models.DataRequestPending {
+		t.Errorf("Expected a pending export, got %+v", request)
+	}
+
+	//one export at a time
+	if w := requestData(t, router, "POST", fmt.Sprintf("/users/%d/export", id), id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a second export, got %d", http.StatusConflict, w.Code)
+	}
+	archivePath := fmt.Sprintf("/users/%d/data-requests/%d/archive", id, request.ID)
+	if w := requestData(t, router, "GET", archivePath, id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d before the export is processed, got %d", http.StatusConflict, w.Code)
+	}
+
+	processor := userservice.NewDataRequestProcessor(env.service)
+	if processed, err := processor.RunOnce(); err != nil || processed != 1 {
+		t.Fatalf("Expected 1 request to be processed, processed %d: %v", processed, err)
+	}
+	if request = getDataRequest(t, router, id, request.ID); request.Status != models.DataRequestCompleted || !request.ArchiveAvailable {
+		t.Fatalf("Expected the export to be completed with an archive, got %+v", request)
+	}
+
+	w := requestData(t, router, "GET", archivePath, id)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Expected the archive to download, got %d: %s", w.Code, w.Body.String())
+	}
+	var export struct {
+		User        dtos.User                  `json:"user"`
+		Preferences map[string]json.RawMessage `json:"preferences"`
+		Auth        struct {
+			Credential struct {
+				Email string `json:"email"`
+			} `json:"credential"`
+		} `json:"auth_service"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("Couldn't decode archive: %v", err)
+	}
+	if export.User.Email != "jane@example.com" || string(export.Preferences["ui.theme"]) != `"dark"` || export.Auth.Credential.Email != "jane@example.com" {
+		t.Errorf("Expected the archive to hold the user's data from both services, got %s", w.Body.String())
+	}
+
+	//expired archives are removed, the request is kept
+	env.db.Model(&models.DataRequest{}).Where("id = ?", request.ID).Update("archive_expires_at", request.CompletedAt)
+	if _, err := processor.RunOnce(); err != nil {
+		t.Fatalf("Couldn't process requests: %v", err)
+	}
+	if w := requestData(t, router, "GET", archivePath, id); w.Code != http.StatusGone {
+		t.Errorf("Expected status code %d for an expired archive, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestDataExportRetriesUntilItFails(t *testing.T) {
+	router, env := setupRouter(t)
+	t.Setenv("DATA_REQUEST_MAX_ATTEMPTS", "2")
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	request := createDataRequest(t, router, id, "export")
+
+	env.credentials.err = errors.New("auth service unavailable")
+	processor := userservice.NewDataRequestProcessor(env.service)
+	processor.RunOnce()
+	if request = getDataRequest(t, router, id, request.ID); request.Status != models.DataRequestPending {
+		t.Errorf("Expected the export to be retried after the first failure, got %+v", request)
+	}
+
+	processor.RunOnce()
+	if request = getDataRequest(t, router, id, request.ID); request.Status != models.DataRequestFailed || request.Error == "" {
+		t.Errorf("Expected the export to fail after the last attempt, got %+v", request)
+	}
+
+	//a failed export can be requested again
+	env.credentials.err = nil
+	createDataRequest(t, router, id, "export")
+}
+
+func TestErasureAnonymizesUser(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	if w := preferenceRequest(t, router, "PUT", id, "/ui.theme", `"dark"`); w.Code != http.StatusCreated {
+		t.Fatalf("Couldn't set preference: %s", w.Body.String())
+	}
+	export := createDataRequest(t, router, id, "export")
+	erasure := createDataRequest(t, router, id, "erasure")
+
+	processor := userservice.NewDataRequestProcessor(env.service)
+	if processed, err := processor.RunOnce(); err != nil || processed != 2 {
+		t.Fatalf("Expected 2 requests to be processed, processed %d: %v", processed, err)
+	}
+	if erasure = getDataRequest(t, router, id, erasure.ID); erasure.Status != models.DataRequestCompleted {
+		t.Fatalf("Expected the erasure to be completed, got %+v", erasure)
+	}
+	if export = getDataRequest(t, router, id, export.ID); export.ArchiveAvailable {
+		t.Errorf("Expected the export archive to be removed by the erasure, got %+v", export)
+	}
+	if len(env.credentials.erased) != 1 || env.credentials.erased[0] != id {
+		t.Errorf("Expected the auth service to erase user %d, erased %v", id, env.credentials.erased)
+	}
+
+	var user models.User
+	env.db.Unscoped().First(&user, id)
+	if !user.Erased() || user.Email != "" || user.Name != "" {
+		t.Errorf("Expected the user to be anonymized, got %+v", user)
+	}
+	var preferences int64
+	env.db.Model(&models.Preference{}).Where("user_id = ?", id).Count(&preferences)
+	if preferences != 0 {
+		t.Errorf("Expected the preferences to be removed, %d are left", preferences)
+	}
+	if types := outboxEventTypes(t, env, id); types[len(types)-1] != events.UserErased {
+		t.Errorf("Expected a %s event, got %v", events.UserErased, types)
+	}
+
+	//erased users are gone for good
+	if w := restoreUser(t, router, id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d restoring an erased user, got %d", http.StatusConflict, w.Code)
+	}
+	if w := requestData(t, router, "POST", fmt.Sprintf("/users/%d/erasure", id), id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d erasing a user twice, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestDataRequestsAreLimitedToTheUserAndAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	request := createDataRequest(t, router, id, "export")
+
+	for _, route := range []struct{ method, path string }{
+		{"POST", fmt.Sprintf("/users/%d/export", id)},
+		{"POST", fmt.Sprintf("/users/%d/erasure", id)},
+		{"GET", fmt.Sprintf("/users/%d/data-requests", id)},
+		{"GET", fmt.Sprintf("/users/%d/data-requests/%d", id, request.ID)},
+		{"GET", fmt.Sprintf("/users/%d/data-requests/%d/archive", id, request.ID)},
+	} {
+		for token, want := range map[string]int{
+			"":                         http.StatusUnauthorized,
+			userToken(t, id+1, "user"): http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(route.method, route.path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("Expected %s %s to respond with %d, got %d: %s", route.method, route.path, want, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	//admins can follow other users' requests
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/users/%d/data-requests", id), nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id+1, "admin"))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to see the requests, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImpersonatorsCantRequestExportsOrErasure(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	request := createDataRequest(t, router, id, "export")
+	token := impersonationToken(t, id, id+1)
+
+	for _, route := range []struct{ method, path string }{
+		{"POST", fmt.Sprintf("/users/%d/export", id)},
+		{"POST", fmt.Sprintf("/users/%d/erasure", id)},
+		{"GET", fmt.Sprintf("/users/%d/data-requests/%d/archive", id, request.ID)},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s %s to be forbidden while impersonating, got %d: %s", route.method, route.path, w.Code, w.Body.String())
+		}
+	}
+
+	//other changes are allowed, and logged with the admin making them
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/users/%d/profile", id), strings.NewReader(`{"display_name":"Jane"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the impersonator to update the profile, got %d: %s", w.Code, w.Body.String())
+	}
+	if want := fmt.Sprintf("admin %d (admin@example.com) impersonating user %d: PUT /users/%d/profile", id+1, id, id); !strings.Contains(logs.String(), want) {
+		t.Errorf("Expected the change to be logged as '%s', got '%s'", want, logs.String())
+	}
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+	"user-service/dtos"
+	"user-service/events"
+	"user-service/models"
+	userservice "user-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func deleteUser(router *gin.Engine, id uint, etag string) *httptest.ResponseRecorder {
+	return conditionalRequest(router, "DELETE", id, nil, map[string]string{"If-Match": etag})
+}
+
+func restoreUser(t *testing.T, router *gin.Engine, id uint) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/"+strconv.FormatUint(uint64(id), 10)+"/restore", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, 1, "admin"))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// the types of the events written to the outbox for a user, in order
+func outboxEventTypes(t *testing.T, env *testEnv, id uint) []string {
+	var types []string
+	if err := env.db.Model(&models.OutboxMessage{}).Where("aggregate_id = ?", id).Order("id").Pluck("event_type", &types).Error; err != nil {
+		t.Fatalf("Couldn't read outbox: %v", err)
+	}
+	return types
+}
+
+func TestDeletedUsersAreHiddenUntilRestored(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	if w := deleteUser(router, id, `"1"`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if env.credentials.statuses[id] != models.StatusDeactivated {
+		t.Errorf("Expected the credentials of the deleted user to be deactivated, got '%s'", env.credentials.statuses[id])
+	}
+
+	if w := conditionalRequest(router, "GET", id, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a deleted user, got %d", http.StatusNotFound, w.Code)
+	}
+	if _, page := listUsers(t, router, ""); page.Total != 0 {
+		t.Errorf("Expected deleted users not to be listed, got %d", page.Total)
+	}
+	if _, results := searchUsers(t, router, "q=jane"); len(results.Results) != 0 {
+		t.Errorf("Expected deleted users not to be found, got %v", resultNames(results))
+	}
+
+	//the email is reserved until the user is purged
+	w := createUser(router, dtos.UserCreate{Name: "Janet", Email: "jane@example.com", Password: "correct horse battery staple"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a deleted user's email, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = restoreUser(t, router, id)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("Expected the user to be restored at version 3, got %d with '%s': %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+	if env.credentials.statuses[id] != models.StatusActive || env.credentials.passwords[id] == "" {
+		t.Errorf("Expected the credential to be enabled again with its password, got '%s'", env.credentials.statuses[id])
+	}
+	if w := conditionalRequest(router, "GET", id, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the restored user to be found, got %d", w.Code)
+	}
+
+	if w := restoreUser(t, router, id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d restoring an active user, got %d", http.StatusConflict, w.Code)
+	}
+	if w := restoreUser(t, router, 999); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d restoring an unknown user, got %d", http.StatusNotFound, w.Code)
+	}
+
+	types := outboxEventTypes(t, env, id)
+	if len(types) != 3 || types[1] != events.UserDeleted || types[2] != events.UserRestored {
+		t.Errorf("Expected created, deleted and restored events, got %v", types)
+	}
+}
+
+func TestReleasedEmailsCanBeReused(t *testing.T) {
+	t.Setenv("RELEASE_DELETED_EMAILS", "true")
+	t.Setenv("DELETED_USER_RETENTION", "1h")
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	deleteUser(router, id, `"1"`)
+
+	//the deleted user's credential gives up the email too
+	janet := createPatchableUser(t, router, "Janet", "jane@example.com")
+	if _, ok := env.credentials.emails[id]; ok || env.credentials.emails[janet] != "jane@example.com" {
+		t.Errorf("Expected the email's credential to move to the new user, got %v", env.credentials.emails)
+	}
+
+	if w := restoreUser(t, router, id); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d restoring a user whose email was taken, got %d", http.StatusConflict, w.Code)
+	}
+
+	//once the email is free again the user is restored with a new credential
+	deleteUser(router, janet, `"1"`)
+	env.db.Unscoped().Model(&models.User{}).Where("id = ?", janet).Update("deleted_at", time.Now().Add(-2*time.Hour))
+	if purged, err := userservice.NewUserPurger(env.service).RunOnce(); err != nil || purged != 1 {
+		t.Fatalf("Expected the new user to be purged, purged %d: %v", purged, err)
+	}
+	if w := restoreUser(t, router, id); w.Code != http.StatusOK {
+		t.Fatalf("Expected the user to be restored, got %d: %s", w.Code, w.Body.String())
+	}
+	if env.credentials.emails[id] != "jane@example.com" {
+		t.Errorf("Expected the credential to be recreated, got '%s'", env.credentials.emails[id])
+	}
+}
+
+func TestPurgeRemovesUsersAfterRetention(t *testing.T) {
+	t.Setenv("DELETED_USER_RETENTION", "1h")
+	router, env := setupRouter(t)
+	expired := createPatchableUser(t, router, "Jane", "jane@example.com")
+	recent := createPatchableUser(t, router, "John", "john@example.com")
+	createPatchableUser(t, router, "Active", "active@example.com")
+	deleteUser(router, expired, `"1"`)
+	deleteUser(router, recent, `"1"`)
+
+	env.db.Unscoped().Model(&models.User{}).Where("id = ?", expired).Update("deleted_at", time.Now().Add(-2*time.Hour))
+
+	purged, err := userservice.NewUserPurger(env.service).RunOnce()
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected 1 user to be purged, purged %d: %v", purged, err)
+	}
+
+	var remaining int64
+	env.db.Unscoped().Model(&models.User{}).Count(&remaining)
+	if remaining != 2 {
+		t.Errorf("Expected 2 users to remain, got %d", remaining)
+	}
+	if _, ok := env.credentials.emails[expired]; ok {
+		t.Errorf("Expected the credential of the purged user to be removed")
+	}
+	if _, ok := env.credentials.emails[recent]; !ok {
+		t.Errorf("Expected the credential of the recently deleted user to be kept")
+	}
+	if w := restoreUser(t, router, expired); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a purged user not to be restorable, got %d", w.Code)
+	}
+	if w := restoreUser(t, router, recent); w.Code != http.StatusOK {
+		t.Errorf("Expected a recently deleted user to be restorable, got %d: %s", w.Code, w.Body.String())
+	}
+
+	types := outboxEventTypes(t, env, expired)
+	if len(types) == 0 || types[len(types)-1] != events.UserPurged {
+		t.Errorf("Expected a purged event, got %v", types)
+	}
+
+	//purged users' emails are free again
+	createPatchableUser(t, router, "Janet", "jane@example.com")
+}
+
+func TestDeleteAndRestoreAreUndoneWhenAuthServiceFails(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	env.credentials.err = errors.New("connection refused")
+	if w := deleteUser(router, id, `"1"`); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+	if w := conditionalRequest(router, "GET", id, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected the user to be restored after the failed deletion, got %d", w.Code)
+	}
+
+	env.credentials.err = nil
+	w := conditionalRequest(router, "GET", id, nil, nil)
+	if w := deleteUser(router, id, w.Header().Get("ETag")); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the user to be deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	env.credentials.err = errors.New("connection refused")
+	if w := restoreUser(t, router, id); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+	if w := conditionalRequest(router, "GET", id, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the user to be deleted again after the failed restore, got %d", w.Code)
+	}
+
+	types := outboxEventTypes(t, env, id)
+	want := []string{events.UserCreated, events.UserDeleted, events.UserRestored, events.UserDeleted, events.UserRestored, events.UserDeleted}
+	if !slices.Equal(types, want) {
+		t.Errorf("Expected events %v, got %v", want, types)
+	}
+}
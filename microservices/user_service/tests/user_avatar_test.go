@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"user-service/dtos"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploads an avatar as the user with the given id
+func uploadAvatar(t *testing.T, router *gin.Engine, id uint, contentType string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="avatar"; filename="avatar"`)
+	header.Set("Content-Type", contentType)
+	part, _ := form.CreatePart(header)
+	part.Write(data)
+	form.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/users/%d/avatar", id), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id, "user"))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func getAvatar(router *gin.Engine, id uint, query string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/users/%d/avatar%s", id, query), nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func testImage(width, height int, fill color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, fill)
+		}
+	}
+	return img
+}
+
+func TestAvatarUploadMakesThumbnails(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, testImage(300, 200, color.RGBA{200, 50, 50, 255}), nil)
+	w := uploadAvatar(t, router, id, "image/jpeg", photo.Bytes())
+	var profile dtos.UserProfile
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	if w.Code != http.StatusOK || !profile.HasAvatar {
+		t.Fatalf("Expected the avatar to be uploaded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = getAvatar(router, id, "", nil)
+	original, _, err := image.DecodeConfig(w.Body)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" || err != nil || original.Width != 300 || original.Height != 200 {
+		t.Errorf("Expected the full avatar as a 300x200 jpeg, got %d %s: %+v", w.Code, w.Header().Get("Content-Type"), original)
+	}
+
+	w = getAvatar(router, id, "?size=64", nil)
+	thumbnail, _, err := image.DecodeConfig(w.Body)
+	if w.Code != http.StatusOK || err != nil || thumbnail.Width != 64 || thumbnail.Height != 64 {
+		t.Errorf("Expected a 64x64 thumbnail, got %d: %+v", w.Code, thumbnail)
+	}
+
+	etag := w.Header().Get("ETag")
+	if w := getAvatar(router, id, "?size=64", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status code %d for a cached thumbnail, got %d", http.StatusNotModified, w.Code)
+	}
+	if w := getAvatar(router, id, "?size=100", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown size, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	//a new avatar replaces the old one, transparency is kept
+	var logo bytes.Buffer
+	png.Encode(&logo, testImage(40, 40, color.RGBA{0, 0, 0, 0}))
+	if w := uploadAvatar(t, router, id, "image/png", logo.Bytes()); w.Code != http.StatusOK {
+		t.Fatalf("Expected the avatar to be replaced, got %d: %s", w.Code, w.Body.String())
+	}
+	w = getAvatar(router, id, "?size=64", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the new avatar as a png, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestAvatarUploadValidation(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	var logo bytes.Buffer
+	png.Encode(&logo, testImage(10, 10, color.White))
+
+	if w := uploadAvatar(t, router, id, "text/plain", []byte("not an image")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status code %d for text, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	if w := uploadAvatar(t, router, id, "image/jpeg", logo.Bytes()); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status code %d for a png sent as a jpeg, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	if w := uploadAvatar(t, router, id, "image/png", logo.Bytes()[:30]); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a truncated image, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	t.Setenv("AVATAR_MAX_BYTES", "20")
+	if w := uploadAvatar(t, router, id, "image/png", logo.Bytes()); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d for a large image, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	if w := getAvatar(router, id, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d without an avatar, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAvatarUploadIsLimitedToTheUserAndAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	var image bytes.Buffer
+	png.Encode(&image, testImage(10, 10, color.White))
+
+	for token, want := range map[string]int{
+		"":                         http.StatusUnauthorized,
+		userToken(t, id+1, "user"): http.StatusForbidden,
+	} {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("avatar", "avatar.png")
+		part.Write(image.Bytes())
+		form.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/users/%d/avatar", id), &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Expected status code %d, got %d: %s", want, w.Code, w.Body.String())
+		}
+	}
+
+	//avatars stay public
+	if w := getAvatar(router, id, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a user without an avatar, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/models"
+	"user-service/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sends a request to a user with the given conditional headers
+func conditionalRequest(router *gin.Engine, method string, id uint, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, fmt.Sprintf("/users/%d", id), bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetUserSupportsIfNoneMatch(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	w := conditionalRequest(router, "GET", id, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected ETag \"1\", got %d with '%s'", w.Code, w.Header().Get("ETag"))
+	}
+
+	for header, expected := range map[string]int{
+		`"1"`:        http.StatusNotModified,
+		`W/"1"`:      http.StatusNotModified,
+		`"3", "1"`:   http.StatusNotModified,
+		"*":          http.StatusNotModified,
+		`"2"`:        http.StatusOK,
+		`"1-gzip"`:   http.StatusOK,
+		`W/"2", "3"`: http.StatusOK,
+	} {
+		w := conditionalRequest(router, "GET", id, nil, map[string]string{"If-None-Match": header})
+		if w.Code != expected {
+			t.Errorf("Expected status code %d for If-None-Match %s, got %d", expected, header, w.Code)
+		}
+		if expected == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("Expected no body for If-None-Match %s, got '%s'", header, w.Body.String())
+		}
+	}
+}
+
+func TestChangesRequireCurrentETag(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	update := dtos.User{Name: "Jane Doe", Email: "jane@example.com"}
+
+	if w := conditionalRequest(router, "PUT", id, update, nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected status code %d without If-Match, got %d", http.StatusPreconditionRequired, w.Code)
+	}
+	for _, header := range []string{`"7"`, `W/"1"`, "1", `"0"`} {
+		if w := conditionalRequest(router, "PUT", id, update, map[string]string{"If-Match": header}); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected status code %d for If-Match %s, got %d", http.StatusPreconditionFailed, header, w.Code)
+		}
+	}
+
+	w := conditionalRequest(router, "PUT", id, update, map[string]string{"If-Match": `"1"`})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected the update to succeed with ETag \"2\", got %d with '%s': %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+
+	//the second admin still has the first version
+	stale := map[string]string{"If-Match": `"1"`}
+	if w := conditionalRequest(router, "PUT", id, dtos.User{Name: "Janet", Email: "jane@example.com"}, stale); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status code %d for a stale PUT, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := patchUser(router, id, "application/merge-patch+json", `{"name": "Janet"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected If-Match * to match any version, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := conditionalRequest(router, "DELETE", id, nil, stale); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status code %d for a stale DELETE, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if _, ok := env.credentials.emails[id]; !ok {
+		t.Errorf("Expected the credentials to be kept when the delete is rejected")
+	}
+
+	if w := conditionalRequest(router, "DELETE", id, nil, map[string]string{"If-Match": `"3"`}); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+func TestUpdateFailsWhenUserChangedConcurrently(t *testing.T) {
+	_, env := setupRouter(t)
+	repo := repository.NewMysqlUserRepository(env.db)
+	user, err := repo.Create(models.NewUser("Jane", "jane@example.com"))
+	if err != nil {
+		t.Fatalf("Couldn't create user: %v", err)
+	}
+
+	//both copies are loaded before either is saved
+	first, _ := repo.FindByID(user.ID)
+	second, _ := repo.FindByID(user.ID)
+
+	first.Name = "Jane Doe"
+	if _, err := repo.Update(first); err != nil || first.Version != 2 {
+		t.Fatalf("Expected the first update to succeed at version 2, got version %d: %v", first.Version, err)
+	}
+
+	second.Name = "Janet"
+	if _, err := repo.Update(second); !errors.Is(err, e.ErrVersionConflict) || second.Version != 1 {
+		t.Errorf("Expected a version conflict leaving version 1, got version %d: %v", second.Version, err)
+	}
+	if err := repo.Delete(user.ID, 1); !errors.Is(err, e.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+
+	stored, _ := repo.FindByID(user.ID)
+	if stored.Name != "Jane Doe" || stored.Version != 2 {
+		t.Errorf("Expected the first update to be kept, got %+v", stored)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// creates users named after the given names with emails at example.com
+func createUsers(t *testing.T, router *gin.Engine, names ...string) {
+	for _, name := range names {
+		w := createUser(router, dtos.UserCreate{Name: name, Email: strings.ToLower(name) + "@example.com", Password: "correct horse battery staple"})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Couldn't create %s: %s", name, w.Body.String())
+		}
+	}
+}
+
+func listUsers(t *testing.T, router *gin.Engine, query string) (*httptest.ResponseRecorder, *dtos.UserPage) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users?"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, 1, "admin"))
+	router.ServeHTTP(w, req)
+
+	var page dtos.UserPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	return w, &page
+}
+
+func TestListUsersFiltersSortsAndPaginates(t *testing.T) {
+	router, _ := setupRouter(t)
+	createUsers(t, router, "Dave", "Alice", "Eve", "Carol", "Bob")
+
+	w, page := listUsers(t, router, "sort=-name&page=2&page_size=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if page.Total != 5 || len(page.Users) != 2 || page.Users[0].Name != "Carol" || page.Users[1].Name != "Bob" {
+		t.Errorf("Expected Carol and Bob of 5 users, got %+v", page)
+	}
+	if w.Header().Get("X-Total-Count") != "5" {
+		t.Errorf("Expected X-Total-Count 5, got '%s'", w.Header().Get("X-Total-Count"))
+	}
+
+	links := w.Header().Get("Link")
+	for _, expected := range []string{`page=1&page_size=2&sort=-name>; rel="first"`, `page=1&page_size=2&sort=-name>; rel="prev"`,
+		`page=3&page_size=2&sort=-name>; rel="next"`, `page=3&page_size=2&sort=-name>; rel="last"`} {
+		if !strings.Contains(links, expected) {
+			t.Errorf("Expected Link header to contain '%s', got '%s'", expected, links)
+		}
+	}
+
+	//filters
+	_, page = listUsers(t, router, "email=AL")
+	if page.Total != 1 || page.Users[0].Name != "Alice" {
+		t.Errorf("Expected only Alice to match, got %+v", page)
+	}
+	_, page = listUsers(t, router, "email="+url.QueryEscape("_"))
+	if page.Total != 0 {
+		t.Errorf("Expected wildcards to be matched literally, got %d users", page.Total)
+	}
+	_, page = listUsers(t, router, "name=Eve&status=active")
+	if page.Total != 1 || page.Users[0].Email != "eve@example.com" {
+		t.Errorf("Expected only Eve to match, got %+v", page)
+	}
+	_, page = listUsers(t, router, "created_after="+url.QueryEscape("2999-01-01T00:00:00Z"))
+	if page.Total != 0 {
+		t.Errorf("Expected no users created in the future, got %d", page.Total)
+	}
+}
+
+func TestListUsersByCursor(t *testing.T) {
+	router, _ := setupRouter(t)
+	createUsers(t, router, "Dave", "Alice", "Eve", "Carol", "Bob")
+
+	var names []string
+	query := "sort=name&page_size=2"
+	for range 5 {
+		w, page := listUsers(t, router, query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		for _, user := range page.Users {
+			names = append(names, user.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if !strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+			t.Errorf("Expected a next link, got '%s'", w.Header().Get("Link"))
+		}
+		query = "sort=name&page_size=2&cursor=" + page.NextCursor
+	}
+
+	if strings.Join(names, ",") != "Alice,Bob,Carol,Dave,Eve" {
+		t.Errorf("Expected every user once in order, got %v", names)
+	}
+
+	//cursors only work with the sort they were created for
+	_, page := listUsers(t, router, "sort=name&page_size=2")
+	w, _ := listUsers(t, router, "sort=-name&cursor="+page.NextCursor)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestListUsersRejectsUnknownSort(t *testing.T) {
+	router, _ := setupRouter(t)
+
+	w, _ := listUsers(t, router, "sort=password")
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["sort"]) == 0 {
+		t.Errorf("Expected a sort violation, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestListingAndSearchingUsersIsLimitedToAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	createUsers(t, router, "Alice")
+
+	for _, path := range []string{"/users", "/users/search?q=alice"} {
+		for token, want := range map[string]int{
+			"":                      http.StatusUnauthorized,
+			userToken(t, 2, "user"): http.StatusForbidden,
+			serviceToken(t, "basic-go-micro", "openid"): http.StatusUnauthorized,
+			userToken(t, 1, "admin"):                    http.StatusOK,
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("Expected %s to respond with %d, got %d: %s", path, want, w.Code, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func patchUser(router *gin.Engine, id uint, contentType, patch string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/users/"+strconv.FormatUint(uint64(id), 10), strings.NewReader(patch))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("If-Match", "*")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// creates a user to be patched, returning their id
+func createPatchableUser(t *testing.T, router *gin.Engine, name, email string) uint {
+	w := createUser(router, dtos.UserCreate{Name: name, Email: email, Password: "correct horse battery staple"})
+	var user dtos.User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("Couldn't create user: %s", w.Body.String())
+	}
+	return user.Id
+}
+
+func TestPatchUserWithMergePatch(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Alice", "alice@example.com")
+
+	w := patchUser(router, id, "application/merge-patch+json", `{"name": "Alice Smith"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if user.Name != "Alice Smith" || user.Email != "alice@example.com" {
+		t.Errorf("Expected only the name to change, got %+v", user)
+	}
+
+	//plain json is treated as a merge patch, and email changes reach the auth service
+	w = patchUser(router, id, "application/json", `{"email": "alice.smith@example.com"}`)
+	if w.Code != http.StatusOK || env.credentials.emails[id] != "alice.smith@example.com" {
+		t.Errorf("Expected the email to change, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//removing a required field leaves an invalid user
+	w = patchUser(router, id, "application/merge-patch+json", `{"name": null}`)
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["name"]) == 0 {
+		t.Errorf("Expected a name violation, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPatchUserWithJSONPatch(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Bob", "bob@example.com")
+
+	w := patchUser(router, id, "application/json-patch+json",
+		`[{"op": "test", "path": "/name", "value": "Bob"}, {"op": "replace", "path": "/name", "value": "Robert"}]`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Robert"`) {
+		t.Fatalf("Expected the name to change, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//the test operation no longer holds
+	w = patchUser(router, id, "application/json-patch+json",
+		`[{"op": "test", "path": "/name", "value": "Bob"}, {"op": "replace", "path": "/name", "value": "Bobby"}]`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	for _, patch := range []string{
+		`[{"op": "replace", "path": "/email", "value": "not an email"}]`,
+		`[{"op": "replace", "path": "/status", "value": "suspended"}]`,
+		`[{"op": "add", "path": "/password", "value": "hunter2"}]`,
+		`[{"op": "remove", "path": "/nickname"}]`,
+		`{"name": "Bobby"}`,
+	} {
+		if w := patchUser(router, id, "application/json-patch+json", patch); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d: %s", http.StatusBadRequest, patch, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPatchUserChecksEmailIsUnique(t *testing.T) {
+	router, _ := setupRouter(t)
+	createPatchableUser(t, router, "Carol", "carol@example.com")
+	id := createPatchableUser(t, router, "Dave", "dave@example.com")
+
+	if w := patchUser(router, id, "application/merge-patch+json", `{"email": "carol@example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if w := patchUser(router, 999, "application/merge-patch+json", `{"name": "Nobody"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+
+	w := patchUser(router, id, "text/plain", `name=Dave`)
+	if w.Code != http.StatusUnsupportedMediaType || !strings.Contains(w.Header().Get("Accept-Patch"), "application/json-patch+json") {
+		t.Errorf("Expected status code %d with Accept-Patch, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sends a request about a preference as the user with the given id
+func preferenceRequest(t *testing.T, router *gin.Engine, method string, id uint, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, fmt.Sprintf("/users/%d/preferences%s", id, path), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id, "user"))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPreferences(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	if w := preferenceRequest(t, router, "PUT", id, "/web.theme", `"dark"`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the preference to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	w := preferenceRequest(t, router, "PUT", id, "/web.theme", `{ "mode": "dark", "contrast": 2 }`)
+	var preference dtos.Preference
+	json.Unmarshal(w.Body.Bytes(), &preference)
+	if w.Code != http.StatusOK || string(preference.Value) != `{"mode":"dark","contrast":2}` {
+		t.Errorf("Expected the preference to be replaced, got %d: %s", w.Code, w.Body.String())
+	}
+	preferenceRequest(t, router, "PUT", id, "/web.language", `"de"`)
+	preferenceRequest(t, router, "PUT", id, "/ios.notifications", `{"email":false}`)
+
+	var bulk dtos.Preferences
+	w = preferenceRequest(t, router, "GET", id, "?namespace=web", "")
+	json.Unmarshal(w.Body.Bytes(), &bulk)
+	if w.Code != http.StatusOK || len(bulk.Preferences) != 2 || string(bulk.Preferences["web.language"]) != `"de"` {
+		t.Errorf("Expected the web preferences, got %d: %s", w.Code, w.Body.String())
+	}
+	w = preferenceRequest(t, router, "GET", id, "?keys=web.theme,ios.notifications,ios.missing", "")
+	bulk = dtos.Preferences{}
+	json.Unmarshal(w.Body.Bytes(), &bulk)
+	if len(bulk.Preferences) != 2 {
+		t.Errorf("Expected the preferences asked for, got %s", w.Body.String())
+	}
+
+	if w := preferenceRequest(t, router, "DELETE", id, "/web.theme", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the preference to be deleted, got %d", w.Code)
+	}
+	if w := preferenceRequest(t, router, "GET", id, "/web.theme", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a deleted preference, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := preferenceRequest(t, router, "DELETE", id, "/web.theme", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d deleting it again, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPreferenceValidation(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	if w := preferenceRequest(t, router, "PUT", id, "/theme", `"dark"`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a key without a namespace, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := preferenceRequest(t, router, "PUT", id, "/web.theme", `dark`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a value that isn't json, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	err := env.service.RegisterPreferenceSchema("web.theme", []byte(`{"type": "string", "enum": ["light", "dark"]}`))
+	if err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	w := preferenceRequest(t, router, "PUT", id, "/web.theme", `"purple"`)
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["value"]) == 0 {
+		t.Errorf("Expected a value not matching the schema to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := preferenceRequest(t, router, "PUT", id, "/web.theme", `"light"`); w.Code != http.StatusCreated {
+		t.Errorf("Expected a value matching the schema to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Setenv("PREFERENCE_MAX_BYTES", "10")
+	if w := preferenceRequest(t, router, "PUT", id, "/web.notes", `"a long note"`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d for a large value, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	t.Setenv("PREFERENCE_MAX_COUNT", "1")
+	if w := preferenceRequest(t, router, "PUT", id, "/web.language", `"de"`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for too many preferences, got %d", http.StatusConflict, w.Code)
+	}
+	if w := preferenceRequest(t, router, "PUT", id, "/web.theme", `"dark"`); w.Code != http.StatusOK {
+		t.Errorf("Expected an existing preference to be replaced at the limit, got %d", w.Code)
+	}
+}
+
+func TestPreferencesAreLimitedToTheUserAndAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	if w := preferenceRequest(t, router, "PUT", id, "/web.theme", `"dark"`); w.Code != http.StatusCreated {
+		t.Fatalf("Couldn't set preference: %s", w.Body.String())
+	}
+
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "", ""},
+		{"GET", "/web.theme", ""},
+		{"PUT", "/web.theme", `"light"`},
+		{"DELETE", "/web.theme", ""},
+	} {
+		for token, want := range map[string]int{
+			"":                         http.StatusUnauthorized,
+			userToken(t, id+1, "user"): http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(route.method, fmt.Sprintf("/users/%d/preferences%s", id, route.path), strings.NewReader(route.body))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("Expected %s %s to respond with %d, got %d: %s", route.method, route.path, want, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	//admins can manage other users' preferences
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/users/%d/preferences/web.theme", id), nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id+1, "admin"))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to see the preference, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/sms"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sends a request about a profile as an admin
+func profileRequest(t *testing.T, router *gin.Engine, method, path string, body any) (*httptest.ResponseRecorder, *dtos.UserProfile) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+userToken(t, 1000, "admin"))
+	router.ServeHTTP(w, req)
+
+	var profile dtos.UserProfile
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	return w, &profile
+}
+
+// the code in the last message texted to the phone number
+func lastCode(t *testing.T, sender *sms.LogSender, phone string) string {
+	t.Helper()
+	if len(sender.Sent) == 0 {
+		t.Fatal("Expected a text message to be sent")
+	}
+	message := sender.Sent[len(sender.Sent)-1]
+	if message.To != phone {
+		t.Fatalf("Expected the message to be sent to %s, got %s", phone, message.To)
+	}
+	return message.Body[strings.LastIndex(message.Body, " ")+1:]
+}
+
+func TestUserProfile(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	path := fmt.Sprintf("/users/%d/profile", id)
+
+	w, profile := profileRequest(t, router, "GET", path, nil)
+	if w.Code != http.StatusOK || profile.DisplayName != "" || profile.Phone != "" {
+		t.Fatalf("Expected an empty profile, got %d: %s", w.Code, w.Body.String())
+	}
+
+	update := dtos.UserProfileUpdate{
+		DisplayName: "Jane D.",
+		AvatarURL:   "https://cdn.example.com/jane.png",
+		Phone:       "+14155550123",
+		Locale:      "en-US",
+		Timezone:    "America/Los_Angeles",
+	}
+	w, profile = profileRequest(t, router, "PUT", path, update)
+	if w.Code != http.StatusOK || profile.DisplayName != "Jane D." || profile.Timezone != "America/Los_Angeles" || profile.PhoneVerified {
+		t.Fatalf("Expected the profile to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	update.DisplayName = ""
+	if w, profile = profileRequest(t, router, "PUT", path, update); w.Code != http.StatusOK || profile.DisplayName != "" || profile.Locale != "en-US" {
+		t.Errorf("Expected the display name to be cleared, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w, _ := profileRequest(t, router, "GET", "/users/999/profile", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing user, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestUserProfileValidation(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	path := fmt.Sprintf("/users/%d/profile", id)
+
+	invalid := []dtos.UserProfileUpdate{
+		{Phone: "4155550123"},
+		{Phone: "+1 415 555 0123"},
+		{Timezone: "Mars/Olympus_Mons"},
+		{Locale: "english"},
+		{AvatarURL: "not a url"},
+		{AvatarURL: "javascript:alert(document.cookie)"},
+		{AvatarURL: "data:image/svg+xml;base64,PHN2Zz48L3N2Zz4="},
+		{AvatarURL: "ftp://example.com/jane.png"},
+		{DisplayName: strings.Repeat("a", 101)},
+	}
+	for _, update := range invalid {
+		if w, _ := profileRequest(t, router, "PUT", path, update); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %+v, got %d", http.StatusBadRequest, update, w.Code)
+		}
+	}
+}
+
+func TestPhoneVerification(t *testing.T) {
+	router, env := setupRouter(t)
+	sender := &sms.LogSender{}
+	env.service.SMS = sender
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	path := fmt.Sprintf("/users/%d/profile", id)
+
+	if w, _ := profileRequest(t, router, "POST", path+"/phone/verification", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d without a phone number, got %d", http.StatusConflict, w.Code)
+	}
+
+	profileRequest(t, router, "PUT", path, dtos.UserProfileUpdate{Phone: "+14155550123"})
+	if w, _ := profileRequest(t, router, "POST", path+"/phone/verification", nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the code to be sent, got %d: %s", w.Code, w.Body.String())
+	}
+	code := lastCode(t, sender, "+14155550123")
+	if len(code) != 6 {
+		t.Fatalf("Expected a six digit code, got '%s'", code)
+	}
+	if w, _ := profileRequest(t, router, "POST", path+"/phone/verification", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d resending right away, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	w, _ := profileRequest(t, router, "POST", path+"/phone/verification/confirm", dtos.PhoneVerificationConfirm{Code: wrong})
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["code"]) == 0 {
+		t.Errorf("Expected a wrong code to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w, profile := profileRequest(t, router, "POST", path+"/phone/verification/confirm", dtos.PhoneVerificationConfirm{Code: code})
+	if w.Code != http.StatusOK || !profile.PhoneVerified {
+		t.Fatalf("Expected the phone to be verified, got %d: %s", w.Code, w.Body.String())
+	}
+
+	//changing the number has to be verified again
+	if _, profile := profileRequest(t, router, "PUT", path, dtos.UserProfileUpdate{Phone: "+14155550199"}); profile.PhoneVerified {
+		t.Error("Expected a new phone number to be unverified")
+	}
+}
+
+func TestPhoneVerificationLocksAfterTooManyWrongCodes(t *testing.T) {
+	router, env := setupRouter(t)
+	sender := &sms.LogSender{}
+	env.service.SMS = sender
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	path := fmt.Sprintf("/users/%d/profile", id)
+
+	profileRequest(t, router, "PUT", path, dtos.UserProfileUpdate{Phone: "+14155550123"})
+	profileRequest(t, router, "POST", path+"/phone/verification", nil)
+	code := lastCode(t, sender, "+14155550123")
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range 5 {
+		profileRequest(t, router, "POST", path+"/phone/verification/confirm", dtos.PhoneVerificationConfirm{Code: wrong})
+	}
+	if w, _ := profileRequest(t, router, "POST", path+"/phone/verification/confirm", dtos.PhoneVerificationConfirm{Code: code}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d after too many wrong codes, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestProfilesAreLimitedToTheUserAndAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", fmt.Sprintf("/users/%d/profile", id), ""},
+		{"PUT", fmt.Sprintf("/users/%d/profile", id), `{"display_name":"Jane"}`},
+		{"POST", fmt.Sprintf("/users/%d/profile/phone/verification", id), ""},
+		{"POST", fmt.Sprintf("/users/%d/profile/phone/verification/confirm", id), `{"code":"123456"}`},
+	} {
+		for token, want := range map[string]int{
+			"":                         http.StatusUnauthorized,
+			userToken(t, id+1, "user"): http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(route.method, route.path, strings.NewReader(route.body))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("Expected %s %s to respond with %d, got %d: %s", route.method, route.path, want, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	//users can see their own profile
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/users/%d/profile", id), nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, id, "user"))
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the user to see their profile, got %d: %s", w.Code, w.Body.String())
+	}
+}
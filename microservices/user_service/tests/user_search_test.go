@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"user-service/dtos"
+	"user-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func searchUsers(t *testing.T, router *gin.Engine, query string) (*httptest.ResponseRecorder, *dtos.UserSearchResults) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/search?"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, 1, "admin"))
+	router.ServeHTTP(w, req)
+
+	var results dtos.UserSearchResults
+	json.Unmarshal(w.Body.Bytes(), &results)
+	return w, &results
+}
+
+func resultNames(results *dtos.UserSearchResults) []string {
+	names := []string{}
+	for _, result := range results.Results {
+		names = append(names, result.User.Name)
+	}
+	return names
+}
+
+func TestSearchUsersRanksAndHighlightsMatches(t *testing.T) {
+	router, _ := setupRouter(t)
+	for _, user := range []dtos.UserCreate{
+		{Name: "Carol Smithers", Email: "carol@example.com"},
+		{Name: "Alice Smith", Email: "alice.smith@example.com"},
+		{Name: "Bob Stone", Email: "bob@example.com"},
+	} {
+		user.Password = "correct horse battery staple"
+		if w := createUser(router, user); w.Code != http.StatusCreated {
+			t.Fatalf("Couldn't create %s: %s", user.Name, w.Body.String())
+		}
+	}
+
+	w, results := searchUsers(t, router, "q=smith")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	names := resultNames(results)
+	if len(names) != 2 || names[0] != "Alice Smith" || names[1] != "Carol Smithers" {
+		t.Fatalf("Expected the exact match to be ranked first, got %v", names)
+	}
+	alice := results.Results[0]
+	if alice.Highlights["name"] != "Alice <em>Smith</em>" || alice.Highlights["email"] != "alice.<em>smith</em>@example.com" {
+		t.Errorf("Unexpected highlights %v", alice.Highlights)
+	}
+	if results.Results[1].Highlights["name"] != "Carol <em>Smith</em>ers" {
+		t.Errorf("Expected the matched prefix to be highlighted, got %v", results.Results[1].Highlights)
+	}
+
+	//every term has to match
+	_, results = searchUsers(t, router, "q="+url.QueryEscape("ali smi"))
+	if names := resultNames(results); len(names) != 1 || names[0] != "Alice Smith" {
+		t.Errorf("Expected only Alice to match, got %v", names)
+	}
+
+	//typos after the first characters are tolerated in longer terms
+	_, results = searchUsers(t, router, "q=smiht")
+	if names := resultNames(results); len(names) != 2 {
+		t.Errorf("Expected both Smiths despite the typo, got %v", names)
+	}
+	_, results = searchUsers(t, router, "q=stome")
+	if names := resultNames(results); len(names) != 1 || names[0] != "Bob Stone" || results.Results[0].Highlights["name"] != "Bob <em>Stone</em>" {
+		t.Errorf("Expected Bob to match despite the typo, got %+v", results.Results)
+	}
+	_, results = searchUsers(t, router, "q=bom")
+	if len(results.Results) != 0 {
+		t.Errorf("Expected no typos to be tolerated in short terms, got %v", resultNames(results))
+	}
+}
+
+func TestSearchUsersEscapesHighlights(t *testing.T) {
+	router, _ := setupRouter(t)
+	createUser(router, dtos.UserCreate{Name: "<b>Dave</b>", Email: "dave@example.com", Password: "correct horse battery staple"})
+
+	_, results := searchUsers(t, router, "q=dave")
+	if len(results.Results) != 1 || results.Results[0].Highlights["name"] != "&lt;b&gt;<em>Dave</em>&lt;/b&gt;" {
+		t.Errorf("Expected the name to be escaped, got %+v", results.Results)
+	}
+}
+
+func TestSearchUsersRequiresQuery(t *testing.T) {
+	router, _ := setupRouter(t)
+
+	for _, query := range []string{"", "q=" + url.QueryEscape("@."), "q=a&limit=1000"} {
+		if w, _ := searchUsers(t, router, query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestSearchUsersFindsFullMatchesAmongManyPrefixMatches(t *testing.T) {
+	router, env := setupRouter(t)
+	//more users sharing the query's first letters than are ranked, all created before the one being looked for
+	for i := range 250 {
+		env.db.Create(models.NewUser(fmt.Sprintf("Alibaba %d", i), fmt.Sprintf("alibaba%d@example.com", i)))
+	}
+	if err := env.db.Create(models.NewUser("Alice Smith", "alice@example.com")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w, results := searchUsers(t, router, "q=alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if names := resultNames(results); len(names) != 1 || names[0] != "Alice Smith" {
+		t.Errorf("Expected only Alice to be found, got %v", names)
+	}
+}
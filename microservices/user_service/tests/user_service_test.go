@@ -1,36 +1,142 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"user-service/authclient"
+	"user-service/blob"
 	"user-service/controller"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/events"
+	"user-service/models"
+	"user-service/repository"
 	userservice "user-service/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
-func setupRouter() *gin.Engine {
+// fakeCredentials stands in for the auth service's credential store
+type fakeCredentials struct {
+	passwords map[uint]string
+	emails    map[uint]string
+	statuses  map[uint]string
+	//users whose auth data was erased
+	erased []uint
+	//returned by SetCredential when set
+	err error
+}
+
+func (f *fakeCredentials) SetCredential(userID uint, email, name, password string) error {
+	if f.err != nil {
+		return f.err
+	}
+	for id, taken := range f.emails {
+		if taken == email && id != userID {
+			return &authclient.Error{Status: http.StatusConflict}
+		}
+	}
+	f.emails[userID] = email
+	if password != "" {
+		f.passwords[userID] = password
+	}
+	return nil
+}
+
+func (f *fakeCredentials) SetCredentialStatus(userID uint, status, reason string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.emails[userID]; !ok {
+		return &authclient.Error{Status: http.StatusNotFound}
+	}
+	f.statuses[userID] = status
+	return nil
+}
+
+func (f *fakeCredentials) DeleteCredential(userID uint) error {
+	if _, ok := f.emails[userID]; !ok {
+		return &authclient.Error{Status: http.StatusNotFound}
+	}
+	delete(f.emails, userID)
+	delete(f.passwords, userID)
+	return nil
+}
+
+func (f *fakeCredentials) ExportUserData(userID uint) (json.RawMessage, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return json.Marshal(map[string]interface{}{"user_id": userID, "credential": map[string]string{"email": f.emails[userID]}})
+}
+
+func (f *fakeCredentials) EraseUserData(userID uint) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.emails, userID)
+	delete(f.passwords, userID)
+	f.erased = append(f.erased, userID)
+	return nil
+}
+
+// testEnv holds what a test needs besides the router
+type testEnv struct {
+	db          *gorm.DB
+	credentials *fakeCredentials
+	broker      *events.MemoryBroker
+	service     *userservice.UserService
+	relay       *userservice.OutboxRelay
+}
+
+func setupRouter(t *testing.T) (*gin.Engine, *testEnv) {
 	// Switch to test mode
 	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	// use a fresh in memory database for every test
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Couldn't open database: %v\n", err)
+	}
 
 	r := gin.Default()
-	userService := userservice.NewUserService(nil)
+	userService := userservice.NewUserService(repository.NewMysqlUserRepository(db))
+	env := &testEnv{
+		db:          db,
+		credentials: &fakeCredentials{passwords: map[uint]string{}, emails: map[uint]string{}, statuses: map[uint]string{}},
+		broker:      events.NewMemoryBroker(),
+	}
+	userService.Credentials = env.credentials
+	userService.PersonalData = env.credentials
+	userService.Blobs = blob.NewLocalStore(t.TempDir())
+	userService.Events = events.NewBus(env.broker)
+	env.service = userService
+	env.relay = userservice.NewOutboxRelay(userService)
 	userController := controller.NewUserController(userService)
 	userController.DefineRoutes(r)
-	return r
+	return r, env
 }
 
 func TestHelloWorld(t *testing.T) {
 	// Create a new router instance
-	router := setupRouter()
+	router, _ := setupRouter(t)
 
 	// Create a new HTTP recorder
 	w := httptest.NewRecorder()
 
 	// Create a new request
-	req, err := http.NewRequest("GET", "/users/", nil)
+	req, err := http.NewRequest("GET", "/users/health", nil)
 	if err != nil {
 		t.Fatalf("Couldn't create request: %v\n", err)
 	}
@@ -55,3 +161,342 @@ func TestHelloWorld(t *testing.T) {
 		t.Errorf("Expected response body '%s', got '%s'", expectedResponse, response)
 	}
 }
+
+func TestCreateUserStoresCredentialsWithAuthService(t *testing.T) {
+	router, env := setupRouter(t)
+
+	password := strings.Repeat("correct horse battery staple ", 4)
+	w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: password})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var user models.User
+	env.db.First(&user, "email = ?", "jane@example.com")
+	if env.credentials.passwords[user.ID] != password || env.credentials.emails[user.ID] != "jane@example.com" {
+		t.Errorf("Expected the credentials of user %d to be sent to the auth service", user.ID)
+	}
+	if env.db.Migrator().HasColumn("users", "password") {
+		t.Errorf("Expected the users table to have no password column")
+	}
+}
+
+func TestCreateUserIsUndoneWhenCredentialsAreRejected(t *testing.T) {
+	router, env := setupRouter(t)
+	env.credentials.err = &authclient.Error{
+		Status:  http.StatusBadRequest,
+		Message: "Password doesn't meet the password policy",
+		Fields:  map[string][]string{"password": {"has been found in a data breach"}},
+	}
+
+	w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"})
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["password"]) != 1 {
+		t.Errorf("Expected the auth service's password violation, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var count int64
+	env.db.Unscoped().Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the user to be removed again, found %d users", count)
+	}
+	//the profile was committed before the auth service was called, so consumers are told it's gone again
+	var types []string
+	env.db.Model(&models.OutboxMessage{}).Order("id").Pluck("event_type", &types)
+	if want := []string{events.UserCreated, events.UserDeleted, events.UserPurged}; !slices.Equal(types, want) {
+		t.Errorf("Expected events %v, got %v", want, types)
+	}
+
+	env.credentials.err = nil
+	if w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"}); w.Code != http.StatusCreated {
+		t.Errorf("Expected the email to be free again, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteUserDisablesCredentials(t *testing.T) {
+	router, env := setupRouter(t)
+	w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"})
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/users/%d", user.Id), nil)
+	req.Header.Set("If-Match", `"1"`)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if env.credentials.statuses[user.Id] != models.StatusDeactivated || env.credentials.passwords[user.Id] == "" {
+		t.Errorf("Expected the credentials of user %d to be kept but deactivated, got '%s'", user.Id, env.credentials.statuses[user.Id])
+	}
+}
+
+// signs a token like the ones the auth service mints for itself
+func serviceToken(t *testing.T, audience, scope string) string {
+	claims := jwt.MapClaims{
+		"client_id": "auth-service",
+		"scope":     scope,
+		"iss":       "http://localhost:8080/auth",
+		"aud":       audience,
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Couldn't sign token: %v\n", err)
+	}
+	return token
+}
+
+// signs an access token the auth service would issue to a user with the given role
+func userToken(t *testing.T, userID uint, role string) string {
+	return signUserToken(t, jwt.MapClaims{"userID": userID, "role": role})
+}
+
+// signs an access token the auth service would issue to an admin impersonating a user
+func impersonationToken(t *testing.T, userID, adminID uint) string {
+	return signUserToken(t, jwt.MapClaims{
+		"userID": userID,
+		"role":   "user",
+		"act":    map[string]interface{}{"sub": fmt.Sprint(adminID), "userID": adminID, "email": "admin@example.com"},
+	})
+}
+
+func signUserToken(t *testing.T, claims jwt.MapClaims) string {
+	claims["iss"] = "http://localhost:8080/auth"
+	claims["aud"] = "basic-go-micro"
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Couldn't sign token: %v\n", err)
+	}
+	return token
+}
+
+func TestCreateProfileRequiresServiceToken(t *testing.T) {
+	router, _ := setupRouter(t)
+
+	post := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/users/internal", bytes.NewBufferString(`{"name":"Jane","email":"jane@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := post(serviceToken(t, "inventory-service", "users:write")); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for another audience, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := post(serviceToken(t, "user-service", "users:read")); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d without the scope, got %d", http.StatusForbidden, w.Code)
+	}
+
+	token := serviceToken(t, "user-service", "users:write")
+	if w := post(token); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	//taken emails are reported as conflicts so the auth service can tell them apart
+	if w := post(token); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a taken email, got %d", http.StatusConflict, w.Code)
+	}
+
+	//a sign up the auth service couldn't finish is removed for good, releasing the email
+	remove := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/users/internal/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := remove(serviceToken(t, "user-service", "users:read")); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d without the scope, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := remove(token); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if w := post(token); w.Code != http.StatusCreated {
+		t.Errorf("Expected the email to be free again, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// posts a new user and returns the recorded response
+func createUser(router *gin.Engine, user dtos.UserCreate) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(user)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUserLifecycleEventsArePublished(t *testing.T) {
+	router, env := setupRouter(t)
+
+	var received []events.Event
+	for _, subject := range []string{events.UserCreated, events.UserUpdated, events.UserDeleted} {
+		env.broker.Subscribe(subject, "", func(data []byte) {
+			var event events.Event
+			json.Unmarshal(data, &event)
+			received = append(received, event)
+		})
+	}
+
+	w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"})
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+
+	body, _ := json.Marshal(dtos.User{Name: "Jane Doe", Email: "jane@example.com"})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/users/%d", user.Id), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/users/%d", user.Id), nil)
+	req.Header.Set("If-Match", `"2"`)
+	router.ServeHTTP(w, req)
+
+	//events are only published by the outbox relay
+	if len(received) != 0 {
+		t.Fatalf("Expected no events before the relay ran, got %d", len(received))
+	}
+	if published, err := env.relay.RunOnce(); err != nil || published != 3 {
+		t.Fatalf("Expected the relay to publish 3 events, published %d: %v", published, err)
+	}
+
+	expected := []string{events.UserCreated, events.UserUpdated, events.UserDeleted}
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(received))
+	}
+	for i, event := range received {
+		if event.Type != expected[i] || event.AggregateID != user.Id || event.ID == "" {
+			t.Errorf("Expected %s event for user %d, got %+v", expected[i], user.Id, event)
+		}
+	}
+
+	var data events.UserData
+	json.Unmarshal(received[1].Data, &data)
+	if data.Name != "Jane Doe" {
+		t.Errorf("Expected the updated name in the event, got '%s'", data.Name)
+	}
+}
+
+// failingPublisher fails a number of times before handing events to the real publisher
+type failingPublisher struct {
+	failures  int
+	publisher events.Publisher
+}
+
+func (p *failingPublisher) Publish(event *events.Event) error {
+	if p.failures > 0 {
+		p.failures--
+		return fmt.Errorf("broker unavailable")
+	}
+	return p.publisher.Publish(event)
+}
+
+func TestOutboxRelayRetriesFailedEventsInOrder(t *testing.T) {
+	t.Setenv("OUTBOX_MAX_BACKOFF", "1m")
+	router, env := setupRouter(t)
+
+	var received []string
+	for _, subject := range []string{events.UserCreated, events.UserUpdated} {
+		env.broker.Subscribe(subject, "", func(data []byte) {
+			var event events.Event
+			json.Unmarshal(data, &event)
+			received = append(received, event.Type)
+		})
+	}
+	env.service.Events = &failingPublisher{failures: 1, publisher: env.service.Events}
+	relay := userservice.NewOutboxRelay(env.service)
+
+	w := createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"})
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	body, _ := json.Marshal(dtos.User{Name: "Jane Doe", Email: "jane@example.com"})
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/users/%d", user.Id), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	router.ServeHTTP(w, req)
+
+	//the created event fails, so the updated event is held back
+	if published, err := relay.RunOnce(); err != nil || published != 0 {
+		t.Fatalf("Expected nothing to be published, published %d: %v", published, err)
+	}
+
+	var failed models.OutboxMessage
+	env.db.Where("event_type = ?", events.UserCreated).First(&failed)
+	if failed.Attempts != 1 || failed.LastError == "" || !failed.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("Expected the failed attempt to be recorded with a retry time, got %+v", failed)
+	}
+
+	//nothing is retried before the backoff is over
+	if published, _ := relay.RunOnce(); published != 0 {
+		t.Fatalf("Expected nothing to be published during the backoff, published %d", published)
+	}
+
+	env.db.Model(&failed).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if published, err := relay.RunOnce(); err != nil || published != 2 {
+		t.Fatalf("Expected both events to be published, published %d: %v", published, err)
+	}
+	if len(received) != 2 || received[0] != events.UserCreated || received[1] != events.UserUpdated {
+		t.Errorf("Expected the events in the order they were written, got %v", received)
+	}
+}
+
+func TestOutboxRelayDoesNotLetABlockedUserHoldUpOthers(t *testing.T) {
+	t.Setenv("OUTBOX_BATCH_SIZE", "1")
+	router, env := setupRouter(t)
+
+	var received []string
+	env.broker.Subscribe(events.UserCreated, "", func(data []byte) {
+		var event events.Event
+		json.Unmarshal(data, &event)
+		received = append(received, string(event.Data))
+	})
+	env.service.Events = &failingPublisher{failures: 1, publisher: env.service.Events}
+	relay := userservice.NewOutboxRelay(env.service)
+
+	createUser(router, dtos.UserCreate{Name: "Jane", Email: "jane@example.com", Password: "correct horse battery staple"})
+	if published, err := relay.RunOnce(); err != nil || published != 0 {
+		t.Fatalf("Expected the first event to fail, published %d: %v", published, err)
+	}
+
+	//the failed event isn't due, so the batch is taken up by the next user's event instead
+	createUser(router, dtos.UserCreate{Name: "John", Email: "john@example.com", Password: "correct horse battery staple"})
+	if published, err := relay.RunOnce(); err != nil || published != 1 {
+		t.Fatalf("Expected the second user's event to be published, published %d: %v", published, err)
+	}
+	if len(received) != 1 || !strings.Contains(received[0], "john@example.com") {
+		t.Errorf("Expected the second user's created event, got %v", received)
+	}
+}
+
+func TestEmailChangeIsUndoneWhenAuthServiceRejectsIt(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	env.credentials.err = &authclient.Error{Status: http.StatusConflict}
+	w := conditionalRequest(router, "PUT", id, dtos.User{Name: "Jane Doe", Email: "jane.doe@example.com"}, map[string]string{"If-Match": `"1"`})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	env.credentials.err = nil
+
+	var user dtos.User
+	json.Unmarshal(conditionalRequest(router, "GET", id, nil, nil).Body.Bytes(), &user)
+	if user.Name != "Jane" || user.Email != "jane@example.com" {
+		t.Errorf("Expected the change to be undone, got %+v", user)
+	}
+	if env.credentials.emails[id] != "jane@example.com" {
+		t.Errorf("Expected the credential to keep the old email, got '%s'", env.credentials.emails[id])
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/dtos"
+	e "user-service/errors"
+	"user-service/events"
+	"user-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func changeStatus(t *testing.T, router *gin.Engine, id uint, action, reason string) (*httptest.ResponseRecorder, *dtos.User) {
+	body, _ := json.Marshal(dtos.StatusChange{Reason: reason})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/users/%d/%s", id, action), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+userToken(t, 1, "admin"))
+	router.ServeHTTP(w, req)
+
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	return w, &user
+}
+
+func TestUserStatusLifecycle(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	w, _ := changeStatus(t, router, id, "suspend", " ")
+	var response e.ErrorDTO
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || len(response.Fields["reason"]) == 0 {
+		t.Errorf("Expected suspending without a reason to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w, user := changeStatus(t, router, id, "suspend", "chargeback")
+	if w.Code != http.StatusOK || user.Status != models.StatusSuspended || user.StatusReason != "chargeback" {
+		t.Fatalf("Expected the user to be suspended, got %d: %s", w.Code, w.Body.String())
+	}
+	if env.credentials.statuses[id] != models.StatusSuspended {
+		t.Errorf("Expected the auth service to be told, got '%s'", env.credentials.statuses[id])
+	}
+	if w, _ := changeStatus(t, router, id, "suspend", "again"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d suspending a suspended user, got %d", http.StatusConflict, w.Code)
+	}
+
+	if w, user := changeStatus(t, router, id, "deactivate", ""); w.Code != http.StatusOK || user.Status != models.StatusDeactivated {
+		t.Errorf("Expected the user to be deactivated, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, page := listUsers(t, router, "status=deactivated"); page.Total != 1 {
+		t.Errorf("Expected the user to be listed as deactivated, got %d", page.Total)
+	}
+
+	w, user = changeStatus(t, router, id, "reactivate", "")
+	if w.Code != http.StatusOK || user.Status != models.StatusActive || env.credentials.statuses[id] != models.StatusActive {
+		t.Errorf("Expected the user to be reactivated, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := changeStatus(t, router, id, "reactivate", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d reactivating an active user, got %d", http.StatusConflict, w.Code)
+	}
+
+	types := outboxEventTypes(t, env, id)
+	if len(types) != 4 || types[1] != events.UserStatusChanged || types[3] != events.UserStatusChanged {
+		t.Errorf("Expected a status changed event per transition, got %v", types)
+	}
+}
+
+func TestStatusChangeIsUndoneWhenAuthServiceFails(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	env.credentials.err = errors.New("connection refused")
+	if w, _ := changeStatus(t, router, id, "suspend", "chargeback"); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected status code %d, got %d: %s", http.StatusBadGateway, w.Code, w.Body.String())
+	}
+	env.credentials.err = nil
+
+	w := conditionalRequest(router, "GET", id, nil, nil)
+	var user dtos.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if user.Status != models.StatusActive {
+		t.Errorf("Expected the user to stay active, got '%s'", user.Status)
+	}
+	//both the change and its undoing were committed
+	if types := outboxEventTypes(t, env, id); len(types) != 3 || types[1] != events.UserStatusChanged || types[2] != events.UserStatusChanged {
+		t.Errorf("Expected the status change and its undoing to be published, got %v", types)
+	}
+}
+
+func TestRestoredUsersKeepTheirStatus(t *testing.T) {
+	router, env := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+	changeStatus(t, router, id, "suspend", "chargeback")
+	deleteUser(router, id, `"2"`)
+
+	if w := restoreUser(t, router, id); w.Code != http.StatusOK {
+		t.Fatalf("Expected the user to be restored, got %d: %s", w.Code, w.Body.String())
+	}
+	if env.credentials.statuses[id] != models.StatusSuspended {
+		t.Errorf("Expected the restored credential to stay suspended, got '%s'", env.credentials.statuses[id])
+	}
+}
+
+func TestChangingStatusAndRestoringIsLimitedToAdmins(t *testing.T) {
+	router, _ := setupRouter(t)
+	id := createPatchableUser(t, router, "Jane", "jane@example.com")
+
+	for _, action := range []string{"suspend", "deactivate", "reactivate", "restore"} {
+		for token, want := range map[string]int{
+			"":                       http.StatusUnauthorized,
+			userToken(t, id, "user"): http.StatusForbidden,
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", fmt.Sprintf("/users/%d/%s", id, action), bytes.NewBufferString(`{"reason":"spam"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("Expected %s to respond with %d, got %d: %s", action, want, w.Code, w.Body.String())
+			}
+		}
+	}
+}